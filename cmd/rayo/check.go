@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"rayo/internal/build"
+	"rayo/internal/diag"
+	"rayo/internal/parse"
+	"rayo/internal/sem"
+)
+
+// sourceFiles expands the arguments of a command into .ryo files: files are
+// taken as given and directories are walked, skipping hidden directories,
+// those starting with _ and testdata, as the go tool does.
+func sourceFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			name := d.Name()
+			if d.IsDir() {
+				if p != path && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(name, ".ryo") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// checkFile parses a file and, if it is free of syntax errors, runs the
+// semantic checks on it and loads the program it is the entry of, as
+// rayo run does, so that errors in its Rayo imports are reported too. Go
+// imports are resolved with the importer for the file's directory, created
+// on demand in importers. The diagnostics of the file come first, sorted
+// by position, followed by those of the modules it imports.
+func checkFile(file string, importers map[string]*sem.GoImporter) ([]*diag.SourceError, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	list := &diag.List{File: file}
+	parser := parse.NewParser(string(source))
+	mod := parser.ParseModule()
+	var imported []*diag.SourceError
+	if errs := parser.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			if pe, ok := err.(*parse.ParseError); ok {
+				list.ReportDiagnostic(pe.Diagnostic())
+			} else {
+				list.ReportDiagnostic(diag.Diagnostic{Severity: diag.Error, Code: parse.CodeSyntax, Msg: err.Error()})
+			}
+		}
+	} else {
+		dir := filepath.Dir(file)
+		gi := importers[dir]
+		if gi == nil {
+			gi = sem.NewGoImporter(dir)
+			importers[dir] = gi
+		}
+		sem.ResolveImports(mod, gi, list)
+		sem.CheckModule(mod, list)
+		if imported, err = checkProgram(file, gi, list); err != nil {
+			return nil, err
+		}
+	}
+	list.Sort()
+	result := &diag.SourceError{File: file, Source: string(source), Diagnostics: list.Diagnostics}
+	return append([]*diag.SourceError{result}, imported...), nil
+}
+
+// checkProgram loads the program whose entry module is file and checks
+// that its modules can be bound together. Diagnostics in file are added to
+// list, unless it already has them; those in other modules are returned,
+// named by their path from the working directory.
+func checkProgram(file string, gi *sem.GoImporter, list *diag.List) ([]*diag.SourceError, error) {
+	prog, err := build.Load(file, build.Options{IncludePaths: includePaths})
+	if err == nil {
+		err = prog.Check(gi)
+	}
+	if err == nil {
+		return nil, nil
+	}
+	serrs := sourceErrors(err)
+	if serrs == nil {
+		return nil, err
+	}
+	entry, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	var imported []*diag.SourceError
+	for _, serr := range serrs {
+		path := filepath.Join(filepath.Dir(entry), filepath.FromSlash(serr.File))
+		if path != entry {
+			imported = append(imported, &diag.SourceError{File: relPath(path), Source: serr.Source, Diagnostics: serr.Diagnostics})
+			continue
+		}
+		reported := map[string]bool{}
+		for _, d := range list.Diagnostics {
+			reported[d.Format(file)] = true
+		}
+		for _, d := range serr.Diagnostics {
+			if !reported[d.Format(file)] {
+				list.ReportDiagnostic(d)
+			}
+		}
+	}
+	return imported, nil
+}
+
+// relPath returns path relative to the working directory, unless it is
+// outside of it.
+func relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// checkPaths checks every source file under paths, printing diagnostics to
+// w, with source excerpts unless oneline is set. A module imported by
+// several of the files has its diagnostics printed once. It fails if any
+// file has errors, or warnings when werror is set.
+func checkPaths(w io.Writer, paths []string, werror, oneline bool) error {
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .ryo files in %s", strings.Join(paths, ", "))
+	}
+	r := &diag.Renderer{}
+	if f, ok := w.(*os.File); ok {
+		r.Color = diag.ColorEnabled(f)
+	}
+	importers := map[string]*sem.GoImporter{}
+	printed := map[string]bool{}
+	errors, warnings := 0, 0
+	for _, file := range files {
+		results, err := checkFile(file, importers)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			for _, d := range result.Diagnostics {
+				key := d.Format(filepath.Clean(result.File))
+				if printed[key] {
+					continue
+				}
+				printed[key] = true
+				switch d.Severity {
+				case diag.Error:
+					errors++
+				case diag.Warning:
+					warnings++
+				}
+				if oneline {
+					fmt.Fprintln(w, d.Format(result.File))
+				} else {
+					r.Render(w, result.File, result.Source, d)
+				}
+			}
+		}
+	}
+	if verbose {
+		fmt.Fprintf(w, "Checked %d file(s): %s, %s\n", len(files), plural(errors, "error"), plural(warnings, "warning"))
+	}
+	if errors > 0 || werror && warnings > 0 {
+		return fmt.Errorf("check failed: %s, %s", plural(errors, "error"), plural(warnings, "warning"))
+	}
+	return nil
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"rayo/internal/diag"
+	"rayo/internal/diff"
+	rayofmt "rayo/tools/fmt"
+)
+
+// formatPaths formats every source file under paths. By default the
+// formatted source is printed to w; write rewrites the files that change,
+// showDiff prints a unified diff of the changes instead, and check only
+// lists the files that are not formatted. Formatting fails if any file has
+// syntax errors or, with check, is not formatted.
+func formatPaths(w io.Writer, paths []string, write, showDiff, check bool) error {
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	unformatted := 0
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		out, err := rayofmt.Source(src)
+		if err != nil {
+			var se *diag.SourceError
+			if errors.As(err, &se) {
+				se.File = file
+			}
+			errs = append(errs, err)
+			continue
+		}
+		changed := !bytes.Equal(src, out)
+		if changed {
+			unformatted++
+		}
+		switch {
+		case check:
+			if changed {
+				fmt.Fprintln(w, file)
+			}
+		case write || showDiff:
+			if changed && showDiff {
+				fmt.Fprint(w, diff.Unified(file+".orig", file, string(src), string(out)))
+			}
+			if changed && write {
+				if err := writeFile(file, out); err != nil {
+					return err
+				}
+			}
+		default:
+			w.Write(out)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if check && unformatted > 0 {
+		return fmt.Errorf("%s not formatted", plural(unformatted, "file"))
+	}
+	return nil
+}
+
+// writeFile replaces the contents of file, keeping its permissions. The
+// new contents go to a temporary file first, so that an error leaves the
+// original intact.
+func writeFile(file string, data []byte) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".rayofmt-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+
+	"rayo/kernel"
+)
+
+// runKernel runs a Jupyter kernel listening where the connection file
+// says, until the frontend shuts it down. SIGINT is ignored: running code
+// cannot be interrupted, and the signal would end the session instead.
+func runKernel(connectionFile string) error {
+	signal.Ignore(os.Interrupt)
+	info, err := kernel.ReadConnectionFile(connectionFile)
+	if err != nil {
+		return err
+	}
+	k, err := kernel.Start(info)
+	if err != nil {
+		return err
+	}
+	k.Version = version
+	return k.Serve()
+}
+
+// jupyterDataDir returns the directory Jupyter looks for the current
+// user's kernel specs in.
+func jupyterDataDir() (string, error) {
+	if dir := os.Getenv("JUPYTER_DATA_DIR"); dir != "" {
+		return dir, nil
+	}
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return filepath.Join(dir, "jupyter"), nil
+		}
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "Jupyter"), nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "jupyter"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "jupyter"), nil
+}
+
+// installKernelSpec registers this executable as the Rayo kernel with
+// Jupyter, for the current user.
+func installKernelSpec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dataDir, err := jupyterDataDir()
+	if err != nil {
+		return err
+	}
+	spec, err := json.MarshalIndent(map[string]any{
+		"argv":         []string{exe, "kernel", "-f", "{connection_file}"},
+		"display_name": "Rayo",
+		"language":     "rayo",
+		// Interrupts come as interrupt_request messages, which the kernel
+		// answers, rather than as SIGINT
+		"interrupt_mode": "message",
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(dataDir, "kernels", "rayo")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kernel.json"), append(spec, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Installed the Rayo kernel in %s\n", dir)
+	return nil
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
-	"rayo/internal/gen"
+	"rayo/internal/ast"
+	"rayo/internal/build"
+	"rayo/internal/diag"
+	"rayo/internal/interp"
+	"rayo/internal/lex"
 	"rayo/internal/parse"
+	"rayo/internal/sem"
 
 	"github.com/spf13/cobra"
 )
@@ -25,161 +30,322 @@ var (
 	outputDir    string
 	verbose      bool
 	emitGo       bool
+	optimize     bool
+	runInterp    bool
 )
 
-func compileWithDependencies(inputFile string) (string, error) {
-	visited := make(map[string]bool)
-	var allFunctions []string
-	var allImports []string
-
-	err := collectModules(inputFile, visited, &allFunctions, &allImports)
+// loadProgram loads the program with entry module file as the command line
+// flags ask.
+func loadProgram(file string) (*build.Program, error) {
+	prog, err := build.Load(file, build.Options{IncludePaths: includePaths})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	prog.StripAsserts = optimize
+	return prog, nil
+}
 
-	// Build final Go code
-	var result strings.Builder
-	result.WriteString("package main\n\n")
+// lexFile prints the tokens of a source file, one per line or as JSON.
+func lexFile(inputFile string, asJSON, noTrivia bool) error {
+	source, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	toks := lex.Tokenize(string(source), !noTrivia)
+	if asJSON {
+		return lex.WriteTokensJSON(os.Stdout, toks)
+	}
+	return lex.WriteTokens(os.Stdout, toks)
+}
 
-	// Add unique imports
-	importSet := make(map[string]bool)
-	for _, imp := range allImports {
-		if !importSet[imp] && !strings.HasSuffix(imp, ".ryo") {
-			result.WriteString(fmt.Sprintf("import \"%s\"\n", imp))
-			importSet[imp] = true
+// parseFile prints the syntax tree of a source file in the given format.
+// The tree is printed even when there are syntax errors, which are then
+// reported on stderr and make the command fail.
+func parseFile(inputFile, format string) error {
+	source, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	parser := parse.NewParser(string(source))
+	mod := parser.ParseModule()
+	switch format {
+	case "sexpr":
+		fmt.Print(ast.Sexpr(mod))
+	case "json":
+		data, err := ast.MarshalJSON(mod)
+		if err != nil {
+			return err
 		}
+		os.Stdout.Write(data)
+	case "source":
+		fmt.Print(parse.PrettyPrint(mod))
+	default:
+		return fmt.Errorf("unknown format %q (want sexpr, json or source)", format)
 	}
-
-	// Add all functions
-	for _, fn := range allFunctions {
-		result.WriteString(fn)
-		result.WriteString("\n")
+	if errs := parser.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			if pe, ok := err.(*parse.ParseError); ok {
+				fmt.Fprintln(os.Stderr, pe.Diagnostic().Format(inputFile))
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", inputFile, err)
+			}
+		}
+		return fmt.Errorf("%d syntax error(s) in %s", len(errs), inputFile)
 	}
-
-	return result.String(), nil
+	return nil
 }
 
-func collectModules(filename string, visited map[string]bool, functions *[]string, imports *[]string) error {
-	if visited[filename] {
-		return nil // Already processed
+func transpileFile(inputFile string) error {
+	prog, err := loadProgram(inputFile)
+	if err != nil {
+		return err
 	}
-	visited[filename] = true
 
-	// Read the source file
-	source, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read file %s: %w", filename, err)
+	// A program without Rayo imports fits in a single Go file; anything
+	// larger becomes a Go module tree with one package per module.
+	if len(prog.Modules) == 1 && (outputDir == "" || filepath.Ext(outputDir) == ".go") {
+		outputFile := outputDir
+		if outputFile == "" {
+			// Default: replace .ryo extension with .go
+			outputFile = strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + ".go"
+		}
+		files, err := prog.Generate(build.DefaultModulePath, sem.NewGoImporter(prog.Root))
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(outputFile, []byte(files[prog.Entry.GoFile()]), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write output file %s: %w", outputFile, err)
+		}
+		if verbose {
+			fmt.Printf("Transpiled %s -> %s\n", inputFile, outputFile)
+		} else {
+			fmt.Printf("Generated %s\n", outputFile)
+		}
+		return nil
 	}
 
-	// Parse the source
-	parser := parse.NewParser(string(source))
-	module := parser.ParseModule()
+	outDir := outputDir
+	if outDir == "" {
+		outDir = strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + "_go"
+	}
+	goMod, err := projectGoModule(prog)
+	if err != nil {
+		return err
+	}
+	if err := prog.Emit(outDir, goMod); err != nil {
+		return err
+	}
+	if verbose {
+		for _, m := range prog.Modules {
+			fmt.Printf("Transpiled %s -> %s\n", m.File, filepath.Join(outDir, filepath.FromSlash(m.GoFile())))
+		}
+	} else {
+		fmt.Printf("Generated %s\n", outDir)
+	}
+	return nil
+}
 
-	if len(parser.Errors()) > 0 {
-		return fmt.Errorf("parse errors in %s: %v", filename, parser.Errors())
+func runFile(inputFile string, args []string) error {
+	prog, err := loadProgram(inputFile)
+	if err != nil {
+		return err
+	}
+	if runInterp {
+		return interpret(prog, append([]string{inputFile}, args...))
+	}
+	goMod, err := projectGoModule(prog)
+	if err != nil {
+		return err
 	}
 
-	// Check if this module uses print() which requires "fmt"
-	for _, stmt := range module.Body {
-		if gen.ContainsPrint(stmt) {
-			*imports = append(*imports, "fmt")
-			break
+	// Build in the run cache, reusing the binary of an unchanged program
+	cacheDir, err := build.CacheDir("run", inputFile)
+	if err != nil {
+		return err
+	}
+	built := false
+	binary, err := prog.CachedBinary(cacheDir, goMod, nil, func(dir, binary string) error {
+		built = true
+		if verbose {
+			fmt.Printf("Generated Go module: %s\n", dir)
+			fmt.Printf("Building Go code...\n")
 		}
+		return goBuild(prog, dir, binary)
+	})
+	if err != nil {
+		return err
+	}
+	if verbose && !built {
+		fmt.Printf("Using cached build: %s\n", binary)
 	}
 
-	// Process imports first
-	for _, imp := range module.Imports {
-		*imports = append(*imports, imp.Path)
+	// Run the program from the caller's working directory
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
-		// If it's a local .ryo file, recursively process it
-		if strings.HasSuffix(imp.Path, ".ryo") {
-			importPath := imp.Path
-			if strings.HasPrefix(importPath, "./") {
-				// Make path relative to current file
-				dir := filepath.Dir(filename)
-				importPath = filepath.Join(dir, importPath[2:])
-			}
+	return cmd.Run()
+}
 
-			err := collectModules(importPath, visited, functions, imports)
-			if err != nil {
-				return err
-			}
+// interpret runs prog with the interpreter rather than the Go toolchain.
+// An uncaught exception is reported at its position in the source.
+func interpret(prog *build.Program, args []string) error {
+	in := interp.New()
+	in.Args = args
+	modules := map[*build.Module]*interp.Module{}
+	for _, m := range prog.Modules {
+		deps := map[string]*interp.Module{}
+		for path, dep := range m.Deps {
+			deps[path] = modules[dep]
 		}
-	}
-
-	// Generate functions from this module
-	ctx := gen.NewGenContext("main")
-	for _, stmt := range module.Body {
-		var funcBuilder strings.Builder
-		ctx.Code = &funcBuilder
-		gen.EmitStmt(stmt, ctx)
-		if funcBuilder.Len() > 0 {
-			*functions = append(*functions, funcBuilder.String())
+		im, err := in.ExecModule(m.File, m.AST, deps)
+		if err == nil && m == prog.Entry {
+			err = in.CallMain(im)
+		}
+		if err != nil {
+			return exceptionError(prog, err)
 		}
+		modules[m] = im
 	}
-
 	return nil
 }
 
-func transpileFile(inputFile string) error {
-	// Read and compile the main file and its dependencies
-	compiledModules, err := compileWithDependencies(inputFile)
-	if err != nil {
+// exceptionError turns an uncaught exception into a diagnostic in the
+// module it was raised in.
+func exceptionError(prog *build.Program, err error) error {
+	exc, ok := err.(*interp.Exception)
+	if !ok || exc.Span == (diag.Span{}) {
 		return err
 	}
-
-	// Determine output file
-	outputFile := outputDir
-	if outputFile == "" {
-		// Default: replace .ryo extension with .go
-		outputFile = strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + ".go"
+	for _, m := range prog.Modules {
+		if m.File == exc.Module {
+			return &diag.SourceError{
+				File:        prog.DisplayName(m.File),
+				Source:      m.Source,
+				Diagnostics: []diag.Diagnostic{{Severity: diag.Error, Span: exc.Span, Msg: exc.Error()}},
+			}
+		}
 	}
+	return err
+}
 
-	// Write the generated Go code
-	err = ioutil.WriteFile(outputFile, []byte(compiledModules), 0644)
+// projectGoModule returns the go.mod settings for prog: those of its
+// project manifest, if it belongs to a project.
+func projectGoModule(prog *build.Program) (build.GoModule, error) {
+	if prog.ProjectRoot == "" {
+		return build.GoModule{}, nil
+	}
+	manifest, err := build.LoadManifest(prog.ProjectRoot)
 	if err != nil {
-		return fmt.Errorf("failed to write output file %s: %w", outputFile, err)
+		return build.GoModule{}, err
 	}
+	return manifest.GoModule(), nil
+}
 
+// goBuild compiles the main package of the Go module generated for prog in
+// dir into binary. Compiler errors are translated into Rayo diagnostics;
+// with --verbose the toolchain's own output is shown as well.
+func goBuild(prog *build.Program, dir, binary string) error {
+	cmd := exec.Command("go", "build", "-o", binary, ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
 	if verbose {
-		fmt.Printf("Transpiled %s -> %s\n", inputFile, outputFile)
-	} else {
-		fmt.Printf("Generated %s\n", outputFile)
+		os.Stderr.Write(stderr.Bytes())
 	}
-
-	return nil
+	if err != nil {
+		if berr := prog.GoBuildError(dir, stderr.String()); berr != nil {
+			return berr
+		}
+	}
+	return err
 }
 
-func runFile(inputFile string, args []string) error {
-	// Generate a temporary Go file
-	tempGoFile := strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + "_temp.go"
-
-	// Compile with dependencies
-	compiledModules, err := compileWithDependencies(inputFile)
+// buildProject generates the Go module of the project containing dir into
+// its build directory and compiles it into binary, by default named after
+// the project in its root.
+func buildProject(dir, buildDir, binary string) error {
+	absDir, err := filepath.Abs(dir)
 	if err != nil {
 		return err
 	}
-
-	// Write temporary Go file
-	err = ioutil.WriteFile(tempGoFile, []byte(compiledModules), 0644)
+	root := build.FindProjectRoot(absDir)
+	if root == "" {
+		return fmt.Errorf("no %s found in %s or any parent directory", build.ManifestFile, absDir)
+	}
+	manifest, err := build.LoadManifest(root)
+	if err != nil {
+		return err
+	}
+	prog, err := loadProgram(manifest.EntryFile())
 	if err != nil {
-		return fmt.Errorf("failed to write temp file %s: %w", tempGoFile, err)
+		return err
 	}
 
-	// Clean up temp file when done
-	defer os.Remove(tempGoFile)
+	if buildDir == "" {
+		if buildDir, err = manifest.BuildDir(); err != nil {
+			return err
+		}
+	}
+	if err := build.PrepareBuildDir(buildDir); err != nil {
+		return err
+	}
+	if err := prog.Emit(buildDir, manifest.GoModule()); err != nil {
+		return err
+	}
 
+	if binary == "" {
+		binary = filepath.Join(root, manifest.Name)
+	}
+	if binary, err = filepath.Abs(binary); err != nil {
+		return err
+	}
 	if verbose {
-		fmt.Printf("Generated temporary file: %s\n", tempGoFile)
-		fmt.Printf("Running Go code...\n")
+		fmt.Printf("Generated Go module: %s\n", buildDir)
+	}
+	if err := goBuild(prog, buildDir, binary); err != nil {
+		return err
 	}
+	fmt.Printf("Built %s\n", binary)
+	return nil
+}
 
-	// Run the Go code
-	cmd := exec.Command("go", append([]string{"run", tempGoFile}, args...)...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// exitWithError prints err and exits with status 1. Diagnostics in source
+// files are rendered with excerpts of the offending code.
+func exitWithError(err error) {
+	if serrs := sourceErrors(err); len(serrs) > 0 {
+		r := &diag.Renderer{Color: diag.ColorEnabled(os.Stderr)}
+		for _, serr := range serrs {
+			serr.Render(os.Stderr, r)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(1)
+}
 
-	return cmd.Run()
+// sourceErrors returns the diag.SourceErrors err consists of, or nil if
+// any part of err is of another kind.
+func sourceErrors(err error) []*diag.SourceError {
+	switch e := err.(type) {
+	case *diag.SourceError:
+		return []*diag.SourceError{e}
+	case interface{ Unwrap() []error }:
+		var serrs []*diag.SourceError
+		for _, err := range e.Unwrap() {
+			sub := sourceErrors(err)
+			if sub == nil {
+				return nil
+			}
+			serrs = append(serrs, sub...)
+		}
+		return serrs
+	}
+	return nil
 }
 
 func main() {
@@ -189,61 +355,161 @@ func main() {
 		Version: version,
 	}
 
-	rootCmd.PersistentFlags().StringSliceVarP(&includePaths, "include", "I", nil, "Include paths")
+	rootCmd.PersistentFlags().StringSliceVarP(&includePaths, "include", "I", nil, "Directories searched for non-relative .ryo imports")
 	rootCmd.PersistentFlags().StringVarP(&outputDir, "output", "o", "", "Output directory")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 	rootCmd.PersistentFlags().BoolVar(&emitGo, "emit-go", false, "Emit Go code")
+	rootCmd.PersistentFlags().BoolVarP(&optimize, "optimize", "O", false, "Leave out assert statements")
 
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "lex",
-		Short: "Lex source file",
+	var lexJSON, lexNoTrivia bool
+	lexCmd := &cobra.Command{
+		Use:   "lex [file]",
+		Short: "Dump the token stream of a source file",
+		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Lexing not yet implemented.")
+			if err := lexFile(args[0], lexJSON, lexNoTrivia); err != nil {
+				exitWithError(err)
+			}
 		},
-	})
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "parse",
-		Short: "Parse source file",
+	}
+	lexCmd.Flags().BoolVar(&lexJSON, "json", false, "Print tokens as a JSON array")
+	lexCmd.Flags().BoolVar(&lexNoTrivia, "no-trivia", false, "Omit whitespace and comment tokens")
+	rootCmd.AddCommand(lexCmd)
+	var parseFormat string
+	parseCmd := &cobra.Command{
+		Use:   "parse [file]",
+		Short: "Dump the syntax tree of a source file",
+		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Parsing not yet implemented.")
+			if err := parseFile(args[0], parseFormat); err != nil {
+				exitWithError(err)
+			}
 		},
-	})
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "check",
-		Short: "Check semantics",
+	}
+	parseCmd.Flags().StringVar(&parseFormat, "format", "sexpr", "Output format: sexpr, json or source")
+	rootCmd.AddCommand(parseCmd)
+	var werror, oneline bool
+	checkCmd := &cobra.Command{
+		Use:   "check [file|dir]...",
+		Short: "Report syntax and semantic errors in source files",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Semantic check not yet implemented.")
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			if err := checkPaths(os.Stderr, args, werror, oneline); err != nil {
+				exitWithError(err)
+			}
 		},
-	})
+	}
+	checkCmd.Flags().BoolVar(&werror, "werror", false, "Treat warnings as errors")
+	checkCmd.Flags().BoolVar(&oneline, "oneline", false, "Print each diagnostic on one line, without source excerpts")
+	rootCmd.AddCommand(checkCmd)
+	var fmtWrite, fmtDiff, fmtCheck bool
+	fmtCmd := &cobra.Command{
+		Use:   "fmt [file|dir]...",
+		Short: "Format source files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			if err := formatPaths(os.Stdout, args, fmtWrite, fmtDiff, fmtCheck); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	fmtCmd.Flags().BoolVarP(&fmtWrite, "write", "w", false, "Write the formatted source back to the files")
+	fmtCmd.Flags().BoolVarP(&fmtDiff, "diff", "d", false, "Print a diff of the changes instead of the formatted source")
+	fmtCmd.Flags().BoolVar(&fmtCheck, "check", false, "List files that are not formatted and fail if there are any")
+	rootCmd.AddCommand(fmtCmd)
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "transpile [file]",
 		Short: "Transpile to Go",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := transpileFile(args[0]); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 		},
 	})
-	rootCmd.AddCommand(&cobra.Command{
+	runCmd := &cobra.Command{
 		Use:   "run [file]",
 		Short: "Transpile and run",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := runFile(args[0], args[1:]); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 		},
-	})
+	}
+	runCmd.Flags().BoolVar(&runInterp, "interp", false, "Run with the interpreter instead of compiling with the Go toolchain")
+	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(&cobra.Command{
-		Use:   "test",
-		Short: "Run golden tests",
+		Use:   "repl",
+		Short: "Start an interactive session",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runREPL()
+		},
+	})
+	var connectionFile string
+	kernelCmd := &cobra.Command{
+		Use:   "kernel",
+		Short: "Run a Jupyter kernel, as started by Jupyter",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if connectionFile == "" {
+				exitWithError(fmt.Errorf("a connection file is required (-f); run \"rayo kernel install\" to make Rayo available in Jupyter"))
+			}
+			if err := runKernel(connectionFile); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	kernelCmd.Flags().StringVarP(&connectionFile, "connection-file", "f", "", "Jupyter connection file")
+	kernelCmd.AddCommand(&cobra.Command{
+		Use:   "install",
+		Short: "Register the Rayo kernel with Jupyter for the current user",
+		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Test not yet implemented.")
+			if err := installKernelSpec(); err != nil {
+				exitWithError(err)
+			}
 		},
 	})
+	rootCmd.AddCommand(kernelCmd)
+	var buildDir, buildBin string
+	buildCmd := &cobra.Command{
+		Use:   "build [dir]",
+		Short: "Build the project described by rayo.toml into a binary",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			if err := buildProject(dir, buildDir, buildBin); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	buildCmd.Flags().StringVar(&buildDir, "build-dir", "", "Directory for the generated Go module (default: user cache dir)")
+	buildCmd.Flags().StringVar(&buildBin, "bin", "", "Path of the built binary (default: the project name in the project root)")
+	rootCmd.AddCommand(buildCmd)
+	var testRun string
+	testCmd := &cobra.Command{
+		Use:   "test [file|dir]...",
+		Short: "Run the test_* functions of source files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			if err := testPaths(os.Stdout, args, testRun, verbose); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+	testCmd.Flags().StringVar(&testRun, "run", "", "Run only tests whose names match this regular expression")
+	rootCmd.AddCommand(testCmd)
 
 	// Add version command with detailed information
 	rootCmd.AddCommand(&cobra.Command{
@@ -256,6 +522,18 @@ func main() {
 		},
 	})
 
+	// Accept -run as go test spells it, among the test command's own
+	// arguments only.
+	if cmd, _, err := rootCmd.Find(os.Args[1:]); err == nil && cmd == testCmd {
+		for i, arg := range os.Args {
+			if arg == "--" {
+				break
+			}
+			if arg == "-run" || strings.HasPrefix(arg, "-run=") {
+				os.Args[i] = "-" + arg
+			}
+		}
+	}
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rayo builds the command into a temporary directory.
+func rayo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	binary := filepath.Join(t.TempDir(), "rayo")
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return binary
+}
+
+func TestRunFlag(t *testing.T) {
+	binary := rayo(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"args.ryo":   "import \"os\"\ndef main() {\n    print(os.Args)\n}\n",
+		"t_test.ryo": "def test_a() {\n}\ndef test_b() {\n}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(binary, args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("rayo %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+
+	// A program's arguments are passed on as given
+	if out := run("run", "--interp", "args.ryo", "--", "-run=x", "-run", "-v"); out != "[\"args.ryo\", \"-run=x\", \"-run\", \"-v\"]\n" {
+		t.Errorf("program got arguments %s", out)
+	}
+	// while rayo test takes -run as go test does
+	for _, flag := range [][]string{{"-run", "a"}, {"-run=a"}, {"--run", "a"}} {
+		args := append(append([]string{"test", "-v"}, flag...), "t_test.ryo")
+		if out := run(args...); !strings.Contains(out, "test_a") || strings.Contains(out, "test_b") {
+			t.Errorf("rayo %s ran:\n%s", strings.Join(args, " "), out)
+		}
+	}
+}
+
+func TestCheckImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.ryo": "import \"./lib.ryo\" as lib\ndef main() {\n    lib.nope()\n}\n",
+		"lib.ryo":  "import \"./missing.ryo\"\ndef f() {\n}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := checkPaths(&out, []string{dir}, false, true); err == nil {
+		t.Errorf("check passed")
+	}
+	// lib.ryo is reported once, though main.ryo imports it
+	want := filepath.Join(dir, "lib.ryo") + ":1:1: error[E0401]: module not found: \"./missing.ryo\"\n"
+	if strings.Count(out.String(), want) != 1 {
+		t.Errorf("got:\n%s\nwant once:\n%s", out.String(), want)
+	}
+
+	os.WriteFile(filepath.Join(dir, "missing.ryo"), nil, 0644)
+	out.Reset()
+	checkPaths(&out, []string{dir}, false, true)
+	if want := filepath.Join(dir, "main.ryo") + ":3:5: error[E0404]: undefined: lib.nope\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestKernelSpec(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("JUPYTER_DATA_DIR", dir)
+	if err := installKernelSpec(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "kernels", "rayo", "kernel.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Argv          []string `json:"argv"`
+		Language      string   `json:"language"`
+		InterruptMode string   `json:"interrupt_mode"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Argv) != 4 || spec.Argv[1] != "kernel" || spec.Language != "rayo" || spec.InterruptMode != "message" {
+		t.Errorf("kernel.json:\n%s", data)
+	}
+}
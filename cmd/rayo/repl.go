@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+
+	"rayo/repl"
+
+	"golang.org/x/term"
+)
+
+// runREPL starts an interactive session. On a terminal, lines are edited
+// with a line editor and the history is kept across sessions.
+func runREPL() {
+	r := repl.NewREPL()
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		r.Lines = repl.NewTerminal(os.Stdin, os.Stdout)
+		if file, err := repl.HistoryFile(); err == nil {
+			r.HistoryFile = file
+		}
+	}
+	r.Run()
+}
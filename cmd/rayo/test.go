@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"rayo/internal/build"
+	"rayo/internal/gen"
+	"rayo/internal/parse"
+	"rayo/internal/testrun"
+)
+
+// testPaths runs the test functions of the source files under paths,
+// those that define top-level test_* functions, each file as the entry
+// module of its own program. Only tests whose names match the regular
+// expression run selects run, if it is set. Testing fails if a file does
+// not parse or build, or any test fails.
+func testPaths(w io.Writer, paths []string, run string, verbose bool) error {
+	opts := testrun.Options{Verbose: verbose}
+	if run != "" {
+		re, err := regexp.Compile(run)
+		if err != nil {
+			return fmt.Errorf("invalid --run pattern: %v", err)
+		}
+		opts.Run = re
+	}
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	failed := 0
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		p := parse.NewParser(string(src))
+		if len(gen.TestFuncs(p.ParseModule())) == 0 && len(p.Errors()) == 0 {
+			continue
+		}
+		prog, err := loadProgram(file)
+		if err == nil {
+			opts.Mod, err = projectGoModule(prog)
+		}
+		if err == nil {
+			opts.CacheDir, err = build.CacheDir("test", file)
+		}
+		var res testrun.Result
+		if err == nil {
+			res, err = testrun.Run(w, prog, file, opts)
+		}
+		if err != nil {
+			// Diagnostics are rendered with the others at the end.
+			if sourceErrors(err) == nil {
+				err = fmt.Errorf("%s: %w", file, err)
+			}
+			fmt.Fprintf(w, "FAIL\t%s\t[build failed]\n", file)
+			errs = append(errs, err)
+			continue
+		}
+		failed += res.Failed
+		if !res.OK && res.Failed == 0 {
+			errs = append(errs, fmt.Errorf("%s: test binary failed", file))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s failed", plural(failed, "test"))
+	}
+	return nil
+}
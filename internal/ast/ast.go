@@ -2,39 +2,72 @@ package ast
 
 import "rayo/internal/diag"
 
-// Node is the base interface for all AST nodes.
+// Node is the base interface for all AST nodes. The parser records the
+// source span of every node; code that builds or rewrites trees sets spans
+// with SetSpan.
 type Node interface {
 	Span() diag.Span
+	SetSpan(diag.Span)
 }
 
-// Module represents a source file/module.
+// Module represents a source file/module. Comments lists every comment
+// group of the file in source order; see CommentMap for the statements
+// they belong to.
 type Module struct {
-	Name    string
-	Imports []*Import
-	Body    []Stmt
-	span    diag.Span
+	Name     string
+	Imports  []*Import
+	Body     []Stmt
+	Comments []*CommentGroup
+	span     diag.Span
 }
 
-func (m *Module) Span() diag.Span { return m.span }
+func (m *Module) Span() diag.Span        { return m.span }
+func (m *Module) SetSpan(span diag.Span) { m.span = span }
 
-// Import statement.
+// Import statement. Alias is set for `import "path" as alias`; Names is
+// set for `from "path" import a, b`.
 type Import struct {
-	Path string
-	span diag.Span
+	Path  string
+	Alias string
+	Names []*ImportName
+	span  diag.Span
 }
 
-func (i *Import) Span() diag.Span { return i.span }
+// ImportName is a single name imported with `from "path" import name`,
+// optionally renamed with `name as alias`.
+type ImportName struct {
+	Name  string
+	Alias string
+	span  diag.Span
+}
 
-// Function definition.
+// Local returns the name the import is bound to in the importing module.
+func (n *ImportName) Local() string {
+	if n.Alias != "" {
+		return n.Alias
+	}
+	return n.Name
+}
+
+func (n *ImportName) Span() diag.Span        { return n.span }
+func (n *ImportName) SetSpan(span diag.Span) { n.span = span }
+
+func (i *Import) Span() diag.Span        { return i.span }
+func (i *Import) SetSpan(span diag.Span) { i.span = span }
+
+// Function definition. Doc is the comment group on the lines right above
+// the def, if any.
 type FuncDef struct {
+	Doc    *CommentGroup
 	Name   string
 	Params []*Param
 	Body   []Stmt
 	span   diag.Span
 }
 
-func (f *FuncDef) Span() diag.Span { return f.span }
-func (f *FuncDef) isStmt()         {}
+func (f *FuncDef) Span() diag.Span        { return f.span }
+func (f *FuncDef) SetSpan(span diag.Span) { f.span = span }
+func (f *FuncDef) isStmt()                {}
 
 // Parameter.
 type Param struct {
@@ -43,7 +76,8 @@ type Param struct {
 	span diag.Span
 }
 
-func (p *Param) Span() diag.Span { return p.span }
+func (p *Param) Span() diag.Span        { return p.span }
+func (p *Param) SetSpan(span diag.Span) { p.span = span }
 
 // Statement base interface.
 type Stmt interface {
@@ -65,8 +99,9 @@ type VarStmt struct {
 	span  diag.Span
 }
 
-func (s *VarStmt) Span() diag.Span { return s.span }
-func (s *VarStmt) isStmt()         {}
+func (s *VarStmt) Span() diag.Span        { return s.span }
+func (s *VarStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *VarStmt) isStmt()                {}
 
 type AssignStmt struct {
 	Target Expr
@@ -74,8 +109,9 @@ type AssignStmt struct {
 	span   diag.Span
 }
 
-func (s *AssignStmt) Span() diag.Span { return s.span }
-func (s *AssignStmt) isStmt()         {}
+func (s *AssignStmt) Span() diag.Span        { return s.span }
+func (s *AssignStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *AssignStmt) isStmt()                {}
 
 type IfStmt struct {
 	Cond  Expr
@@ -85,8 +121,9 @@ type IfStmt struct {
 	span  diag.Span
 }
 
-func (s *IfStmt) Span() diag.Span { return s.span }
-func (s *IfStmt) isStmt()         {}
+func (s *IfStmt) Span() diag.Span        { return s.span }
+func (s *IfStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *IfStmt) isStmt()                {}
 
 type Elif struct {
 	Cond Expr
@@ -94,8 +131,9 @@ type Elif struct {
 	span diag.Span
 }
 
-func (e *Elif) Span() diag.Span { return e.span }
-func (e *Elif) isStmt()         {}
+func (e *Elif) Span() diag.Span        { return e.span }
+func (e *Elif) SetSpan(span diag.Span) { e.span = span }
+func (e *Elif) isStmt()                {}
 
 type WhileStmt struct {
 	Cond Expr
@@ -103,8 +141,9 @@ type WhileStmt struct {
 	span diag.Span
 }
 
-func (s *WhileStmt) Span() diag.Span { return s.span }
-func (s *WhileStmt) isStmt()         {}
+func (s *WhileStmt) Span() diag.Span        { return s.span }
+func (s *WhileStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *WhileStmt) isStmt()                {}
 
 type ForStmt struct {
 	Var  string
@@ -113,16 +152,29 @@ type ForStmt struct {
 	span diag.Span
 }
 
-func (s *ForStmt) Span() diag.Span { return s.span }
-func (s *ForStmt) isStmt()         {}
+func (s *ForStmt) Span() diag.Span        { return s.span }
+func (s *ForStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *ForStmt) isStmt()                {}
 
 type ReturnStmt struct {
 	Value Expr
 	span  diag.Span
 }
 
-func (s *ReturnStmt) Span() diag.Span { return s.span }
-func (s *ReturnStmt) isStmt()         {}
+func (s *ReturnStmt) Span() diag.Span        { return s.span }
+func (s *ReturnStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *ReturnStmt) isStmt()                {}
+
+// AssertStmt is `assert Test` or `assert Test, Msg`.
+type AssertStmt struct {
+	Test Expr
+	Msg  Expr // nil when absent
+	span diag.Span
+}
+
+func (s *AssertStmt) Span() diag.Span        { return s.span }
+func (s *AssertStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *AssertStmt) isStmt()                {}
 
 type TryStmt struct {
 	Body    []Stmt
@@ -131,8 +183,9 @@ type TryStmt struct {
 	span    diag.Span
 }
 
-func (s *TryStmt) Span() diag.Span { return s.span }
-func (s *TryStmt) isStmt()         {}
+func (s *TryStmt) Span() diag.Span        { return s.span }
+func (s *TryStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *TryStmt) isStmt()                {}
 
 type Except struct {
 	Type Type
@@ -141,16 +194,28 @@ type Except struct {
 	span diag.Span
 }
 
-func (e *Except) Span() diag.Span { return e.span }
-func (e *Except) isStmt()         {}
+func (e *Except) Span() diag.Span        { return e.span }
+func (e *Except) SetSpan(span diag.Span) { e.span = span }
+func (e *Except) isStmt()                {}
 
 type ExprStmt struct {
 	Expr Expr
 	span diag.Span
 }
 
-func (s *ExprStmt) Span() diag.Span { return s.span }
-func (s *ExprStmt) isStmt()         {}
+func (s *ExprStmt) Span() diag.Span        { return s.span }
+func (s *ExprStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *ExprStmt) isStmt()                {}
+
+// BadStmt stands for source the parser could not read as a statement. Its
+// span covers the text skipped after the syntax error.
+type BadStmt struct {
+	span diag.Span
+}
+
+func (s *BadStmt) Span() diag.Span        { return s.span }
+func (s *BadStmt) SetSpan(span diag.Span) { s.span = span }
+func (s *BadStmt) isStmt()                {}
 
 // Expression types
 
@@ -159,16 +224,18 @@ type Literal struct {
 	span  diag.Span
 }
 
-func (e *Literal) Span() diag.Span { return e.span }
-func (e *Literal) isExpr()         {}
+func (e *Literal) Span() diag.Span        { return e.span }
+func (e *Literal) SetSpan(span diag.Span) { e.span = span }
+func (e *Literal) isExpr()                {}
 
 type Name struct {
 	Ident string
 	span  diag.Span
 }
 
-func (e *Name) Span() diag.Span { return e.span }
-func (e *Name) isExpr()         {}
+func (e *Name) Span() diag.Span        { return e.span }
+func (e *Name) SetSpan(span diag.Span) { e.span = span }
+func (e *Name) isExpr()                {}
 
 type Call struct {
 	Func Expr
@@ -176,8 +243,9 @@ type Call struct {
 	span diag.Span
 }
 
-func (e *Call) Span() diag.Span { return e.span }
-func (e *Call) isExpr()         {}
+func (e *Call) Span() diag.Span        { return e.span }
+func (e *Call) SetSpan(span diag.Span) { e.span = span }
+func (e *Call) isExpr()                {}
 
 type Index struct {
 	Target Expr
@@ -185,8 +253,9 @@ type Index struct {
 	span   diag.Span
 }
 
-func (e *Index) Span() diag.Span { return e.span }
-func (e *Index) isExpr()         {}
+func (e *Index) Span() diag.Span        { return e.span }
+func (e *Index) SetSpan(span diag.Span) { e.span = span }
+func (e *Index) isExpr()                {}
 
 type Attr struct {
 	Target Expr
@@ -194,8 +263,9 @@ type Attr struct {
 	span   diag.Span
 }
 
-func (e *Attr) Span() diag.Span { return e.span }
-func (e *Attr) isExpr()         {}
+func (e *Attr) Span() diag.Span        { return e.span }
+func (e *Attr) SetSpan(span diag.Span) { e.span = span }
+func (e *Attr) isExpr()                {}
 
 type UnaryOp struct {
 	Op    string
@@ -203,8 +273,9 @@ type UnaryOp struct {
 	span  diag.Span
 }
 
-func (e *UnaryOp) Span() diag.Span { return e.span }
-func (e *UnaryOp) isExpr()         {}
+func (e *UnaryOp) Span() diag.Span        { return e.span }
+func (e *UnaryOp) SetSpan(span diag.Span) { e.span = span }
+func (e *UnaryOp) isExpr()                {}
 
 type BinaryOp struct {
 	Op    string
@@ -213,8 +284,9 @@ type BinaryOp struct {
 	span  diag.Span
 }
 
-func (e *BinaryOp) Span() diag.Span { return e.span }
-func (e *BinaryOp) isExpr()         {}
+func (e *BinaryOp) Span() diag.Span        { return e.span }
+func (e *BinaryOp) SetSpan(span diag.Span) { e.span = span }
+func (e *BinaryOp) isExpr()                {}
 
 type DictLit struct {
 	Keys []Expr
@@ -222,16 +294,18 @@ type DictLit struct {
 	span diag.Span
 }
 
-func (e *DictLit) Span() diag.Span { return e.span }
-func (e *DictLit) isExpr()         {}
+func (e *DictLit) Span() diag.Span        { return e.span }
+func (e *DictLit) SetSpan(span diag.Span) { e.span = span }
+func (e *DictLit) isExpr()                {}
 
 type ListLit struct {
 	Elems []Expr
 	span  diag.Span
 }
 
-func (e *ListLit) Span() diag.Span { return e.span }
-func (e *ListLit) isExpr()         {}
+func (e *ListLit) Span() diag.Span        { return e.span }
+func (e *ListLit) SetSpan(span diag.Span) { e.span = span }
+func (e *ListLit) isExpr()                {}
 
 type Lambda struct {
 	Params []*Param
@@ -239,8 +313,19 @@ type Lambda struct {
 	span   diag.Span
 }
 
-func (e *Lambda) Span() diag.Span { return e.span }
-func (e *Lambda) isExpr()         {}
+func (e *Lambda) Span() diag.Span        { return e.span }
+func (e *Lambda) SetSpan(span diag.Span) { e.span = span }
+func (e *Lambda) isExpr()                {}
+
+// BadExpr stands for an expression the parser could not read, such as a
+// missing operand.
+type BadExpr struct {
+	span diag.Span
+}
+
+func (e *BadExpr) Span() diag.Span        { return e.span }
+func (e *BadExpr) SetSpan(span diag.Span) { e.span = span }
+func (e *BadExpr) isExpr()                {}
 
 // Types
 
@@ -259,3 +344,9 @@ func NewName(ident string, span diag.Span) *Name {
 func NewLiteral(val any, span diag.Span) *Literal {
 	return &Literal{Value: val, span: span}
 }
+func NewBadStmt(span diag.Span) *BadStmt {
+	return &BadStmt{span: span}
+}
+func NewBadExpr(span diag.Span) *BadExpr {
+	return &BadExpr{span: span}
+}
@@ -38,3 +38,114 @@ func (v *collectVisitor) Visit(n Node) bool {
     *v.nodes = append(*v.nodes, n)
     return true
 }
+
+func sp(line, col, endCol int) diag.Span {
+    return diag.Span{
+        Start: diag.SourcePos{Line: line, Col: col, Offset: col - 1},
+        End:   diag.SourcePos{Line: line, Col: endCol, Offset: endCol - 1},
+    }
+}
+
+// everyNode builds a module using every node kind, each with a span.
+func everyNode() *Module {
+    x := NewName("x", sp(1, 1, 2))
+    return &Module{
+        Name: "all",
+        Imports: []*Import{
+            {Path: "os", Alias: "o", span: sp(1, 1, 15)},
+            {Path: "./lib.ryo", Names: []*ImportName{{Name: "f", Alias: "g", span: sp(2, 20, 26)}}, span: sp(2, 1, 26)},
+        },
+        Body: []Stmt{
+            &FuncDef{Doc: &CommentGroup{List: []*Comment{NewComment("# f negates a.", sp(2, 28, 42))}}, Name: "f", Params: []*Param{{Name: "a", Type: Optional{Elem: "int"}, span: sp(3, 7, 14)}}, Body: []Stmt{
+                &ReturnStmt{Value: &UnaryOp{Op: "-", Right: NewName("a", sp(4, 9, 10)), span: sp(4, 8, 10)}, span: sp(4, 1, 10)},
+            }, span: sp(3, 1, 20)},
+            &VarStmt{Name: "x", Value: NewLiteral(1.5, sp(5, 9, 12)), span: sp(5, 1, 12)},
+            &AssignStmt{Target: &Index{Target: x, Index: NewLiteral("k", sp(6, 3, 6)), span: sp(6, 1, 7)}, Value: NewLiteral(nil, sp(6, 10, 14)), span: sp(6, 1, 14)},
+            &IfStmt{
+                Cond:  &BinaryOp{Op: "==", Left: x, Right: NewLiteral(true, sp(7, 9, 13)), span: sp(7, 4, 13)},
+                Then:  []Stmt{&ExprStmt{Expr: &Call{Func: NewName("print", sp(8, 1, 6)), Args: []Expr{x}, span: sp(8, 1, 9)}, span: sp(8, 1, 9)}},
+                Elifs: []*Elif{{Cond: &Attr{Target: x, Attr: "y", span: sp(9, 8, 11)}, Body: []Stmt{&VarStmt{Name: "z", Value: NewLiteral(2, sp(10, 9, 10)), span: sp(10, 1, 10)}}, span: sp(9, 3, 20)}},
+                Else:  []Stmt{&ExprStmt{Expr: &ListLit{Elems: []Expr{x}, span: sp(12, 1, 4)}, span: sp(12, 1, 4)}},
+                span:  sp(7, 1, 20),
+            },
+            &WhileStmt{Cond: x, Body: []Stmt{&ExprStmt{Expr: &DictLit{Keys: []Expr{NewLiteral("a", sp(14, 2, 5))}, Vals: []Expr{x}, span: sp(14, 1, 9)}, span: sp(14, 1, 9)}}, span: sp(13, 1, 20)},
+            &ForStmt{Var: "i", Iter: x, Body: []Stmt{&ExprStmt{Expr: &Lambda{Params: []*Param{{Name: "v", span: sp(16, 8, 9)}}, Body: x, span: sp(16, 1, 12)}, span: sp(16, 1, 12)}}, span: sp(15, 1, 20)},
+            &TryStmt{
+                Body:    []Stmt{&ReturnStmt{span: sp(18, 1, 7)}},
+                Excepts: []*Except{{Type: "ValueError", Var: "e", Body: []Stmt{&ReturnStmt{Value: x, span: sp(20, 1, 9)}}, span: sp(19, 3, 30)}, {Type: Any{}, span: sp(21, 3, 30)}},
+                Finally: []Stmt{&ExprStmt{Expr: x, span: sp(22, 1, 2)}},
+                span:    sp(17, 1, 30),
+            },
+            NewBadStmt(sp(23, 1, 8)),
+            &AssertStmt{Test: x, Msg: NewLiteral("m", sp(25, 11, 14)), span: sp(25, 1, 14)},
+            &ExprStmt{Expr: &BinaryOp{Op: "+", Left: x, Right: NewBadExpr(sp(24, 5, 6)), span: sp(24, 1, 6)}, span: sp(24, 1, 6)},
+        },
+        Comments: []*CommentGroup{{List: []*Comment{NewComment("# f negates a.", sp(2, 28, 42))}}},
+        span:     sp(1, 1, 30),
+    }
+}
+
+func TestSexpr(t *testing.T) {
+    mod := &Module{Body: []Stmt{
+        &VarStmt{Name: "x", Value: NewLiteral(42, sp(1, 9, 11)), span: sp(1, 1, 11)},
+        &ExprStmt{Expr: &Call{Func: NewName("print", diag.Span{}), Args: []Expr{nil}}},
+    }}
+    want := `(Module
+  (VarStmt x @1:1-1:11
+    (Literal 42 @1:9-1:11))
+  (ExprStmt
+    (Call
+      (Name print)
+      nil)))
+`
+    if got := Sexpr(mod); got != want {
+        t.Errorf("Sexpr:\n%s\nwant:\n%s", got, want)
+    }
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+    mod := everyNode()
+    data, err := MarshalJSON(mod)
+    if err != nil {
+        t.Fatal(err)
+    }
+    back, err := UnmarshalJSON(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got, want := Sexpr(back), Sexpr(mod); got != want {
+        t.Errorf("round trip changed the tree:\n%s\nwant:\n%s", got, want)
+    }
+    // Every node kind and every span survives.
+    var before, after []Node
+    Walk(&collectVisitor{nodes: &before}, mod)
+    Walk(&collectVisitor{nodes: &after}, back)
+    if len(before) != len(after) {
+        t.Fatalf("got %d nodes, want %d", len(after), len(before))
+    }
+    for i := range before {
+        if before[i].Span() != after[i].Span() {
+            t.Errorf("node %d (%T): span %v, want %v", i, after[i], after[i].Span(), before[i].Span())
+        }
+    }
+    m := back.(*Module)
+    if len(m.Comments) != 1 || m.Comments[0].Span() != mod.Comments[0].Span() {
+        t.Errorf("comments %+v, want %+v", m.Comments, mod.Comments)
+    }
+    if doc := m.Body[0].(*FuncDef).Doc.Text(); doc != "f negates a." {
+        t.Errorf("doc comment %q", doc)
+    }
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+    for _, src := range []string{
+        `{"type": "Bogus"}`,
+        `{"type": "ExprStmt", "expr": {"type": "ReturnStmt"}}`,
+        `{"type": "Literal", "kind": "complex", "literal": 1}`,
+        `{"type": "Param", "name": "x", "annotation": {"kind": "Map"}}`,
+    } {
+        if _, err := UnmarshalJSON([]byte(src)); err == nil {
+            t.Errorf("UnmarshalJSON(%s): expected an error", src)
+        }
+    }
+}
@@ -0,0 +1,196 @@
+package ast
+
+import (
+	"sort"
+	"strings"
+
+	"rayo/internal/diag"
+)
+
+// Comment is a single # comment. Text includes the leading #.
+type Comment struct {
+	Text string
+	span diag.Span
+}
+
+func (c *Comment) Span() diag.Span        { return c.span }
+func (c *Comment) SetSpan(span diag.Span) { c.span = span }
+
+// CommentGroup is a run of comments with no code or blank line between
+// them. A comment following code on the same line forms a group of its
+// own.
+type CommentGroup struct {
+	List []*Comment
+}
+
+// Span returns the span from the start of the first comment to the end of
+// the last.
+func (g *CommentGroup) Span() diag.Span {
+	if len(g.List) == 0 {
+		return diag.Span{}
+	}
+	return diag.Span{Start: g.List[0].span.Start, End: g.List[len(g.List)-1].span.End}
+}
+
+// SetSpan is a no-op: the span of a group is that of its comments.
+func (g *CommentGroup) SetSpan(diag.Span) {}
+
+// Text returns the text of the comments without their # markers and the
+// space following them, one line per comment.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	lines := make([]string, len(g.List))
+	for i, c := range g.List {
+		text := strings.TrimPrefix(c.Text, "#")
+		text = strings.TrimPrefix(text, " ")
+		lines[i] = strings.TrimRight(text, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewComment returns a comment with the given text and span.
+func NewComment(text string, span diag.Span) *Comment {
+	return &Comment{Text: text, span: span}
+}
+
+// CommentMap associates the comment groups of a module with the statements
+// they document. A group is attached to:
+//
+//   - the statement or import ending on the line where the group starts,
+//     for a trailing comment such as `x = 1  # one`, or the statement
+//     starting there, for a comment after the `{` of a block;
+//   - otherwise the statement that follows it in the same block;
+//   - otherwise, for a comment at the end of a block, the statement that
+//     owns the block, and the module at the end of the file.
+//
+// Every group of Module.Comments ends up in exactly one entry.
+type CommentMap map[Node][]*CommentGroup
+
+// NewCommentMap builds the comment map of mod, whose nodes must have their
+// spans set by the parser.
+func NewCommentMap(mod *Module) CommentMap {
+	cm := CommentMap{}
+	if len(mod.Comments) == 0 {
+		return cm
+	}
+	ix := &stmtIndex{block: map[Node]int{}}
+	for _, imp := range mod.Imports {
+		ix.add(imp, 0)
+	}
+	for _, s := range mod.Body {
+		ix.add(s, 0)
+	}
+	sort.SliceStable(ix.nodes, func(i, j int) bool {
+		return ix.nodes[i].Span().Start.Offset < ix.nodes[j].Span().Start.Offset
+	})
+	for _, g := range mod.Comments {
+		owner := ix.owner(mod, g)
+		cm[owner] = append(cm[owner], g)
+	}
+	return cm
+}
+
+// stmtIndex lists the statements and imports of a module, which comments
+// are attached to, in preorder, with the block each belongs to.
+type stmtIndex struct {
+	nodes  []Node
+	block  map[Node]int
+	blocks int
+}
+
+func (ix *stmtIndex) add(n Node, block int) {
+	ix.nodes = append(ix.nodes, n)
+	ix.block[n] = block
+	switch x := n.(type) {
+	case *FuncDef:
+		ix.addBlock(x.Body)
+	case *IfStmt:
+		ix.addBlock(x.Then)
+		for _, elif := range x.Elifs {
+			ix.blocks++
+			ix.add(elif, ix.blocks)
+		}
+		ix.addBlock(x.Else)
+	case *Elif:
+		ix.addBlock(x.Body)
+	case *WhileStmt:
+		ix.addBlock(x.Body)
+	case *ForStmt:
+		ix.addBlock(x.Body)
+	case *TryStmt:
+		ix.addBlock(x.Body)
+		for _, exc := range x.Excepts {
+			ix.blocks++
+			ix.add(exc, ix.blocks)
+		}
+		ix.addBlock(x.Finally)
+	case *Except:
+		ix.addBlock(x.Body)
+	}
+}
+
+func (ix *stmtIndex) addBlock(stmts []Stmt) {
+	ix.blocks++
+	block := ix.blocks
+	for _, s := range stmts {
+		ix.add(s, block)
+	}
+}
+
+func (ix *stmtIndex) owner(mod *Module, g *CommentGroup) Node {
+	span := g.Span()
+	// Trailing comment: the widest node ending on the same line, before it.
+	var trailing Node
+	for _, n := range ix.nodes {
+		end := n.Span().End
+		if end.Line == span.Start.Line && end.Offset <= span.Start.Offset {
+			if trailing == nil || end.Offset > trailing.Span().End.Offset {
+				trailing = n
+			}
+		}
+	}
+	if trailing != nil {
+		return trailing
+	}
+	// The innermost node containing the comment encloses it.
+	var enclosing Node = mod
+	for _, n := range ix.nodes {
+		s := n.Span()
+		if s.Start.Offset <= span.Start.Offset && span.End.Offset <= s.End.Offset {
+			enclosing = n
+		}
+	}
+	// A comment after the opening of a block, as in `if x {  # why`,
+	// belongs to the statement owning the block.
+	if enclosing != Node(mod) && enclosing.Span().Start.Line == span.Start.Line {
+		return enclosing
+	}
+	inside := func(n Node) bool {
+		if enclosing == Node(mod) {
+			return true
+		}
+		s, e := n.Span(), enclosing.Span()
+		return n != enclosing && e.Start.Offset <= s.Start.Offset && s.End.Offset <= e.End.Offset
+	}
+	// Leading comment: the next node, if it is in the same block as the
+	// node before the comment.
+	var prev, next Node
+	for _, n := range ix.nodes {
+		if !inside(n) {
+			continue
+		}
+		s := n.Span()
+		if s.End.Offset <= span.Start.Offset && (prev == nil || s.End.Offset > prev.Span().End.Offset) {
+			prev = n
+		}
+		if next == nil && s.Start.Offset >= span.End.Offset {
+			next = n
+		}
+	}
+	if next != nil && (prev == nil || ix.block[prev] == ix.block[next]) {
+		return next
+	}
+	return enclosing
+}
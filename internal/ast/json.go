@@ -0,0 +1,588 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"rayo/internal/diag"
+)
+
+// jsonNode is the JSON form of every node kind: Type names the Go type of
+// the node and only the fields of that kind are set.
+type jsonNode struct {
+	Type string    `json:"type"`
+	Span *jsonSpan `json:"span,omitempty"`
+
+	Name  string `json:"name,omitempty"`
+	Ident string `json:"ident,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Alias string `json:"alias,omitempty"`
+	Var   string `json:"var,omitempty"`
+	Attr  string `json:"attr,omitempty"`
+	Op    string `json:"op,omitempty"`
+
+	Annotation *jsonType       `json:"annotation,omitempty"`
+	Literal    json.RawMessage `json:"literal,omitempty"`
+	Kind       string          `json:"kind,omitempty"` // literal kind
+
+	Imports []*jsonNode `json:"imports,omitempty"`
+	Names   []*jsonNode `json:"names,omitempty"`
+	Params  []*jsonNode `json:"params,omitempty"`
+	Body    []*jsonNode `json:"body,omitempty"`
+	Then    []*jsonNode `json:"then,omitempty"`
+	Elifs   []*jsonNode `json:"elifs,omitempty"`
+	Else    []*jsonNode `json:"else,omitempty"`
+	Excepts []*jsonNode `json:"excepts,omitempty"`
+	Finally []*jsonNode `json:"finally,omitempty"`
+	Args    []*jsonNode `json:"args,omitempty"`
+	Keys    []*jsonNode `json:"keys,omitempty"`
+	Vals    []*jsonNode `json:"vals,omitempty"`
+	Elems   []*jsonNode `json:"elems,omitempty"`
+
+	Cond   *jsonNode `json:"cond,omitempty"`
+	Iter   *jsonNode `json:"iter,omitempty"`
+	Value  *jsonNode `json:"value,omitempty"`
+	Target *jsonNode `json:"target,omitempty"`
+	Index  *jsonNode `json:"index,omitempty"`
+	Func   *jsonNode `json:"func,omitempty"`
+	Left   *jsonNode `json:"left,omitempty"`
+	Right  *jsonNode `json:"right,omitempty"`
+	Expr   *jsonNode `json:"expr,omitempty"`
+	// LambdaBody is the body expression of a Lambda.
+	LambdaBody *jsonNode `json:"result,omitempty"`
+
+	Doc      []*jsonComment   `json:"doc,omitempty"`
+	Comments [][]*jsonComment `json:"comments,omitempty"`
+}
+
+// jsonComment is a comment; comment groups are lists of them.
+type jsonComment struct {
+	Text string    `json:"text"`
+	Span *jsonSpan `json:"span,omitempty"`
+}
+
+func groupToJSON(g *CommentGroup) []*jsonComment {
+	if g == nil {
+		return nil
+	}
+	out := make([]*jsonComment, len(g.List))
+	for i, c := range g.List {
+		out[i] = &jsonComment{Text: c.Text, Span: spanToJSON(c.span)}
+	}
+	return out
+}
+
+func groupFromJSON(js []*jsonComment) *CommentGroup {
+	if len(js) == 0 {
+		return nil
+	}
+	g := &CommentGroup{}
+	for _, j := range js {
+		g.List = append(g.List, &Comment{Text: j.Text, span: spanFromJSON(j.Span)})
+	}
+	return g
+}
+
+type jsonPos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Col    int `json:"col"`
+}
+
+type jsonSpan struct {
+	Start jsonPos `json:"start"`
+	End   jsonPos `json:"end"`
+}
+
+// jsonType is the JSON form of a type annotation: a named type, any, or
+// an optional type with its element type.
+type jsonType struct {
+	Kind string    `json:"kind"` // "Named", "Any" or "Optional"
+	Name string    `json:"name,omitempty"`
+	Elem *jsonType `json:"elem,omitempty"`
+}
+
+// MarshalJSON encodes the tree rooted at n as indented JSON. Missing child
+// expressions, such as those left by syntax errors, encode as null.
+func MarshalJSON(n Node) ([]byte, error) {
+	j, err := toJSON(n)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(j); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a tree encoded by MarshalJSON, spans included.
+func UnmarshalJSON(data []byte) (Node, error) {
+	var j *jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	return fromJSON(j)
+}
+
+func spanToJSON(s diag.Span) *jsonSpan {
+	if s == (diag.Span{}) {
+		return nil
+	}
+	return &jsonSpan{
+		Start: jsonPos{Offset: s.Start.Offset, Line: s.Start.Line, Col: s.Start.Col},
+		End:   jsonPos{Offset: s.End.Offset, Line: s.End.Line, Col: s.End.Col},
+	}
+}
+
+func spanFromJSON(j *jsonSpan) diag.Span {
+	if j == nil {
+		return diag.Span{}
+	}
+	return diag.Span{
+		Start: diag.SourcePos{Offset: j.Start.Offset, Line: j.Start.Line, Col: j.Start.Col},
+		End:   diag.SourcePos{Offset: j.End.Offset, Line: j.End.Line, Col: j.End.Col},
+	}
+}
+
+func typeToJSON(t Type) (*jsonType, error) {
+	switch t := t.(type) {
+	case nil:
+		return nil, nil
+	case Any, *Any:
+		return &jsonType{Kind: "Any"}, nil
+	case string:
+		return &jsonType{Kind: "Named", Name: t}, nil
+	case Optional:
+		elem, err := typeToJSON(t.Elem)
+		return &jsonType{Kind: "Optional", Elem: elem}, err
+	case *Optional:
+		elem, err := typeToJSON(t.Elem)
+		return &jsonType{Kind: "Optional", Elem: elem}, err
+	default:
+		return nil, fmt.Errorf("cannot encode type annotation %T", t)
+	}
+}
+
+func typeFromJSON(j *jsonType) (Type, error) {
+	if j == nil {
+		return nil, nil
+	}
+	switch j.Kind {
+	case "Any":
+		return Any{}, nil
+	case "Named":
+		return j.Name, nil
+	case "Optional":
+		elem, err := typeFromJSON(j.Elem)
+		return Optional{Elem: elem}, err
+	default:
+		return nil, fmt.Errorf("unknown type annotation kind %q", j.Kind)
+	}
+}
+
+func literalToJSON(v any) (json.RawMessage, string, error) {
+	var kind string
+	switch v.(type) {
+	case nil:
+		kind = "none"
+	case bool:
+		kind = "bool"
+	case int:
+		kind = "int"
+	case float64:
+		kind = "float"
+	case string:
+		kind = "string"
+	default:
+		return nil, "", fmt.Errorf("cannot encode literal of type %T", v)
+	}
+	raw, err := json.Marshal(v)
+	return raw, kind, err
+}
+
+func literalFromJSON(raw json.RawMessage, kind string) (any, error) {
+	var err error
+	switch kind {
+	case "none":
+		return nil, nil
+	case "bool":
+		var b bool
+		err = json.Unmarshal(raw, &b)
+		return b, err
+	case "int":
+		var i int
+		err = json.Unmarshal(raw, &i)
+		return i, err
+	case "float":
+		var f float64
+		err = json.Unmarshal(raw, &f)
+		return f, err
+	case "string":
+		var s string
+		err = json.Unmarshal(raw, &s)
+		return s, err
+	default:
+		return nil, fmt.Errorf("unknown literal kind %q", kind)
+	}
+}
+
+func toJSON(n Node) (*jsonNode, error) {
+	if n == nil {
+		return nil, nil
+	}
+	e := &jsonEncoder{}
+	j := e.node(n)
+	return j, e.err
+}
+
+// jsonEncoder converts nodes to jsonNodes, keeping the first error.
+type jsonEncoder struct {
+	err error
+}
+
+func (e *jsonEncoder) stmts(stmts []Stmt) []*jsonNode {
+	var out []*jsonNode
+	for _, s := range stmts {
+		out = append(out, e.node(s))
+	}
+	return out
+}
+
+func (e *jsonEncoder) exprs(exprs []Expr) []*jsonNode {
+	var out []*jsonNode
+	for _, x := range exprs {
+		out = append(out, e.node(x))
+	}
+	return out
+}
+
+func (e *jsonEncoder) params(params []*Param) []*jsonNode {
+	var out []*jsonNode
+	for _, p := range params {
+		out = append(out, e.node(p))
+	}
+	return out
+}
+
+func (e *jsonEncoder) annotation(t Type) *jsonType {
+	j, err := typeToJSON(t)
+	if err != nil && e.err == nil {
+		e.err = err
+	}
+	return j
+}
+
+func (e *jsonEncoder) node(n Node) *jsonNode {
+	if n == nil {
+		return nil
+	}
+	j := &jsonNode{Span: spanToJSON(n.Span())}
+	switch x := n.(type) {
+	case *Module:
+		j.Type, j.Name = "Module", x.Name
+		for _, imp := range x.Imports {
+			j.Imports = append(j.Imports, e.node(imp))
+		}
+		j.Body = e.stmts(x.Body)
+		for _, g := range x.Comments {
+			j.Comments = append(j.Comments, groupToJSON(g))
+		}
+	case *Import:
+		j.Type, j.Path, j.Alias = "Import", x.Path, x.Alias
+		for _, name := range x.Names {
+			j.Names = append(j.Names, e.node(name))
+		}
+	case *ImportName:
+		j.Type, j.Name, j.Alias = "ImportName", x.Name, x.Alias
+	case *FuncDef:
+		j.Type, j.Name = "FuncDef", x.Name
+		j.Doc = groupToJSON(x.Doc)
+		j.Params = e.params(x.Params)
+		j.Body = e.stmts(x.Body)
+	case *Param:
+		j.Type, j.Name = "Param", x.Name
+		j.Annotation = e.annotation(x.Type)
+	case *VarStmt:
+		j.Type, j.Name = "VarStmt", x.Name
+		j.Value = e.node(x.Value)
+	case *AssignStmt:
+		j.Type = "AssignStmt"
+		j.Target, j.Value = e.node(x.Target), e.node(x.Value)
+	case *IfStmt:
+		j.Type = "IfStmt"
+		j.Cond = e.node(x.Cond)
+		j.Then = e.stmts(x.Then)
+		for _, elif := range x.Elifs {
+			j.Elifs = append(j.Elifs, e.node(elif))
+		}
+		j.Else = e.stmts(x.Else)
+	case *Elif:
+		j.Type = "Elif"
+		j.Cond, j.Body = e.node(x.Cond), e.stmts(x.Body)
+	case *WhileStmt:
+		j.Type = "WhileStmt"
+		j.Cond, j.Body = e.node(x.Cond), e.stmts(x.Body)
+	case *ForStmt:
+		j.Type, j.Var = "ForStmt", x.Var
+		j.Iter, j.Body = e.node(x.Iter), e.stmts(x.Body)
+	case *ReturnStmt:
+		j.Type = "ReturnStmt"
+		j.Value = e.node(x.Value)
+	case *AssertStmt:
+		j.Type = "AssertStmt"
+		j.Cond, j.Value = e.node(x.Test), e.node(x.Msg)
+	case *TryStmt:
+		j.Type = "TryStmt"
+		j.Body = e.stmts(x.Body)
+		for _, exc := range x.Excepts {
+			j.Excepts = append(j.Excepts, e.node(exc))
+		}
+		j.Finally = e.stmts(x.Finally)
+	case *Except:
+		j.Type, j.Var = "Except", x.Var
+		j.Annotation = e.annotation(x.Type)
+		j.Body = e.stmts(x.Body)
+	case *ExprStmt:
+		j.Type = "ExprStmt"
+		j.Expr = e.node(x.Expr)
+	case *BadStmt:
+		j.Type = "BadStmt"
+	case *Literal:
+		j.Type = "Literal"
+		raw, kind, err := literalToJSON(x.Value)
+		if err != nil && e.err == nil {
+			e.err = err
+		}
+		j.Literal, j.Kind = raw, kind
+	case *Name:
+		j.Type, j.Ident = "Name", x.Ident
+	case *Call:
+		j.Type = "Call"
+		j.Func, j.Args = e.node(x.Func), e.exprs(x.Args)
+	case *Index:
+		j.Type = "Index"
+		j.Target, j.Index = e.node(x.Target), e.node(x.Index)
+	case *Attr:
+		j.Type, j.Attr = "Attr", x.Attr
+		j.Target = e.node(x.Target)
+	case *UnaryOp:
+		j.Type, j.Op = "UnaryOp", x.Op
+		j.Right = e.node(x.Right)
+	case *BinaryOp:
+		j.Type, j.Op = "BinaryOp", x.Op
+		j.Left, j.Right = e.node(x.Left), e.node(x.Right)
+	case *DictLit:
+		j.Type = "DictLit"
+		j.Keys, j.Vals = e.exprs(x.Keys), e.exprs(x.Vals)
+	case *ListLit:
+		j.Type = "ListLit"
+		j.Elems = e.exprs(x.Elems)
+	case *Lambda:
+		j.Type = "Lambda"
+		j.Params = e.params(x.Params)
+		j.LambdaBody = e.node(x.Body)
+	case *BadExpr:
+		j.Type = "BadExpr"
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode node %T", n)
+		}
+	}
+	return j
+}
+
+// jsonDecoder converts jsonNodes back to nodes, keeping the first error.
+type jsonDecoder struct {
+	err error
+}
+
+func fromJSON(j *jsonNode) (Node, error) {
+	d := &jsonDecoder{}
+	n := d.node(j)
+	return n, d.err
+}
+
+func (d *jsonDecoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (d *jsonDecoder) stmt(j *jsonNode) Stmt {
+	n := d.node(j)
+	if n == nil {
+		return nil
+	}
+	s, ok := n.(Stmt)
+	if !ok {
+		d.fail("%s is not a statement", j.Type)
+	}
+	return s
+}
+
+func (d *jsonDecoder) expr(j *jsonNode) Expr {
+	n := d.node(j)
+	if n == nil {
+		return nil
+	}
+	x, ok := n.(Expr)
+	if !ok {
+		d.fail("%s is not an expression", j.Type)
+	}
+	return x
+}
+
+func (d *jsonDecoder) stmts(js []*jsonNode) []Stmt {
+	var out []Stmt
+	for _, j := range js {
+		out = append(out, d.stmt(j))
+	}
+	return out
+}
+
+func (d *jsonDecoder) exprs(js []*jsonNode) []Expr {
+	var out []Expr
+	for _, j := range js {
+		out = append(out, d.expr(j))
+	}
+	return out
+}
+
+func (d *jsonDecoder) params(js []*jsonNode) []*Param {
+	var out []*Param
+	for _, j := range js {
+		p, ok := d.node(j).(*Param)
+		if !ok {
+			d.fail("expected Param, got %s", typeName(j))
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func (d *jsonDecoder) annotation(j *jsonType) Type {
+	t, err := typeFromJSON(j)
+	if err != nil {
+		d.fail("%v", err)
+	}
+	return t
+}
+
+func typeName(j *jsonNode) string {
+	if j == nil {
+		return "null"
+	}
+	return strconv.Quote(j.Type)
+}
+
+func (d *jsonDecoder) node(j *jsonNode) Node {
+	if j == nil {
+		return nil
+	}
+	span := spanFromJSON(j.Span)
+	switch j.Type {
+	case "Module":
+		m := &Module{Name: j.Name, Body: d.stmts(j.Body), span: span}
+		for _, ji := range j.Imports {
+			imp, ok := d.node(ji).(*Import)
+			if !ok {
+				d.fail("expected Import, got %s", typeName(ji))
+			}
+			m.Imports = append(m.Imports, imp)
+		}
+		for _, jg := range j.Comments {
+			m.Comments = append(m.Comments, groupFromJSON(jg))
+		}
+		return m
+	case "Import":
+		imp := &Import{Path: j.Path, Alias: j.Alias, span: span}
+		for _, jn := range j.Names {
+			name, ok := d.node(jn).(*ImportName)
+			if !ok {
+				d.fail("expected ImportName, got %s", typeName(jn))
+			}
+			imp.Names = append(imp.Names, name)
+		}
+		return imp
+	case "ImportName":
+		return &ImportName{Name: j.Name, Alias: j.Alias, span: span}
+	case "FuncDef":
+		return &FuncDef{Doc: groupFromJSON(j.Doc), Name: j.Name, Params: d.params(j.Params), Body: d.stmts(j.Body), span: span}
+	case "Param":
+		return &Param{Name: j.Name, Type: d.annotation(j.Annotation), span: span}
+	case "VarStmt":
+		return &VarStmt{Name: j.Name, Value: d.expr(j.Value), span: span}
+	case "AssignStmt":
+		return &AssignStmt{Target: d.expr(j.Target), Value: d.expr(j.Value), span: span}
+	case "IfStmt":
+		s := &IfStmt{Cond: d.expr(j.Cond), Then: d.stmts(j.Then), Else: d.stmts(j.Else), span: span}
+		for _, je := range j.Elifs {
+			elif, ok := d.node(je).(*Elif)
+			if !ok {
+				d.fail("expected Elif, got %s", typeName(je))
+			}
+			s.Elifs = append(s.Elifs, elif)
+		}
+		return s
+	case "Elif":
+		return &Elif{Cond: d.expr(j.Cond), Body: d.stmts(j.Body), span: span}
+	case "WhileStmt":
+		return &WhileStmt{Cond: d.expr(j.Cond), Body: d.stmts(j.Body), span: span}
+	case "ForStmt":
+		return &ForStmt{Var: j.Var, Iter: d.expr(j.Iter), Body: d.stmts(j.Body), span: span}
+	case "ReturnStmt":
+		return &ReturnStmt{Value: d.expr(j.Value), span: span}
+	case "AssertStmt":
+		return &AssertStmt{Test: d.expr(j.Cond), Msg: d.expr(j.Value), span: span}
+	case "TryStmt":
+		s := &TryStmt{Body: d.stmts(j.Body), Finally: d.stmts(j.Finally), span: span}
+		for _, je := range j.Excepts {
+			exc, ok := d.node(je).(*Except)
+			if !ok {
+				d.fail("expected Except, got %s", typeName(je))
+			}
+			s.Excepts = append(s.Excepts, exc)
+		}
+		return s
+	case "Except":
+		return &Except{Type: d.annotation(j.Annotation), Var: j.Var, Body: d.stmts(j.Body), span: span}
+	case "ExprStmt":
+		return &ExprStmt{Expr: d.expr(j.Expr), span: span}
+	case "BadStmt":
+		return &BadStmt{span: span}
+	case "Literal":
+		v, err := literalFromJSON(j.Literal, j.Kind)
+		if err != nil {
+			d.fail("literal: %v", err)
+		}
+		return &Literal{Value: v, span: span}
+	case "Name":
+		return &Name{Ident: j.Ident, span: span}
+	case "Call":
+		return &Call{Func: d.expr(j.Func), Args: d.exprs(j.Args), span: span}
+	case "Index":
+		return &Index{Target: d.expr(j.Target), Index: d.expr(j.Index), span: span}
+	case "Attr":
+		return &Attr{Target: d.expr(j.Target), Attr: j.Attr, span: span}
+	case "UnaryOp":
+		return &UnaryOp{Op: j.Op, Right: d.expr(j.Right), span: span}
+	case "BinaryOp":
+		return &BinaryOp{Op: j.Op, Left: d.expr(j.Left), Right: d.expr(j.Right), span: span}
+	case "DictLit":
+		return &DictLit{Keys: d.exprs(j.Keys), Vals: d.exprs(j.Vals), span: span}
+	case "ListLit":
+		return &ListLit{Elems: d.exprs(j.Elems), span: span}
+	case "Lambda":
+		return &Lambda{Params: d.params(j.Params), Body: d.expr(j.LambdaBody), span: span}
+	case "BadExpr":
+		return &BadExpr{span: span}
+	default:
+		d.fail("unknown node type %q", j.Type)
+		return nil
+	}
+}
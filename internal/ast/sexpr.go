@@ -0,0 +1,301 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rayo/internal/diag"
+)
+
+// Sexpr renders the tree rooted at n as an indented S-expression, one node
+// per line:
+//
+//	(Module
+//	  (VarStmt x @1:1-1:10
+//	    (Literal 42 @1:9-1:10)))
+//
+// Each node lists its kind, its scalar fields and, when known, its span as
+// @line:col-line:col, followed by its children. Lists of child statements
+// other than a node's main body are grouped under a label, e.g. (else ...).
+// This is the format of .ast golden files.
+func Sexpr(n Node) string {
+	p := &sexprPrinter{}
+	p.node(n)
+	p.sb.WriteByte('\n')
+	return p.sb.String()
+}
+
+type sexprPrinter struct {
+	sb    strings.Builder
+	depth int
+}
+
+func (p *sexprPrinter) open(kind string, span diag.Span, attrs ...string) {
+	if p.sb.Len() > 0 {
+		p.sb.WriteByte('\n')
+	}
+	p.sb.WriteString(strings.Repeat("  ", p.depth))
+	p.sb.WriteByte('(')
+	p.sb.WriteString(kind)
+	for _, a := range attrs {
+		if a != "" {
+			p.sb.WriteByte(' ')
+			p.sb.WriteString(a)
+		}
+	}
+	if span != (diag.Span{}) {
+		fmt.Fprintf(&p.sb, " @%d:%d-%d:%d", span.Start.Line, span.Start.Col, span.End.Line, span.End.Col)
+	}
+	p.depth++
+}
+
+func (p *sexprPrinter) close() {
+	p.depth--
+	p.sb.WriteByte(')')
+}
+
+// group prints stmts under a label, or nothing when there are none.
+func (p *sexprPrinter) group(label string, stmts []Stmt) {
+	if len(stmts) == 0 {
+		return
+	}
+	p.open(label, diag.Span{})
+	p.stmts(stmts)
+	p.close()
+}
+
+func (p *sexprPrinter) stmts(stmts []Stmt) {
+	for _, s := range stmts {
+		p.node(s)
+	}
+}
+
+func (p *sexprPrinter) exprs(exprs []Expr) {
+	for _, e := range exprs {
+		p.node(e)
+	}
+}
+
+// label renders an optional labelled attribute such as as=e.
+func label(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	return name + "=" + value
+}
+
+func (p *sexprPrinter) node(n Node) {
+	switch x := n.(type) {
+	case nil:
+		p.nilNode()
+	case *Module:
+		p.open("Module", x.span, quoteNonEmpty(x.Name))
+		for _, imp := range x.Imports {
+			p.node(imp)
+		}
+		p.stmts(x.Body)
+		p.close()
+	case *Import:
+		p.open("Import", x.span, strconv.Quote(x.Path), label("as", x.Alias))
+		for _, name := range x.Names {
+			p.node(name)
+		}
+		p.close()
+	case *ImportName:
+		p.open("ImportName", x.span, x.Name, label("as", x.Alias))
+		p.close()
+	case *FuncDef:
+		p.open("FuncDef", x.span, x.Name)
+		for _, param := range x.Params {
+			p.node(param)
+		}
+		p.stmts(x.Body)
+		p.close()
+	case *Param:
+		p.open("Param", x.span, x.Name, label("type", TypeString(x.Type)))
+		p.close()
+	case *VarStmt:
+		p.open("VarStmt", x.span, x.Name)
+		p.node(x.Value)
+		p.close()
+	case *AssignStmt:
+		p.open("AssignStmt", x.span)
+		p.node(x.Target)
+		p.node(x.Value)
+		p.close()
+	case *IfStmt:
+		p.open("IfStmt", x.span)
+		p.node(x.Cond)
+		p.group("then", x.Then)
+		for _, elif := range x.Elifs {
+			p.node(elif)
+		}
+		p.group("else", x.Else)
+		p.close()
+	case *Elif:
+		p.open("Elif", x.span)
+		p.node(x.Cond)
+		p.stmts(x.Body)
+		p.close()
+	case *WhileStmt:
+		p.open("WhileStmt", x.span)
+		p.node(x.Cond)
+		p.stmts(x.Body)
+		p.close()
+	case *ForStmt:
+		p.open("ForStmt", x.span, x.Var)
+		p.node(x.Iter)
+		p.stmts(x.Body)
+		p.close()
+	case *ReturnStmt:
+		p.open("ReturnStmt", x.span)
+		if x.Value != nil {
+			p.node(x.Value)
+		}
+		p.close()
+	case *AssertStmt:
+		p.open("AssertStmt", x.span)
+		p.node(x.Test)
+		if x.Msg != nil {
+			p.node(x.Msg)
+		}
+		p.close()
+	case *TryStmt:
+		p.open("TryStmt", x.span)
+		p.group("body", x.Body)
+		for _, exc := range x.Excepts {
+			p.node(exc)
+		}
+		p.group("finally", x.Finally)
+		p.close()
+	case *Except:
+		p.open("Except", x.span, label("type", TypeString(x.Type)), label("as", x.Var))
+		p.stmts(x.Body)
+		p.close()
+	case *ExprStmt:
+		p.open("ExprStmt", x.span)
+		p.node(x.Expr)
+		p.close()
+	case *BadStmt:
+		p.open("BadStmt", x.span)
+		p.close()
+	case *Literal:
+		p.open("Literal", x.span, LiteralString(x.Value))
+		p.close()
+	case *Name:
+		p.open("Name", x.span, x.Ident)
+		p.close()
+	case *Call:
+		p.open("Call", x.span)
+		p.node(x.Func)
+		p.exprs(x.Args)
+		p.close()
+	case *Index:
+		p.open("Index", x.span)
+		p.node(x.Target)
+		p.node(x.Index)
+		p.close()
+	case *Attr:
+		p.open("Attr", x.span, x.Attr)
+		p.node(x.Target)
+		p.close()
+	case *UnaryOp:
+		p.open("UnaryOp", x.span, strconv.Quote(x.Op))
+		p.node(x.Right)
+		p.close()
+	case *BinaryOp:
+		p.open("BinaryOp", x.span, strconv.Quote(x.Op))
+		p.node(x.Left)
+		p.node(x.Right)
+		p.close()
+	case *DictLit:
+		p.open("DictLit", x.span)
+		for i := range x.Keys {
+			p.open("entry", diag.Span{})
+			p.node(x.Keys[i])
+			if i < len(x.Vals) {
+				p.node(x.Vals[i])
+			}
+			p.close()
+		}
+		p.close()
+	case *ListLit:
+		p.open("ListLit", x.span)
+		p.exprs(x.Elems)
+		p.close()
+	case *Lambda:
+		p.open("Lambda", x.span)
+		for _, param := range x.Params {
+			p.node(param)
+		}
+		p.node(x.Body)
+		p.close()
+	case *BadExpr:
+		p.open("BadExpr", x.span)
+		p.close()
+	default:
+		p.open(fmt.Sprintf("%T", n), n.Span())
+		p.close()
+	}
+}
+
+// nilNode prints a missing child, e.g. the operand the parser could not
+// read after a syntax error. Typed nil pointers end up here too.
+func (p *sexprPrinter) nilNode() {
+	if p.sb.Len() > 0 {
+		p.sb.WriteByte('\n')
+	}
+	p.sb.WriteString(strings.Repeat("  ", p.depth))
+	p.sb.WriteString("nil")
+}
+
+func quoteNonEmpty(s string) string {
+	if s == "" {
+		return ""
+	}
+	return strconv.Quote(s)
+}
+
+// LiteralString renders a literal value the way it is written in Rayo
+// source, except that strings are Go-quoted.
+func LiteralString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// TypeString renders a type annotation, e.g. int? for an optional int. It
+// returns "" for a missing annotation.
+func TypeString(t Type) string {
+	switch t := t.(type) {
+	case nil:
+		return ""
+	case Any, *Any:
+		return "any"
+	case Optional:
+		return TypeString(t.Elem) + "?"
+	case *Optional:
+		return TypeString(t.Elem) + "?"
+	case string:
+		return t
+	default:
+		return fmt.Sprint(t)
+	}
+}
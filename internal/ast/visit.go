@@ -1,5 +1,7 @@
 package ast
 
+import "rayo/internal/diag"
+
 // Visitor interface for AST traversal.
 type Visitor interface {
     Visit(Node) bool // return false to skip children
@@ -19,6 +21,10 @@ func Walk(v Visitor, n Node) {
             Walk(v, stmt)
         }
     case *Import:
+        for _, name := range x.Names {
+            Walk(v, name)
+        }
+    case *ImportName:
         // no children
     case *FuncDef:
         for _, p := range x.Params {
@@ -64,6 +70,9 @@ func Walk(v Visitor, n Node) {
             }
         case *ReturnStmt:
             Walk(v, s.Value)
+        case *AssertStmt:
+            Walk(v, s.Test)
+            Walk(v, s.Msg)
         case *TryStmt:
             for _, stmt := range s.Body {
                 Walk(v, stmt)
@@ -80,6 +89,8 @@ func Walk(v Visitor, n Node) {
             }
         case *ExprStmt:
             Walk(v, s.Expr)
+        case *BadStmt:
+            // no children
         }
     case Expr:
         switch e := x.(type) {
@@ -116,6 +127,21 @@ func Walk(v Visitor, n Node) {
                 Walk(v, p)
             }
             Walk(v, e.Body)
+        case *BadExpr:
+            // no children
         }
     }
 }
+
+// ClearSpans zeroes the span of every node in the tree rooted at n, for
+// comparing trees parsed from differently laid out source.
+func ClearSpans(n Node) {
+    Walk(clearSpans{}, n)
+}
+
+type clearSpans struct{}
+
+func (clearSpans) Visit(n Node) bool {
+    n.SetSpan(diag.Span{})
+    return true
+}
@@ -0,0 +1,311 @@
+// Package build loads multi-module Rayo programs and lays them out as a Go
+// module, one Go package per Rayo module.
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+	"rayo/internal/parse"
+	"rayo/internal/sem"
+)
+
+// DefaultModulePath is the Go module path of generated programs.
+const DefaultModulePath = "rayoapp"
+
+// Module is one parsed .ryo source file of a program.
+type Module struct {
+	File    string // absolute path of the source file
+	Source  string
+	Dir     string // slash-separated package directory in the generated module; "" for the entry module
+	Package string // Go package name
+	AST     *ast.Module
+	// Deps holds the Rayo module bound to each Rayo import of AST, keyed
+	// by import path as written in the source.
+	Deps map[string]*Module
+	defs map[string]bool
+}
+
+// Diagnostic codes of the errors in loading and binding the modules of a
+// program. docs/diagnostics.md describes each of them.
+const (
+	CodeModuleNotFound = "E0401" // Rayo import of a module that does not exist
+	CodeImportCycle    = "E0402" // modules importing each other
+	CodeModuleClash    = "E0403" // two modules generated into one Go package
+	CodeUndefinedName  = "E0404" // m.name or from-import of a name module m does not define
+	CodeRedeclared     = "E0405" // a name bound twice in a module's namespace
+)
+
+// Program is an entry module together with every Rayo module it imports.
+type Program struct {
+	Root        string   // directory containing the entry module
+	ProjectRoot string   // directory holding the project manifest, if any
+	SearchPath  []string // directories searched for non-relative imports
+	Entry       *Module
+	Modules     []*Module // dependency order; the entry module is last
+	// StripAsserts leaves the checks of assert statements out of the
+	// generated code.
+	StripAsserts bool
+}
+
+// ManifestFile is the name of the project manifest that marks a project root.
+const ManifestFile = "rayo.toml"
+
+// Options configures how a program is loaded.
+type Options struct {
+	// IncludePaths are searched, in order, for non-relative Rayo imports
+	// before the RAYOPATH entries and the project root.
+	IncludePaths []string
+	// RayoPath overrides the RAYOPATH environment variable when non-nil.
+	RayoPath []string
+}
+
+// Load parses the entry file and, recursively, every Rayo module it imports.
+// Imports starting with ./ or ../ are resolved against the importing file;
+// other Rayo imports are looked up in the include paths, the RAYOPATH
+// entries and finally the project root. Import cycles are reported as errors.
+func Load(entry string, opts Options) (*Program, error) {
+	abs, err := filepath.Abs(entry)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Dir(abs)
+	prog := &Program{Root: root, ProjectRoot: FindProjectRoot(root)}
+	rayoPath := opts.RayoPath
+	if rayoPath == nil {
+		rayoPath = filepath.SplitList(os.Getenv("RAYOPATH"))
+	}
+	for _, dir := range append(append([]string{}, opts.IncludePaths...), rayoPath...) {
+		if dir == "" {
+			continue
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+		prog.SearchPath = append(prog.SearchPath, dir)
+	}
+	if prog.ProjectRoot != "" {
+		prog.SearchPath = append(prog.SearchPath, prog.ProjectRoot)
+	}
+	l := &loader{
+		prog:  prog,
+		state: map[string]int{},
+		mods:  map[string]*Module{},
+		dirs:  map[string]string{},
+	}
+	l.dirs[l.packageDir(abs)] = abs
+	mod, err := l.load(abs, "")
+	if err != nil {
+		return nil, err
+	}
+	mod.Dir = ""
+	mod.Package = "main"
+	l.prog.Entry = mod
+	return l.prog, nil
+}
+
+const (
+	loading = iota + 1
+	loaded
+)
+
+type loader struct {
+	prog  *Program
+	state map[string]int
+	mods  map[string]*Module
+	dirs  map[string]string // package directory -> source file
+	stack []string
+}
+
+// FindProjectRoot returns the nearest directory at or above dir containing
+// a project manifest, or "" if there is none.
+func FindProjectRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ManifestFile)); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// resolve locates the source file of a Rayo import made from the module in
+// file. For imports found on the search path it also returns the package
+// directory the module is generated into, under _rayopath/, which cannot
+// hold a module of the program's own tree. When there is no such module
+// the returned file is empty, and the notes say where it was looked for.
+func (l *loader) resolve(file, importPath string) (string, string, []string) {
+	if strings.HasPrefix(importPath, "./") || strings.HasPrefix(importPath, "../") || filepath.IsAbs(importPath) {
+		candidate := filepath.Join(filepath.Dir(file), filepath.FromSlash(importPath))
+		if info, err := os.Stat(candidate); err != nil || info.IsDir() {
+			return "", "", []string{"no such file: " + l.displayName(candidate)}
+		}
+		return candidate, "", nil
+	}
+	var searched []string
+	for _, dir := range l.prog.SearchPath {
+		candidate := filepath.Join(dir, filepath.FromSlash(importPath))
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, "_rayopath/" + strings.TrimSuffix(path.Clean(importPath), ".ryo"), nil
+		}
+		searched = append(searched, dir)
+	}
+	if len(searched) == 0 {
+		return "", "", []string{fmt.Sprintf("there are no include paths, RAYOPATH or %s project root to search", ManifestFile)}
+	}
+	return "", "", []string{"searched:\n\t" + strings.Join(searched, "\n\t")}
+}
+
+func (l *loader) load(file, dir string) (*Module, error) {
+	if l.state[file] == loaded {
+		return l.mods[file], nil
+	}
+	l.state[file] = loading
+	l.stack = append(l.stack, file)
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", file, err)
+	}
+	parser := parse.NewParser(string(source))
+	tree := parser.ParseModule()
+	if errs := parser.Errors(); len(errs) > 0 {
+		serr := &diag.SourceError{File: l.displayName(file), Source: string(source)}
+		for _, err := range errs {
+			if pe, ok := err.(*parse.ParseError); ok {
+				serr.Diagnostics = append(serr.Diagnostics, pe.Diagnostic())
+			} else {
+				serr.Diagnostics = append(serr.Diagnostics, diag.Diagnostic{Severity: diag.Error, Code: parse.CodeSyntax, Msg: err.Error()})
+			}
+		}
+		return nil, serr
+	}
+
+	mod := &Module{File: file, Source: string(source), AST: tree, Deps: map[string]*Module{}, defs: topLevelDefs(tree)}
+	mod.Dir = dir
+	if mod.Dir == "" {
+		mod.Dir = l.packageDir(file)
+	}
+	mod.Package = packageName(mod.Dir)
+	for _, imp := range tree.Imports {
+		if !sem.IsRayoImport(imp.Path) {
+			continue
+		}
+		depFile, depDir, notes := l.resolve(file, imp.Path)
+		if depFile == "" {
+			return nil, l.importError(mod, imp, CodeModuleNotFound, fmt.Sprintf("module not found: %q", imp.Path), notes...)
+		}
+		if l.state[depFile] == loading {
+			return nil, l.importError(mod, imp, CodeImportCycle, "import cycle: "+l.cycle(depFile))
+		}
+		if l.state[depFile] != loaded {
+			if depDir == "" {
+				depDir = l.packageDir(depFile)
+			}
+			if other, ok := l.dirs[depDir]; ok {
+				msg := fmt.Sprintf("%s and %s would both be generated into package %s", l.displayName(other), l.displayName(depFile), depDir)
+				return nil, l.importError(mod, imp, CodeModuleClash, msg)
+			}
+			l.dirs[depDir] = depFile
+		}
+		dep, err := l.load(depFile, depDir)
+		if err != nil {
+			return nil, err
+		}
+		mod.Deps[imp.Path] = dep
+	}
+
+	l.stack = l.stack[:len(l.stack)-1]
+	l.state[file] = loaded
+	l.mods[file] = mod
+	l.prog.Modules = append(l.prog.Modules, mod)
+	return mod, nil
+}
+
+// importError reports a failed import of m as an error at the import.
+func (l *loader) importError(m *Module, imp *ast.Import, code, msg string, notes ...string) error {
+	return &diag.SourceError{File: l.displayName(m.File), Source: m.Source, Diagnostics: []diag.Diagnostic{{
+		Severity: diag.Error,
+		Code:     code,
+		Span:     imp.Span(),
+		Msg:      msg,
+		Notes:    notes,
+	}}}
+}
+
+// cycle describes the chain of imports from file, which is being loaded,
+// back to itself.
+func (l *loader) cycle(file string) string {
+	start := 0
+	for i, f := range l.stack {
+		if f == file {
+			start = i
+		}
+	}
+	var names []string
+	for _, f := range append(l.stack[start:], file) {
+		names = append(names, l.displayName(f))
+	}
+	return strings.Join(names, " -> ")
+}
+
+func (l *loader) displayName(file string) string {
+	return l.prog.DisplayName(file)
+}
+
+// DisplayName returns file relative to the program root, the form used in
+// error messages.
+func (p *Program) DisplayName(file string) string {
+	if rel, err := filepath.Rel(p.Root, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+// packageDir maps a source file to its package directory in the generated
+// module, e.g. lib/utils.ryo -> lib/utils. Each ../ becomes _up/, which no
+// module found by walking the sources can be in, as directories starting
+// with _ are skipped.
+func (l *loader) packageDir(file string) string {
+	rel := strings.TrimSuffix(l.displayName(file), ".ryo")
+	rel = strings.ReplaceAll(rel, "../", "_up/")
+	return strings.TrimPrefix(rel, "/")
+}
+
+// packageName derives a valid Go package name from a package directory.
+func packageName(dir string) string {
+	base := dir[strings.LastIndexByte(dir, '/')+1:]
+	var sb strings.Builder
+	for _, r := range strings.ToLower(base) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			sb.WriteRune(r)
+		}
+	}
+	name := sb.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) || name == "main" {
+		name = "m" + name
+	}
+	return name
+}
+
+func topLevelDefs(mod *ast.Module) map[string]bool {
+	defs := map[string]bool{}
+	for _, stmt := range mod.Body {
+		switch s := stmt.(type) {
+		case *ast.FuncDef:
+			defs[s.Name] = true
+		case *ast.VarStmt:
+			defs[s.Name] = true
+		}
+	}
+	return defs
+}
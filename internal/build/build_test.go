@@ -0,0 +1,275 @@
+package build
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rayo/internal/diag"
+	"rayo/internal/sem"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadAndGenerateModules(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ryo":      "import \"./lib/utils.ryo\" as u\nfrom \"./shapes.ryo\" import area, helper as shape_helper\ndef main() {\n    u.helper()\n    print(area())\n    shape_helper()\n    helper()\n}\ndef helper() {\n}\n",
+		"lib/utils.ryo": "def helper() {\n    print(\"utils\")\n}\n",
+		"shapes.ryo":    "import \"./lib/utils.ryo\"\ndef area() {\n    utils.helper()\n    return 42\n}\ndef helper() {\n}\n",
+		"unused/x.ryo":  "def x() {\n}\n",
+	})
+	prog, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var order []string
+	for _, m := range prog.Modules {
+		order = append(order, m.Dir)
+	}
+	if got := strings.Join(order, ","); got != "lib/utils,shapes," {
+		t.Errorf("modules loaded in order %q", got)
+	}
+	files, err := prog.Generate("example.com/app", sem.NewGoImporter(dir))
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	checks := map[string][]string{
+		"main.go":            {"package main\n", "import u \"example.com/app/lib/utils\"\n", "import shapes \"example.com/app/shapes\"\n", "u.Helper()\n", "rayoPrint(shapes.Area())\n", "shapes.Helper()\n", "\nhelper()\n", "func helper() {\n"},
+		"lib/utils/utils.go": {"package utils\n", "func Helper() {\n"},
+		"shapes/shapes.go":   {"package shapes\n", "import utils \"example.com/app/lib/utils\"\n", "func Area() any {\n", "utils.Helper()\n", "func Helper() {\n"},
+	}
+	if len(files) != len(checks) {
+		t.Errorf("generated %d files, want %d", len(files), len(checks))
+	}
+	for name, wants := range checks {
+		code, ok := files[name]
+		if !ok {
+			t.Errorf("missing generated file %s", name)
+			continue
+		}
+		for _, want := range wants {
+			if !strings.Contains(code, want) {
+				t.Errorf("%s: missing %q in:\n%s", name, want, code)
+			}
+		}
+	}
+}
+
+func TestLoadPackageDirs(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app/main.ryo":   "import \"../lib.ryo\"\nimport \"./up/lib.ryo\" as local\ndef main() {\n}\n",
+		"app/up/lib.ryo": "def f() {\n}\n",
+		"lib.ryo":        "def g() {\n}\n",
+	})
+	prog, err := Load(filepath.Join(dir, "app/main.ryo"), Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var dirs []string
+	for _, m := range prog.Modules {
+		dirs = append(dirs, m.Dir)
+	}
+	if got := strings.Join(dirs, ","); got != "_up/lib,up/lib," {
+		t.Errorf("package directories %q", got)
+	}
+
+	dir = writeFiles(t, map[string]string{
+		"app/main.ryo":    "import \"../lib.ryo\"\nimport \"./_up/lib.ryo\" as local\ndef main() {\n}\n",
+		"app/_up/lib.ryo": "def f() {\n}\n",
+		"lib.ryo":         "def g() {\n}\n",
+	})
+	_, err = Load(filepath.Join(dir, "app/main.ryo"), Options{})
+	if want := "main.ryo:2:1: error[E0403]: ../lib.ryo and _up/lib.ryo would both be generated into package _up/lib"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+func TestLoadImportCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ryo": "import \"./a.ryo\"\n",
+		"a.ryo":    "import \"./b.ryo\"\n",
+		"b.ryo":    "import \"./a.ryo\"\n",
+	})
+	_, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+	if err == nil || err.Error() != "b.ryo:1:1: error[E0402]: import cycle: a.ryo -> b.ryo -> a.ryo" {
+		t.Fatalf("expected import cycle error, got %v", err)
+	}
+}
+
+func TestGenerateUndefinedReferences(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ryo": "import \"./a.ryo\" as m\nfrom \"./a.ryo\" import missing\ndef main() {\n    m.nope()\n}\n",
+		"a.ryo":    "def f() {\n}\n",
+	})
+	prog, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	_, err = prog.Generate(DefaultModulePath, sem.NewGoImporter(dir))
+	if err == nil {
+		t.Fatal("expected errors for undefined module members")
+	}
+	for _, want := range []string{"error[E0404]: undefined: m.nope", "error[E0404]: cannot import missing: ./a.ryo does not define it"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadSearchPath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"proj/rayo.toml":           "",
+		"proj/app/main.ryo":        "import \"inc.ryo\"\nimport \"env/mod.ryo\"\nimport \"shared/root.ryo\"\nimport \"both.ryo\"\ndef main() {\n}\n",
+		"proj/shared/root.ryo":     "def r() {\n}\n",
+		"proj/both.ryo":            "def shadowed() {\n}\n",
+		"include/inc.ryo":          "def i() {\n}\n",
+		"include/both.ryo":         "def b() {\n}\n",
+		"rayopath/env/mod.ryo":     "def e() {\n}\n",
+		"rayopath/shared/root.ryo": "def shadowed() {\n}\n",
+	})
+	prog, err := Load(filepath.Join(dir, "proj/app/main.ryo"), Options{
+		IncludePaths: []string{filepath.Join(dir, "include")},
+		RayoPath:     []string{filepath.Join(dir, "missing"), filepath.Join(dir, "rayopath")},
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if prog.ProjectRoot != filepath.Join(dir, "proj") {
+		t.Errorf("project root = %q", prog.ProjectRoot)
+	}
+	want := map[string]string{
+		"inc.ryo":         filepath.Join(dir, "include/inc.ryo"),
+		"env/mod.ryo":     filepath.Join(dir, "rayopath/env/mod.ryo"),
+		"shared/root.ryo": filepath.Join(dir, "rayopath/shared/root.ryo"),
+		"both.ryo":        filepath.Join(dir, "include/both.ryo"),
+	}
+	for path, file := range want {
+		dep := prog.Entry.Deps[path]
+		if dep == nil || dep.File != file {
+			t.Errorf("%s resolved to %+v, want %s", path, dep, file)
+		}
+	}
+	if dep := prog.Entry.Deps["env/mod.ryo"]; dep != nil && dep.Dir != "_rayopath/env/mod" {
+		t.Errorf("env/mod.ryo generated into %q", dep.Dir)
+	}
+}
+
+// writeProxy lays out a module proxy serving each module, given as its
+// files, at version v1.0.0, for use as a file:// GOPROXY.
+func writeProxy(t *testing.T, modules map[string]map[string]string) string {
+	t.Helper()
+	proxy := t.TempDir()
+	for path, files := range modules {
+		dir := filepath.Join(proxy, filepath.FromSlash(path), "@v")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(filepath.Join(dir, "v1.0.0.zip"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for name, content := range files {
+			w, err := zw.Create(path + "@v1.0.0/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(content))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		for name, content := range map[string]string{
+			"list":        "v1.0.0\n",
+			"v1.0.0.info": `{"Version":"v1.0.0"}`,
+			"v1.0.0.mod":  files["go.mod"],
+		} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return proxy
+}
+
+func TestEmitDependencies(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	// greet depends on words, which the program does not require itself
+	proxy := writeProxy(t, map[string]map[string]string{
+		"example.com/greet": {
+			"go.mod":   "module example.com/greet\n\ngo 1.22\n\nrequire example.com/words v1.0.0\n",
+			"greet.go": "package greet\n\nimport \"example.com/words\"\n\nfunc Hello() string { return words.Hello }\n",
+		},
+		"example.com/words": {
+			"go.mod":   "module example.com/words\n\ngo 1.22\n",
+			"words.go": "package words\n\nconst Hello = \"hello\"\n",
+		},
+	})
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "-mod=readonly -modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOWORK", "off")
+
+	dir := writeFiles(t, map[string]string{
+		"main.ryo": "import \"example.com/greet\"\ndef main() {\n    print(greet.Hello())\n}\n",
+	})
+	prog, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := prog.Emit(out, GoModule{Require: map[string]string{"example.com/greet": "v1.0.0"}}); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = out
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, msg)
+	}
+}
+
+func TestLoadModuleNotFound(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"rayo.toml": "",
+		"main.ryo":  "import \"nowhere.ryo\"\n",
+	})
+	_, err := Load(filepath.Join(dir, "main.ryo"), Options{IncludePaths: []string{"/no/such/dir"}, RayoPath: []string{}})
+	var serr *diag.SourceError
+	if !errors.As(err, &serr) || len(serr.Diagnostics) != 1 {
+		t.Fatalf("got error %v, want a diagnostic", err)
+	}
+	d := serr.Diagnostics[0]
+	if got := d.Format(serr.File); got != "main.ryo:1:1: error[E0401]: module not found: \"nowhere.ryo\"" {
+		t.Errorf("got %s", got)
+	}
+	if want := "searched:\n\t/no/such/dir\n\t" + dir; len(d.Notes) != 1 || d.Notes[0] != want {
+		t.Errorf("notes %q, want %q", d.Notes, want)
+	}
+
+	dir = writeFiles(t, map[string]string{"main.ryo": "import \"os\"\nimport \"./lib/missing.ryo\"\n"})
+	_, err = Load(filepath.Join(dir, "main.ryo"), Options{})
+	if want := "main.ryo:2:1: error[E0401]: module not found: \"./lib/missing.ryo\""; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
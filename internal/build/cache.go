@@ -0,0 +1,190 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// keepBuilds is the number of builds of a program kept in its run cache,
+// most recently used first.
+const keepBuilds = 3
+
+// stagePrefix starts the names of the directories builds are made in
+// before they are moved into place. Stale ones are left by interrupted
+// builds.
+const stagePrefix = ".stage-"
+
+// CacheDir returns the directory under the user cache directory where the
+// builds of kind, such as "run" or "test", of the program with entry module
+// entry are kept.
+func CacheDir(kind, entry string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(entry)
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs))
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cache, "rayo", kind, fmt.Sprintf("%s-%x", name, sum[:6])), nil
+}
+
+// CachedBinary returns the path of a binary built from the Go module
+// generated for p, with the go.mod settings mod, and the extra files, keyed
+// by slash-separated path, added to it. Builds are kept in
+// cacheDir keyed by a hash of the generated code, the checksums of its
+// dependencies and the sources of the Rayo runtime it uses, so a program
+// that has not changed since its last run is not compiled again. Otherwise
+// compile builds the binary in the generated module's directory.
+//
+// A build is made in a staging directory and renamed into place once
+// complete, so concurrent runs never see a partial build and a failed one
+// leaves nothing behind. Only the most recently used builds are kept.
+func (p *Program) CachedBinary(cacheDir string, mod GoModule, extra map[string]string, compile func(dir, binary string) error) (string, error) {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+	stage, err := os.MkdirTemp(cacheDir, stagePrefix)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(stage)
+	files, mod, err := p.emitModule(stage, mod)
+	if err != nil {
+		return "", err
+	}
+	for name, code := range extra {
+		files[name] = code
+	}
+	key, err := buildKey(stage, files, mod)
+	if err != nil {
+		return "", err
+	}
+	exe := "main"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	final := filepath.Join(cacheDir, key)
+	binary := filepath.Join(final, exe)
+	if _, err := os.Stat(binary); err == nil {
+		now := time.Now()
+		os.Chtimes(final, now, now)
+		return binary, nil
+	}
+
+	if err := writeGoFiles(stage, files); err != nil {
+		return "", err
+	}
+	if err := compile(stage, filepath.Join(stage, exe)); err != nil {
+		return "", err
+	}
+	if err := os.Rename(stage, final); err != nil {
+		// A concurrent run may have finished the same build first.
+		if _, serr := os.Stat(binary); serr != nil {
+			return "", err
+		}
+	}
+	pruneBuilds(cacheDir, key)
+	return binary, nil
+}
+
+// buildKey hashes what a build of the generated files depends on.
+func buildKey(dir string, files map[string]string, mod GoModule) (string, error) {
+	h := sha256.New()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%d\x00%s", name, len(files[name]), files[name])
+	}
+	// go.mod and, with requirements, go.sum
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%s", name, len(data), data)
+	}
+	if mod.RuntimeRoot != "" {
+		if err := hashGoTree(h, mod.RuntimeRoot); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:24], nil
+}
+
+// hashGoTree writes the paths and contents of the Go sources of the module
+// rooted at root to h, skipping tests and the directories the go command
+// ignores.
+func hashGoTree(h io.Writer, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !(strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") || name == "go.mod" || name == "go.sum") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		fmt.Fprintf(h, "%s\x00%d\x00%s", filepath.ToSlash(rel), len(data), data)
+		return nil
+	})
+}
+
+// pruneBuilds removes all but the keepBuilds most recently used builds in
+// cacheDir, never current, and staging directories abandoned for a day.
+func pruneBuilds(cacheDir, current string) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return
+	}
+	type build struct {
+		name string
+		used time.Time
+	}
+	var builds []build
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), stagePrefix) {
+			if time.Since(info.ModTime()) > 24*time.Hour {
+				os.RemoveAll(filepath.Join(cacheDir, e.Name()))
+			}
+			continue
+		}
+		if e.Name() != current {
+			builds = append(builds, build{e.Name(), info.ModTime()})
+		}
+	}
+	sort.Slice(builds, func(i, j int) bool { return builds[i].used.After(builds[j].used) })
+	for i, b := range builds {
+		if i >= keepBuilds-1 {
+			os.RemoveAll(filepath.Join(cacheDir, b.name))
+		}
+	}
+}
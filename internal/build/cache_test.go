@@ -0,0 +1,75 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCachedBinary(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ryo": "def main() {\n    print(\"v0\")\n}\n",
+	})
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	builds := 0
+	compile := func(dir, binary string) error {
+		builds++
+		if _, err := os.Stat(filepath.Join(dir, "main.go")); err != nil {
+			t.Errorf("compiling before the module is generated: %v", err)
+		}
+		return os.WriteFile(binary, []byte("binary"), 0755)
+	}
+	run := func(src string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "main.ryo"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		prog, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		binary, err := prog.CachedBinary(cacheDir, GoModule{}, nil, compile)
+		if err != nil {
+			t.Fatalf("CachedBinary: %v", err)
+		}
+		return binary
+	}
+
+	first := run("def main() {\n    print(\"v0\")\n}\n")
+	if again := run("def main() {\n    print(\"v0\")\n}\n"); again != first || builds != 1 {
+		t.Errorf("unchanged program rebuilt: %d builds, binaries %s and %s", builds, first, again)
+	}
+	if changed := run("def main() {\n    print(\"v1\")\n}\n"); changed == first || builds != 2 {
+		t.Errorf("changed program not rebuilt: %d builds", builds)
+	}
+	for i := 2; i < 6; i++ {
+		run("def main() {\n    print(\"v" + string(rune('0'+i)) + "\")\n}\n")
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != keepBuilds {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("cache holds %v, want %d builds and no staging directories", names, keepBuilds)
+	}
+}
+
+func TestCachedBinaryFailedBuild(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"main.ryo": "def main() {\n}\n"})
+	prog, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	cacheDir := t.TempDir()
+	_, err = prog.CachedBinary(cacheDir, GoModule{}, nil, func(string, string) error { return os.ErrInvalid })
+	if err != os.ErrInvalid {
+		t.Errorf("got error %v", err)
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("failed build left %d entries in the cache", len(entries))
+	}
+}
@@ -0,0 +1,376 @@
+package build
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+	"rayo/internal/gen"
+	"rayo/internal/sem"
+)
+
+// RuntimeModule is the Go module path of the Rayo runtime and stdlib.
+const RuntimeModule = "rayo"
+
+// GoFile returns the path of the module's generated Go file relative to the
+// generated module root.
+func (m *Module) GoFile() string {
+	if m.Dir == "" {
+		return "main.go"
+	}
+	return m.Dir + "/" + m.Package + ".go"
+}
+
+// Generate transpiles every module of p to Go. The result maps each
+// generated file to its contents, keyed by slash-separated path relative to
+// the root of the generated Go module whose path is modPath. The generated
+// code refers back to the absolute paths of the Rayo sources with //line
+// directives.
+func (p *Program) Generate(modPath string, gi *sem.GoImporter) (map[string]string, error) {
+	files := map[string]string{}
+	var errs []error
+	for _, m := range p.Modules {
+		rep := &diag.List{File: p.DisplayName(m.File)}
+		ctx := gen.NewGenContext(m.Package)
+		ctx.File = m.File
+		ctx.StripAsserts = p.StripAsserts
+		ctx.GoImports = sem.ResolveImports(m.AST, gi, rep)
+		ctx.Modules = map[string]string{}
+		ctx.Names = map[string]string{}
+		p.bindNames(m, modPath, ctx, rep)
+		if rep.Count(diag.Error) > 0 {
+			rep.Sort()
+			errs = append(errs, &diag.SourceError{File: rep.File, Source: m.Source, Diagnostics: rep.Diagnostics})
+			continue
+		}
+		files[m.GoFile()] = gen.EmitModule(m.AST, ctx)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return files, nil
+}
+
+// Check reports the errors that keep p from being transpiled, as Generate
+// does, without keeping the generated code.
+func (p *Program) Check(gi *sem.GoImporter) error {
+	_, err := p.Generate(DefaultModulePath, gi)
+	return err
+}
+
+// declaration records what a name in a module's namespace refers to and
+// where it was bound.
+type declaration struct {
+	what string
+	span diag.Span
+}
+
+// report reports an error with code at span.
+func report(rep diag.Reporter, code string, span diag.Span, msg string) {
+	diag.Emit(rep, diag.Diagnostic{Severity: diag.Error, Code: code, Span: span, Msg: msg})
+}
+
+// redeclared reports name being bound again at span.
+func redeclared(rep diag.Reporter, name string, span diag.Span, prev declaration, detail string) {
+	d := diag.Diagnostic{
+		Severity: diag.Error,
+		Code:     CodeRedeclared,
+		Span:     span,
+		Msg:      fmt.Sprintf("%s redeclared: %s", name, detail),
+	}
+	if prev.span != (diag.Span{}) {
+		d.Labels = []diag.Label{{Span: prev.span, Msg: "previously bound here"}}
+	}
+	diag.Emit(rep, d)
+}
+
+// bindNames fills in the generator's view of m's namespace: its own exported
+// definitions and the Rayo modules and names it imports.
+func (p *Program) bindNames(m *Module, modPath string, ctx *gen.GenContext, rep diag.Reporter) {
+	declared := map[string]declaration{}
+	for name, pkg := range ctx.GoImports.Packages {
+		declared[name] = declaration{what: "Go package " + pkg.Path}
+	}
+	for name := range ctx.GoImports.Names {
+		declared[name] = declaration{what: "name imported from Go package " + ctx.GoImports.Packages[ctx.GoImports.Names[name].Package].Path}
+	}
+	// Point redeclarations at the import that bound the Go name.
+	for _, imp := range m.AST.Imports {
+		if sem.IsRayoImport(imp.Path) {
+			continue
+		}
+		if len(imp.Names) == 0 {
+			alias := imp.Alias
+			if alias == "" {
+				alias = sem.ImportName(imp.Path)
+			}
+			if d, ok := declared[alias]; ok {
+				declared[alias] = declaration{what: d.what, span: imp.Span()}
+			}
+		}
+		for _, name := range imp.Names {
+			if d, ok := declared[name.Local()]; ok {
+				declared[name.Local()] = declaration{what: d.what, span: name.Span()}
+			}
+		}
+	}
+	if m != p.Entry {
+		exported := map[string]string{}
+		for _, def := range sortedKeys(m.defs) {
+			goName := gen.ExportName(def)
+			if other, ok := exported[goName]; ok {
+				report(rep, CodeRedeclared, m.defSpan(def), fmt.Sprintf("%s and %s both export as %s", other, def, goName))
+				continue
+			}
+			exported[goName] = def
+			ctx.Names[def] = goName
+		}
+	}
+	for _, imp := range m.AST.Imports {
+		dep := m.Deps[imp.Path]
+		if dep == nil {
+			continue
+		}
+		importPath := modPath + "/" + dep.Dir
+		if len(imp.Names) == 0 {
+			alias := imp.Alias
+			if alias == "" {
+				alias = sem.ImportName(imp.Path)
+			}
+			if prev, ok := declared[alias]; ok {
+				redeclared(rep, alias, imp.Span(), prev, "already names "+prev.what)
+				continue
+			}
+			declared[alias] = declaration{what: "module " + imp.Path, span: imp.Span()}
+			ctx.Modules[alias] = importPath
+			ast.Walk(&qualifiedRefChecker{alias: alias, dep: dep, rep: rep}, m.AST)
+			continue
+		}
+		// Names imported with from-import are qualified by a hidden
+		// package alias in the generated code.
+		alias := dep.Package
+		for i := 2; declared[alias].what != ""; i++ {
+			alias = fmt.Sprintf("%s%d", dep.Package, i)
+		}
+		declared[alias] = declaration{what: "module " + imp.Path}
+		ctx.Modules[alias] = importPath
+		for _, name := range imp.Names {
+			if !dep.defs[name.Name] {
+				report(rep, CodeUndefinedName, name.Span(), fmt.Sprintf("cannot import %s: %s does not define it", name.Name, imp.Path))
+				continue
+			}
+			local := name.Local()
+			if m.defs[local] {
+				redeclared(rep, local, name.Span(), declaration{span: m.defSpan(local)}, "imported from "+imp.Path+" and defined in this module")
+				continue
+			}
+			if prev, ok := declared[local]; ok {
+				redeclared(rep, local, name.Span(), prev, "already names "+prev.what)
+				continue
+			}
+			declared[local] = declaration{what: "name imported from " + imp.Path, span: name.Span()}
+			ctx.Names[local] = alias + "." + gen.ExportName(name.Name)
+		}
+	}
+}
+
+// qualifiedRefChecker reports references alias.name to names the imported
+// module does not define.
+type qualifiedRefChecker struct {
+	alias string
+	dep   *Module
+	rep   diag.Reporter
+}
+
+func (c *qualifiedRefChecker) Visit(n ast.Node) bool {
+	attr, ok := n.(*ast.Attr)
+	if !ok {
+		return true
+	}
+	if name, ok := attr.Target.(*ast.Name); ok && name.Ident == c.alias && !c.dep.defs[attr.Attr] {
+		report(c.rep, CodeUndefinedName, attr.Span(), fmt.Sprintf("undefined: %s.%s", c.alias, attr.Attr))
+	}
+	return true
+}
+
+// defSpan returns the span of the top-level definition of name in m.
+func (m *Module) defSpan(name string) diag.Span {
+	for _, stmt := range m.AST.Body {
+		switch s := stmt.(type) {
+		case *ast.FuncDef:
+			if s.Name == name {
+				return s.Span()
+			}
+		case *ast.VarStmt:
+			if s.Name == name {
+				return s.Span()
+			}
+		}
+	}
+	return diag.Span{}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UsesRuntime reports whether any module imports a package of the Rayo
+// runtime module.
+func (p *Program) UsesRuntime() bool {
+	for _, m := range p.Modules {
+		for _, imp := range m.AST.Imports {
+			if imp.Path == RuntimeModule || strings.HasPrefix(imp.Path, RuntimeModule+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindRuntimeRoot returns the nearest directory at or above dir holding the
+// go.mod of the Rayo runtime module, or "" if there is none.
+func FindRuntimeRoot(dir string) string {
+	for {
+		if modulePath(filepath.Join(dir, "go.mod")) == RuntimeModule {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func modulePath(gomod string) string {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// Emit writes p into dir as a self-contained Go module: a go.mod plus the
+// generated source of every module. When the program imports the Rayo
+// runtime and mod names no checkout of it, one is looked for via the
+// RAYOROOT environment variable and above the program and working
+// directories.
+func (p *Program) Emit(dir string, mod GoModule) error {
+	files, _, err := p.emitModule(dir, mod)
+	if err != nil {
+		return err
+	}
+	return writeGoFiles(dir, files)
+}
+
+// emitModule writes the go.mod of p's Go module into dir, fetching the
+// required modules, and returns the generated Go files along with the
+// settings actually used.
+func (p *Program) emitModule(dir string, mod GoModule) (map[string]string, GoModule, error) {
+	if !p.UsesRuntime() {
+		mod.RuntimeRoot = ""
+	} else if mod.RuntimeRoot == "" {
+		mod.RuntimeRoot = LocateRuntime(p.Root)
+	}
+	if mod.Path == "" {
+		mod.Path = DefaultModulePath
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, mod, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod.File()), 0644); err != nil {
+		return nil, mod, err
+	}
+	// go get records in go.sum what loading and building the imported
+	// packages of required modules takes, their own dependencies included;
+	// go mod download would only fetch the modules.
+	if pkgs := p.requiredPackages(mod.Require); len(pkgs) > 0 {
+		get := exec.Command("go", append([]string{"get"}, pkgs...)...)
+		get.Dir = dir
+		if out, err := get.CombinedOutput(); err != nil {
+			return nil, mod, fmt.Errorf("downloading dependencies: %v\n%s", err, out)
+		}
+	}
+	files, err := p.Generate(mod.Path, sem.NewGoImporter(dir))
+	return files, mod, err
+}
+
+// requiredPackages returns the Go packages p imports from the modules in
+// require, as package@version arguments pinning the required versions.
+func (p *Program) requiredPackages(require map[string]string) []string {
+	seen := map[string]bool{}
+	var pkgs []string
+	for _, m := range p.Modules {
+		for _, imp := range m.AST.Imports {
+			if sem.IsRayoImport(imp.Path) || seen[imp.Path] {
+				continue
+			}
+			seen[imp.Path] = true
+			module := ""
+			for mod := range require {
+				if (imp.Path == mod || strings.HasPrefix(imp.Path, mod+"/")) && len(mod) > len(module) {
+					module = mod
+				}
+			}
+			if module != "" {
+				pkgs = append(pkgs, imp.Path+"@"+require[module])
+			}
+		}
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
+
+// writeGoFiles writes generated files, keyed by slash-separated path, into
+// dir.
+func writeGoFiles(dir string, files map[string]string) error {
+	for name, code := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// LocateRuntime finds a checkout of the Rayo runtime module: the RAYOROOT
+// environment variable, or the nearest rayo module above dir or the working
+// directory. It returns "" if none is found.
+func LocateRuntime(dir string) string {
+	if root := os.Getenv("RAYOROOT"); root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			return abs
+		}
+		return root
+	}
+	if root := FindRuntimeRoot(dir); root != "" {
+		return root
+	}
+	if wd, err := os.Getwd(); err == nil {
+		return FindRuntimeRoot(wd)
+	}
+	return ""
+}
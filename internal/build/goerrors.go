@@ -0,0 +1,161 @@
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"rayo/internal/diag"
+)
+
+const (
+	// CodeGo is the code of Go compiler errors mapped back to Rayo source.
+	CodeGo = "E0301"
+	// CodeCodegen is the code of Go compiler errors in generated code that
+	// corresponds to no Rayo source: a bug in the code generator.
+	CodeCodegen = "E0302"
+)
+
+// goErrorLine matches a positioned line of go build output,
+// file:line[:col]: message.
+var goErrorLine = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?: (.*)$`)
+
+// GoBuildError translates the output of a failed go build of the Go module
+// generated for p in dir into Rayo diagnostics. Errors the //line
+// directives of the generated code place in a Rayo module are reported
+// against that module, with Go type names in the messages rewritten to
+// Rayo ones. Errors in generated code with no Rayo counterpart are marked
+// as internal codegen bugs and shown with an excerpt of the Go code. The
+// result is a join of *diag.SourceError, one per file.
+func (p *Program) GoBuildError(dir, output string) error {
+	byFile := map[string]*Module{}
+	for _, m := range p.Modules {
+		byFile[filepath.Clean(m.File)] = m
+	}
+	var order []string
+	errs := map[string]*diag.SourceError{}
+	fileError := func(name, src string) *diag.SourceError {
+		if e, ok := errs[name]; ok {
+			return e
+		}
+		e := &diag.SourceError{File: name, Source: src}
+		errs[name] = e
+		order = append(order, name)
+		return e
+	}
+	var last *diag.SourceError
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		switch {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "# "):
+			// Package headers
+			continue
+		case strings.HasPrefix(line, "\t") && last != nil:
+			// Continuation of the previous message
+			d := &last.Diagnostics[len(last.Diagnostics)-1]
+			d.Notes = append(d.Notes, rayoTypes(strings.TrimSpace(line)))
+			continue
+		}
+		m := goErrorLine.FindStringSubmatch(line)
+		if m == nil {
+			last = fileError("go build", "")
+			last.Diagnostics = append(last.Diagnostics, diag.Diagnostic{Severity: diag.Error, Msg: line})
+			continue
+		}
+		path := m[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		if mod, ok := byFile[filepath.Clean(path)]; ok {
+			last = fileError(p.DisplayName(mod.File), mod.Source)
+			last.Diagnostics = append(last.Diagnostics, diag.Diagnostic{
+				Severity: diag.Error,
+				Code:     CodeGo,
+				Span:     lineSpan(mod.Source, lineNo, col),
+				Msg:      rayoTypes(m[4]),
+			})
+			continue
+		}
+		name := path
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = filepath.ToSlash(rel)
+		}
+		src, _ := os.ReadFile(path)
+		last = fileError(name, string(src))
+		last.Diagnostics = append(last.Diagnostics, diag.Diagnostic{
+			Severity: diag.Error,
+			Code:     CodeCodegen,
+			Span:     lineSpan(string(src), lineNo, col),
+			Msg:      "internal codegen bug: " + m[4],
+			Notes:    []string{"the Go code generated for the program does not compile; please report this with the Rayo source"},
+		})
+	}
+	result := make([]error, len(order))
+	for i, name := range order {
+		result[i] = errs[name]
+	}
+	return errors.Join(result...)
+}
+
+// lineSpan returns the span of column col of line in src or, when the
+// column is unknown (0), of the whole line without its indentation.
+func lineSpan(src string, line, col int) diag.Span {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return diag.Span{Start: diag.SourcePos{Line: line, Col: col}, End: diag.SourcePos{Line: line, Col: col}}
+	}
+	offset := 0
+	for _, l := range lines[:line-1] {
+		offset += len(l) + 1
+	}
+	text := strings.TrimRight(lines[line-1], "\r")
+	end := len(text) + 1
+	if col == 0 {
+		col = len(text) - len(strings.TrimLeft(text, " \t")) + 1
+	} else {
+		end = col
+	}
+	return diag.Span{
+		Start: diag.SourcePos{Offset: offset + col - 1, Line: line, Col: col},
+		End:   diag.SourcePos{Offset: offset + end - 1, Line: line, Col: end},
+	}
+}
+
+// goType matches the Go types generated code uses, optionally untyped.
+var goType = regexp.MustCompile(`\buntyped (string|int|float|rune|bool|nil)\b|\[\](\w+)|map\[(\w+)\](\w+)|\b(string|float64|nil)\b`)
+
+// rayoTypes rewrites the Go type names in a compiler message to the Rayo
+// types they stand for, e.g. "untyped string" to "str" and
+// "map[string]any" to "dict[str, any]".
+func rayoTypes(msg string) string {
+	return goType.ReplaceAllStringFunc(msg, func(s string) string {
+		m := goType.FindStringSubmatch(s)
+		switch {
+		case m[1] != "":
+			return rayoType(m[1])
+		case m[2] != "":
+			return "list[" + rayoType(m[2]) + "]"
+		case m[3] != "":
+			return "dict[" + rayoType(m[3]) + ", " + rayoType(m[4]) + "]"
+		}
+		return rayoType(m[5])
+	})
+}
+
+func rayoType(goName string) string {
+	switch goName {
+	case "string":
+		return "str"
+	case "float", "float64":
+		return "float"
+	case "rune":
+		return "int"
+	case "nil":
+		return "None"
+	}
+	return goName
+}
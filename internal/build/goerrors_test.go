@@ -0,0 +1,81 @@
+package build
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rayo/internal/diag"
+)
+
+func TestGoBuildError(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ryo":    "def main() {\n    x = 1\n    print(x + \"a\")\n}\n",
+		"out/main.go": "package main\n\nimport \"os\"\n",
+	})
+	prog, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	out := filepath.Join(dir, "out")
+	output := "# rayoapp\n" +
+		"../main.ryo:3: invalid operation: x + \"a\" (mismatched types int and untyped string)\n" +
+		"./main.go:3:8: \"os\" imported and not used\n" +
+		"../main.ryo:2:5: cannot use m (variable of type map[string]any) as []string value in assignment\n" +
+		"\thave []float64\n" +
+		"go: some toolchain failure\n"
+	err = prog.GoBuildError(out, output)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := strings.Join([]string{
+		"main.ryo:3:5: error[E0301]: invalid operation: x + \"a\" (mismatched types int and str)",
+		"main.ryo:2:5: error[E0301]: cannot use m (variable of type dict[str, any]) as list[str] value in assignment",
+		"main.go:3:8: error[E0302]: internal codegen bug: \"os\" imported and not used",
+		"go build: error: go: some toolchain failure",
+	}, "\n")
+	if err.Error() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", err, want)
+	}
+	serrs := err.(interface{ Unwrap() []error }).Unwrap()
+	ryo := serrs[0].(*diag.SourceError)
+	if span := ryo.Diagnostics[0].Span; span.Start.Col != 5 || span.End.Col != 19 {
+		t.Errorf("a position without a column should cover the line, got %+v", span)
+	}
+	if notes := ryo.Diagnostics[1].Notes; len(notes) != 1 || notes[0] != "have list[float]" {
+		t.Errorf("continuation line not kept as a note: %q", notes)
+	}
+	if gen := serrs[1].(*diag.SourceError); !strings.HasPrefix(gen.Source, "package main") {
+		t.Errorf("codegen bug shown without the generated code: %q", gen.Source)
+	}
+}
+
+func TestGoBuildErrorFromToolchain(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	dir := writeFiles(t, map[string]string{
+		"main.ryo": "def main() {\n    x = 1\n\n    print(x + \"a\")\n}\n",
+	})
+	prog, err := Load(filepath.Join(dir, "main.ryo"), Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := prog.Emit(out, GoModule{}); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = out
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("expected the build to fail")
+	}
+	err = prog.GoBuildError(out, string(output))
+	want := "main.ryo:4:5: error[E0301]: invalid operation: x + \"a\" (mismatched types int and str)"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s\ngo build output:\n%s", err, want, output)
+	}
+}
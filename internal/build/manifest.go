@@ -0,0 +1,242 @@
+package build
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Manifest is a parsed rayo.toml project manifest:
+//
+//	[project]
+//	name = "hello"
+//	entry = "src/main.ryo"       # default: main.ryo
+//	module = "example.com/hello" # Go module path; default: name
+//	rayo = "../rayo"             # optional local checkout of the Rayo runtime
+//
+//	[dependencies]
+//	"github.com/google/uuid" = "v1.6.0"
+type Manifest struct {
+	Dir          string // directory containing the manifest
+	Name         string
+	Entry        string // entry file, relative to Dir
+	Module       string // Go module path of the generated module
+	Runtime      string // Rayo runtime checkout, relative to Dir
+	Dependencies map[string]string
+}
+
+// LoadManifest reads and validates the manifest in dir.
+func LoadManifest(dir string) (*Manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, ManifestFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseManifest(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.Dir = dir
+	return m, nil
+}
+
+// ParseManifest parses manifest source. It understands the subset of TOML
+// used by rayo.toml: tables, comments, and string-valued keys.
+func ParseManifest(src string) (*Manifest, error) {
+	m := &Manifest{Dependencies: map[string]string{}}
+	table := ""
+	for i, line := range strings.Split(src, "\n") {
+		lineNo := i + 1
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed table header %s", lineNo, line)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if table != "project" && table != "dependencies" {
+				return nil, fmt.Errorf("line %d: unknown table [%s]", lineNo, table)
+			}
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key, err := parseKey(strings.TrimSpace(line[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		val, err := strconv.Unquote(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: value of %s must be a quoted string", lineNo, key)
+		}
+		switch table {
+		case "project":
+			switch key {
+			case "name":
+				m.Name = val
+			case "entry":
+				m.Entry = val
+			case "module":
+				m.Module = val
+			case "rayo":
+				m.Runtime = val
+			default:
+				return nil, fmt.Errorf("line %d: unknown project key %s", lineNo, key)
+			}
+		case "dependencies":
+			if !strings.HasPrefix(val, "v") {
+				return nil, fmt.Errorf("line %d: version of %s must be a Go module version such as v1.2.3", lineNo, key)
+			}
+			m.Dependencies[key] = val
+		default:
+			return nil, fmt.Errorf("line %d: key %s outside of a table", lineNo, key)
+		}
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("[project] name is required")
+	}
+	if m.Entry == "" {
+		m.Entry = "main.ryo"
+	}
+	if m.Module == "" {
+		m.Module = m.Name
+	}
+	return m, nil
+}
+
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			inString = !inString
+		case '\\':
+			i++
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func parseKey(key string) (string, error) {
+	if strings.HasPrefix(key, `"`) {
+		return strconv.Unquote(key)
+	}
+	for _, r := range key {
+		if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "", fmt.Errorf("invalid bare key %q", key)
+		}
+	}
+	return key, nil
+}
+
+// EntryFile returns the absolute path of the project's entry module.
+func (m *Manifest) EntryFile() string {
+	return filepath.Join(m.Dir, filepath.FromSlash(m.Entry))
+}
+
+// GoModule returns the description of the Go module generated for the
+// project.
+func (m *Manifest) GoModule() GoModule {
+	g := GoModule{Path: m.Module, Require: m.Dependencies}
+	if m.Runtime != "" {
+		g.RuntimeRoot = filepath.FromSlash(m.Runtime)
+		if !filepath.IsAbs(g.RuntimeRoot) {
+			g.RuntimeRoot = filepath.Join(m.Dir, g.RuntimeRoot)
+		}
+	}
+	return g
+}
+
+// BuildDir returns the out-of-tree directory the project's Go module is
+// generated into, under the user cache directory.
+func (m *Manifest) BuildDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(m.Dir))
+	return filepath.Join(cache, "rayo", "build", fmt.Sprintf("%s-%x", m.Name, sum[:6])), nil
+}
+
+// BuildMarker is the file that marks a directory as one a project's Go
+// module is generated into, which a later build may clear.
+const BuildMarker = ".rayo-build"
+
+// PrepareBuildDir makes dir an empty, marked directory to generate a
+// project's Go module into, so modules removed from the project do not
+// linger from a previous build. A directory that is not empty is only
+// cleared if it carries the BuildMarker.
+func PrepareBuildDir(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(entries) > 0 {
+		if _, err := os.Stat(filepath.Join(dir, BuildMarker)); err != nil {
+			return fmt.Errorf("build directory %s is not empty and has no %s file; refusing to clear it", dir, BuildMarker)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, BuildMarker), nil, 0644)
+}
+
+// GoModule describes the go.mod of a generated module.
+type GoModule struct {
+	Path string // module path; DefaultModulePath when empty
+	// RuntimeRoot is a local checkout of the Rayo runtime module, wired in
+	// with a replace directive when the program imports it.
+	RuntimeRoot string
+	Require     map[string]string // additional module requirements
+}
+
+// File returns the go.mod contents.
+func (g GoModule) File() string {
+	path := g.Path
+	if path == "" {
+		path = DefaultModulePath
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "module %s\n\ngo 1.22\n", path)
+	var reqs []string
+	for mod, version := range g.Require {
+		reqs = append(reqs, fmt.Sprintf("\t%s %s\n", mod, version))
+	}
+	if g.RuntimeRoot != "" {
+		reqs = append(reqs, fmt.Sprintf("\t%s v0.0.0\n", RuntimeModule))
+	}
+	sort.Strings(reqs)
+	if len(reqs) > 0 {
+		fmt.Fprintf(&sb, "\nrequire (\n%s)\n", strings.Join(reqs, ""))
+	}
+	if g.RuntimeRoot != "" {
+		fmt.Fprintf(&sb, "\nreplace %s => %s\n", RuntimeModule, g.RuntimeRoot)
+	}
+	return sb.String()
+}
@@ -0,0 +1,107 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	m, err := ParseManifest(`# comment
+[project]
+name = "hello"   # trailing comment
+entry = "src/main.ryo"
+module = "example.com/hello"
+rayo = "../rayo"
+
+[dependencies]
+"github.com/google/uuid" = "v1.6.0"
+`)
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	if m.Name != "hello" || m.Entry != "src/main.ryo" || m.Module != "example.com/hello" || m.Runtime != "../rayo" {
+		t.Errorf("parsed %+v", m)
+	}
+	if m.Dependencies["github.com/google/uuid"] != "v1.6.0" {
+		t.Errorf("dependencies = %v", m.Dependencies)
+	}
+
+	m, err = ParseManifest("[project]\nname = \"tool\"\n")
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	if m.Entry != "main.ryo" || m.Module != "tool" {
+		t.Errorf("defaults not applied: %+v", m)
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	cases := map[string]string{
+		"[project]\nname = hello\n":                  "line 2: value of name must be a quoted string",
+		"[project]\nname = \"x\"\ncolor = \"red\"\n": "line 3: unknown project key color",
+		"[tools]\n":                         "line 1: unknown table [tools]",
+		"name = \"x\"\n":                    "line 1: key name outside of a table",
+		"[project]\nentry = \"main.ryo\"\n": "[project] name is required",
+		"[project]\nname = \"x\"\n[dependencies]\nfoo = \"1.0\"\n": "line 4: version of foo must be a Go module version such as v1.2.3",
+	}
+	for src, want := range cases {
+		_, err := ParseManifest(src)
+		if err == nil || err.Error() != want {
+			t.Errorf("ParseManifest(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestManifestGoModule(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"rayo.toml": "[project]\nname = \"hello\"\nmodule = \"example.com/hello\"\nrayo = \"../rayo\"\n[dependencies]\n\"github.com/google/uuid\" = \"v1.6.0\"\n",
+	})
+	m, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if m.EntryFile() != filepath.Join(dir, "main.ryo") {
+		t.Errorf("entry file = %s", m.EntryFile())
+	}
+	got := m.GoModule().File()
+	want := "module example.com/hello\n\ngo 1.22\n\nrequire (\n\tgithub.com/google/uuid v1.6.0\n\trayo v0.0.0\n)\n\nreplace rayo => " + filepath.Join(filepath.Dir(dir), "rayo") + "\n"
+	if got != want {
+		t.Errorf("go.mod =\n%s\nwant\n%s", got, want)
+	}
+	buildDir, err := m.BuildDir()
+	if err != nil {
+		t.Fatalf("BuildDir: %v", err)
+	}
+	if strings.HasPrefix(buildDir, dir) || !strings.Contains(filepath.Base(buildDir), "hello-") {
+		t.Errorf("build dir %s should be out of tree and named after the project", buildDir)
+	}
+}
+
+func TestPrepareBuildDir(t *testing.T) {
+	project := writeFiles(t, map[string]string{"rayo.toml": "[project]\nname = \"hello\"\n", "main.ryo": "print(1)\n"})
+	if err := PrepareBuildDir(project); err == nil {
+		t.Errorf("cleared a project directory")
+	}
+	if _, err := os.Stat(filepath.Join(project, "main.ryo")); err != nil {
+		t.Errorf("project sources are gone: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "build")
+	if err := PrepareBuildDir(dir); err != nil {
+		t.Fatalf("new directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareBuildDir(dir); err != nil {
+		t.Fatalf("marked directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.go")); err == nil {
+		t.Errorf("old.go was left in a cleared directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, BuildMarker)); err != nil {
+		t.Errorf("cleared directory is not marked: %v", err)
+	}
+}
@@ -1,5 +1,11 @@
 package diag
 
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
 // SourcePos represents a position in the source file.
 type SourcePos struct {
     Offset int // byte offset
@@ -17,3 +23,122 @@ type Span struct {
 type Reporter interface {
     Report(span Span, msg string)
 }
+
+// Severity classifies a diagnostic.
+type Severity int
+
+const (
+    Error Severity = iota
+    Warning
+    Note
+)
+
+func (s Severity) String() string {
+    switch s {
+    case Error:
+        return "error"
+    case Warning:
+        return "warning"
+    case Note:
+        return "note"
+    }
+    return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is a message about a span of source code. Code is a stable
+// identifier such as E0201, listed in docs/diagnostics.md.
+type Diagnostic struct {
+    Severity Severity
+    Code     string
+    Span     Span
+    Msg      string
+    Label    string  // shown under the primary span, e.g. "expected identifier"
+    Labels   []Label // secondary spans, e.g. a previous declaration
+    Notes    []string
+    Fixes    []Fix
+}
+
+// Label attaches a message to a secondary span of a diagnostic.
+type Label struct {
+    Span Span
+    Msg  string
+}
+
+// Fix is a suggestion attached to a diagnostic. When Span is known, the
+// suggestion is to replace the source in Span with Replacement (an empty
+// Replacement deletes it); otherwise Msg stands alone as a hint.
+type Fix struct {
+    Msg         string
+    Span        Span
+    Replacement string
+}
+
+// Format renders the diagnostic on one line as
+// file:line:col: severity[code]: msg, leaving out the position when the
+// span is unknown.
+func (d Diagnostic) Format(file string) string {
+    var sb strings.Builder
+    sb.WriteString(file)
+    if d.Span.Start.Line > 0 {
+        fmt.Fprintf(&sb, ":%d:%d", d.Span.Start.Line, d.Span.Start.Col)
+    }
+    sb.WriteString(": ")
+    sb.WriteString(d.Severity.String())
+    if d.Code != "" {
+        fmt.Fprintf(&sb, "[%s]", d.Code)
+    }
+    sb.WriteString(": ")
+    sb.WriteString(d.Msg)
+    return sb.String()
+}
+
+// DiagnosticReporter is a Reporter that also accepts full diagnostics.
+type DiagnosticReporter interface {
+    Reporter
+    ReportDiagnostic(d Diagnostic)
+}
+
+// Emit sends d to rep, falling back to Report with the message alone when
+// rep does not keep severities and codes.
+func Emit(rep Reporter, d Diagnostic) {
+    if dr, ok := rep.(DiagnosticReporter); ok {
+        dr.ReportDiagnostic(d)
+        return
+    }
+    rep.Report(d.Span, d.Msg)
+}
+
+// List is a DiagnosticReporter that collects the diagnostics of one file.
+// Plain reports are recorded as errors without a code.
+type List struct {
+    File        string
+    Diagnostics []Diagnostic
+}
+
+func (l *List) Report(span Span, msg string) {
+    l.ReportDiagnostic(Diagnostic{Severity: Error, Span: span, Msg: msg})
+}
+
+func (l *List) ReportDiagnostic(d Diagnostic) {
+    l.Diagnostics = append(l.Diagnostics, d)
+}
+
+// Count returns the number of diagnostics with the given severity.
+func (l *List) Count(sev Severity) int {
+    n := 0
+    for _, d := range l.Diagnostics {
+        if d.Severity == sev {
+            n++
+        }
+    }
+    return n
+}
+
+// Sort orders the diagnostics by position; diagnostics without a position
+// come first. The sort is stable, so reports at the same position keep
+// their order.
+func (l *List) Sort() {
+    sort.SliceStable(l.Diagnostics, func(i, j int) bool {
+        return l.Diagnostics[i].Span.Start.Offset < l.Diagnostics[j].Span.Start.Offset
+    })
+}
@@ -0,0 +1,94 @@
+package diag
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestDiagnosticFormat(t *testing.T) {
+    d := Diagnostic{Severity: Warning, Code: "W0001", Span: Span{Start: SourcePos{Offset: 10, Line: 2, Col: 5}}, Msg: "unused variable: x"}
+    if got, want := d.Format("a.ryo"), "a.ryo:2:5: warning[W0001]: unused variable: x"; got != want {
+        t.Errorf("got %q, want %q", got, want)
+    }
+    d = Diagnostic{Severity: Error, Msg: "boom"}
+    if got, want := d.Format("a.ryo"), "a.ryo: error: boom"; got != want {
+        t.Errorf("got %q, want %q", got, want)
+    }
+}
+
+func TestListReportAndSort(t *testing.T) {
+    l := &List{File: "a.ryo"}
+    var rep Reporter = l
+    Emit(rep, Diagnostic{Severity: Warning, Code: "W0001", Span: Span{Start: SourcePos{Offset: 20}}, Msg: "second"})
+    rep.Report(Span{Start: SourcePos{Offset: 5}}, "first")
+    l.Sort()
+    if l.Diagnostics[0].Msg != "first" || l.Diagnostics[0].Severity != Error || l.Diagnostics[1].Code != "W0001" {
+        t.Errorf("unexpected diagnostics: %+v", l.Diagnostics)
+    }
+    if l.Count(Error) != 1 || l.Count(Warning) != 1 || l.Count(Note) != 0 {
+        t.Errorf("unexpected counts")
+    }
+}
+
+func pos(line, col, offset int) SourcePos {
+    return SourcePos{Line: line, Col: col, Offset: offset}
+}
+
+func TestRender(t *testing.T) {
+    src := "import \"strings\"\nvar s = \"hi\"\nprint(strings.ToUpperr(s))\n"
+    d := Diagnostic{
+        Severity: Error,
+        Code:     "E0103",
+        Span:     Span{Start: pos(3, 7, 36), End: pos(3, 23, 52)},
+        Msg:      "undefined: strings.ToUpperr",
+        Label:    "not exported by package strings",
+        Labels:   []Label{{Span: Span{Start: pos(1, 8, 7), End: pos(1, 17, 16)}, Msg: "imported here"}},
+        Notes:    []string{"exported names start with a capital letter"},
+        Fixes: []Fix{
+            {Msg: "did you mean strings.ToUpper?", Span: Span{Start: pos(3, 7, 36), End: pos(3, 23, 52)}, Replacement: "strings.ToUpper"},
+            {Msg: "see go doc strings"},
+        },
+    }
+    var sb strings.Builder
+    (&Renderer{}).Render(&sb, "main.ryo", src, d)
+    want := `error[E0103]: undefined: strings.ToUpperr
+ --> main.ryo:3:7
+  |
+1 | import "strings"
+  |        --------- imported here
+...
+3 | print(strings.ToUpperr(s))
+  |       ^^^^^^^^^^^^^^^^ not exported by package strings
+  |
+  = note: exported names start with a capital letter
+help: did you mean strings.ToUpper?
+  |
+3 | print(strings.ToUpper(s))
+  |       ~~~~~~~~~~~~~~~
+  = help: see go doc strings
+
+`
+    if got := sb.String(); got != want {
+        t.Errorf("got:\n%s\nwant:\n%s", got, want)
+    }
+}
+
+func TestRenderWithoutPosition(t *testing.T) {
+    var sb strings.Builder
+    r := &Renderer{Color: true}
+    r.Render(&sb, "a.ryo", "x\n", Diagnostic{Severity: Warning, Msg: "odd", Fixes: []Fix{{Msg: "fix it"}}})
+    got := sb.String()
+    if !strings.Contains(got, "\x1b[1;33mwarning\x1b[0m") || !strings.Contains(got, "-->\x1b[0m a.ryo\n") || !strings.Contains(got, "help") {
+        t.Errorf("unexpected rendering: %q", got)
+    }
+}
+
+func TestRenderTabsAndLongSpans(t *testing.T) {
+    src := "def f() {\n\treturn x +\n\t\ty\n}\n"
+    d := Diagnostic{Severity: Error, Span: Span{Start: pos(2, 9, 18), End: pos(3, 4, 25)}, Msg: "bad"}
+    var sb strings.Builder
+    (&Renderer{}).Render(&sb, "t.ryo", src, d)
+    if !strings.Contains(sb.String(), "2 | \treturn x +\n  | \t       ^^^\n") {
+        t.Errorf("unexpected rendering:\n%s", sb.String())
+    }
+}
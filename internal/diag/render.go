@@ -0,0 +1,224 @@
+package diag
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Renderer prints diagnostics with an excerpt of the source they refer to:
+//
+//    error[E0103]: undefined: strings.ToUpperr
+//      --> main.ryo:3:7
+//       |
+//     3 | print(strings.ToUpperr("hi"))
+//       |       ^^^^^^^^^^^^^^^^ not exported by package strings
+//       |
+//    help: did you mean strings.ToUpper?
+//       |
+//     3 | print(strings.ToUpper("hi"))
+//       |       ~~~~~~~~~~~~~~~
+type Renderer struct {
+    Color bool // use ANSI colors
+}
+
+const (
+    ansiReset  = "\x1b[0m"
+    ansiBold   = "\x1b[1m"
+    ansiRed    = "\x1b[1;31m"
+    ansiYellow = "\x1b[1;33m"
+    ansiCyan   = "\x1b[1;36m"
+    ansiBlue   = "\x1b[1;34m"
+    ansiGreen  = "\x1b[1;32m"
+)
+
+// ColorEnabled reports whether output to f should be colored: f is a
+// terminal and the NO_COLOR environment variable is not set.
+func ColorEnabled(f *os.File) bool {
+    if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+        return false
+    }
+    info, err := f.Stat()
+    return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *Renderer) paint(color, s string) string {
+    if !r.Color || s == "" {
+        return s
+    }
+    return color + s + ansiReset
+}
+
+func severityColor(s Severity) string {
+    switch s {
+    case Error:
+        return ansiRed
+    case Warning:
+        return ansiYellow
+    }
+    return ansiCyan
+}
+
+// annotation is an underlined span in an excerpt.
+type annotation struct {
+    span    Span
+    msg     string
+    primary bool
+}
+
+// Render writes d, which was reported in file with contents src, to w.
+// Spans that fall outside src are shown as a location only.
+func (r *Renderer) Render(w io.Writer, file, src string, d Diagnostic) {
+    lines := strings.Split(src, "\n")
+    valid := func(s Span) bool { return s.Start.Line > 0 && s.Start.Line <= len(lines) && s.Start.Col > 0 }
+
+    annots := []annotation{}
+    if valid(d.Span) {
+        annots = append(annots, annotation{span: d.Span, msg: d.Label, primary: true})
+    }
+    for _, l := range d.Labels {
+        if valid(l.Span) {
+            annots = append(annots, annotation{span: l.Span, msg: l.Msg})
+        }
+    }
+    sort.SliceStable(annots, func(i, j int) bool { return annots[i].span.Start.Line < annots[j].span.Start.Line })
+    maxLine := 0
+    for _, a := range annots {
+        maxLine = max(maxLine, a.span.Start.Line)
+    }
+    for _, f := range d.Fixes {
+        if valid(f.Span) {
+            maxLine = max(maxLine, f.Span.Start.Line)
+        }
+    }
+    pad := strings.Repeat(" ", len(strconv.Itoa(maxLine)))
+    gutter := r.paint(ansiBlue, pad+" |")
+
+    // Header
+    sev := d.Severity.String()
+    if d.Code != "" {
+        sev += "[" + d.Code + "]"
+    }
+    fmt.Fprintf(w, "%s%s\n", r.paint(severityColor(d.Severity), sev), r.paint(ansiBold, ": "+d.Msg))
+    loc := file
+    if d.Span.Start.Line > 0 {
+        loc = fmt.Sprintf("%s:%d:%d", file, d.Span.Start.Line, d.Span.Start.Col)
+    }
+    fmt.Fprintf(w, "%s %s\n", r.paint(ansiBlue, pad+"-->"), loc)
+
+    // Excerpt
+    if len(annots) > 0 {
+        fmt.Fprintln(w, gutter)
+        prev := 0
+        for i, a := range annots {
+            line := a.span.Start.Line
+            if line != prev {
+                if prev != 0 && line > prev+1 {
+                    fmt.Fprintln(w, r.paint(ansiBlue, "..."))
+                }
+                r.sourceLine(w, pad, line, lines[line-1])
+                prev = line
+            }
+            mark, color := "-", ansiBlue
+            if a.primary {
+                mark, color = "^", severityColor(d.Severity)
+            }
+            text := lines[line-1]
+            under := indent(text, a.span.Start.Col) + strings.Repeat(mark, width(text, a.span))
+            if a.msg != "" {
+                under += " " + a.msg
+            }
+            fmt.Fprintf(w, "%s %s\n", gutter, r.paint(color, under))
+            if i == len(annots)-1 && (len(d.Notes) > 0 || len(d.Fixes) > 0) {
+                fmt.Fprintln(w, gutter)
+            }
+        }
+    }
+    for _, n := range d.Notes {
+        fmt.Fprintf(w, "%s %s\n", r.paint(ansiBlue, pad+" ="), r.paint(ansiBold, "note")+": "+n)
+    }
+
+    // Suggestions
+    for _, f := range d.Fixes {
+        if !valid(f.Span) || f.Span.End.Line != f.Span.Start.Line || f.Span.End.Col < f.Span.Start.Col {
+            fmt.Fprintf(w, "%s %s\n", r.paint(ansiBlue, pad+" ="), r.paint(ansiGreen, "help")+": "+f.Msg)
+            continue
+        }
+        fmt.Fprintf(w, "%s: %s\n", r.paint(ansiGreen, "help"), f.Msg)
+        line := f.Span.Start.Line
+        text := lines[line-1]
+        start := min(f.Span.Start.Col-1, len(text))
+        end := min(f.Span.End.Col-1, len(text))
+        patched := text[:start] + f.Replacement + text[end:]
+        fmt.Fprintln(w, gutter)
+        r.sourceLine(w, pad, line, patched)
+        if f.Replacement != "" {
+            under := indent(patched, f.Span.Start.Col) + strings.Repeat("~", utf8.RuneCountInString(f.Replacement))
+            fmt.Fprintf(w, "%s %s\n", gutter, r.paint(ansiGreen, under))
+        }
+    }
+    fmt.Fprintln(w)
+}
+
+func (r *Renderer) sourceLine(w io.Writer, pad string, line int, text string) {
+    num := strconv.Itoa(line)
+    num = pad[:len(pad)-len(num)] + num
+    fmt.Fprintf(w, "%s %s\n", r.paint(ansiBlue, num+" |"), strings.TrimRight(text, "\r"))
+}
+
+// indent returns the whitespace that lines up with column col of text,
+// keeping tabs so the caret stays aligned however tabs are displayed.
+func indent(text string, col int) string {
+    prefix := text[:min(col-1, len(text))]
+    var sb strings.Builder
+    for _, r := range prefix {
+        if r == '\t' {
+            sb.WriteByte('\t')
+        } else {
+            sb.WriteByte(' ')
+        }
+    }
+    return sb.String()
+}
+
+// width returns the number of characters of text to underline for span;
+// spans reaching past the line are cut at its end.
+func width(text string, span Span) int {
+    start := min(span.Start.Col-1, len(text))
+    end := len(strings.TrimRight(text, "\r"))
+    if span.End.Line == span.Start.Line {
+        end = min(span.End.Col-1, end)
+    }
+    if end <= start {
+        return 1
+    }
+    return utf8.RuneCountInString(text[start:end])
+}
+
+// SourceError is an error made of the diagnostics of one source file. It
+// keeps the source so that the diagnostics can be rendered with excerpts.
+type SourceError struct {
+    File        string
+    Source      string
+    Diagnostics []Diagnostic
+}
+
+// Error returns the diagnostics in their one-line form.
+func (e *SourceError) Error() string {
+    lines := make([]string, len(e.Diagnostics))
+    for i, d := range e.Diagnostics {
+        lines[i] = d.Format(e.File)
+    }
+    return strings.Join(lines, "\n")
+}
+
+// Render writes every diagnostic of e to w.
+func (e *SourceError) Render(w io.Writer, r *Renderer) {
+    for _, d := range e.Diagnostics {
+        r.Render(w, e.File, e.Source, d)
+    }
+}
@@ -0,0 +1,145 @@
+// Package diff computes line-based differences between two texts and
+// renders them as unified diffs, as printed by `diff -u`.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context is the number of unchanged lines shown around each change.
+const Context = 3
+
+// Unified returns the unified diff turning old into new, with the given
+// file names in the header, or "" if the texts are equal.
+func Unified(oldName, newName, old, new string) string {
+	if old == new {
+		return ""
+	}
+	a, b := splitLines(old), splitLines(new)
+	edits := lineEdits(a, b)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(edits) {
+		oldStart, oldLen, newStart, newLen := h.counts()
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", rangeString(oldStart, oldLen), rangeString(newStart, newLen))
+		for _, e := range h {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// splitLines splits s after each newline; the last line may lack one.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edit is one line of the diff: op is ' ', '-' or '+'. oldLine and
+// newLine are the 1-based line numbers the edit is at in each text.
+type edit struct {
+	op               byte
+	text             string
+	oldLine, newLine int
+}
+
+// lineEdits returns the edit script from a to b, keeping a longest common
+// subsequence of lines.
+func lineEdits(a, b []string) []edit {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i + 1, j + 1})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			edits = append(edits, edit{'+', b[j], i + 1, j + 1})
+			j++
+		default:
+			edits = append(edits, edit{'-', a[i], i + 1, j + 1})
+			i++
+		}
+	}
+	return edits
+}
+
+type hunk []edit
+
+// hunks groups the changes of edits with Context lines around them,
+// merging changes whose context overlaps.
+func hunks(edits []edit) []hunk {
+	var out []hunk
+	start, end := -1, -1 // current hunk is edits[start:end]
+	for i, e := range edits {
+		if e.op == ' ' {
+			continue
+		}
+		lo, hi := max(i-Context, 0), min(i+Context+1, len(edits))
+		if start >= 0 && lo <= end {
+			end = hi
+			continue
+		}
+		if start >= 0 {
+			out = append(out, edits[start:end])
+		}
+		start, end = lo, hi
+	}
+	if start >= 0 {
+		out = append(out, edits[start:end])
+	}
+	return out
+}
+
+// counts returns the start line and length of the hunk in each text.
+func (h hunk) counts() (oldStart, oldLen, newStart, newLen int) {
+	oldStart, newStart = h[0].oldLine, h[0].newLine
+	for _, e := range h {
+		if e.op != '+' {
+			oldLen++
+		}
+		if e.op != '-' {
+			newLen++
+		}
+	}
+	return oldStart, oldLen, newStart, newLen
+}
+
+// rangeString renders a hunk range; an empty range starts at the line
+// before it, as diff -u does.
+func rangeString(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
@@ -0,0 +1,39 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	want := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	if got := Unified("old", "new", old, new); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedEdgeCases(t *testing.T) {
+	for _, tc := range []struct{ old, new, want string }{
+		{"x\n", "x\n", ""},
+		{"", "x\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n"},
+		{"x\n", "", "--- a\n+++ b\n@@ -1 +0,0 @@\n-x\n"},
+		{"x", "x\n", "--- a\n+++ b\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+x\n"},
+	} {
+		if got := Unified("a", "b", tc.old, tc.new); got != tc.want {
+			t.Errorf("Unified(%q, %q):\n%s\nwant:\n%s", tc.old, tc.new, got, tc.want)
+		}
+	}
+}
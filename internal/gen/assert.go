@@ -0,0 +1,100 @@
+package gen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rayo/internal/ast"
+	"rayo/internal/parse"
+)
+
+// negated maps a comparison operator to the one that holds when it fails.
+var negated = map[string]string{"==": "!=", "!=": "==", "<": ">=", ">": "<=", "<=": ">", ">=": "<"}
+
+// emitAssert emits an assert statement. A failing assert panics with an
+// *AssertionError whose message shows the asserted expression, or the
+// message given, and for a comparison the values of its operands:
+//
+//	assert a + 1 == 4: 3 != 4, where 3 = a + 1
+//
+// With ctx.StripAsserts the check is left out, but its operands are still
+// compiled, so that variables used only in asserts count as used. Either
+// way the statement is emitted on one line, so that the //line directives
+// place a failure on the line of the assert.
+func emitAssert(s *ast.AssertStmt, ctx *GenContext) {
+	if ctx.StripAsserts {
+		fmt.Fprintf(ctx.Code, "if false { _ = %s", emitExpr(s.Test, ctx))
+		if s.Msg != nil {
+			fmt.Fprintf(ctx.Code, "; _ = %s", emitExpr(s.Msg, ctx))
+		}
+		ctx.Code.WriteString(" }\n")
+		return
+	}
+	ctx.usesAssert = true
+	msg := strconv.Quote("assert " + parse.Expr(s.Test))
+	if s.Msg != nil {
+		msg = fmt.Sprintf("fmt.Sprint(%s)", emitExpr(s.Msg, ctx))
+	}
+	cmp, ok := s.Test.(*ast.BinaryOp)
+	if !ok || negated[cmp.Op] == "" {
+		fmt.Fprintf(ctx.Code, "if !(%s) { panic(&AssertionError{Msg: %s}) }\n", emitExpr(s.Test, ctx), msg)
+		return
+	}
+	// The operands are evaluated once, for the comparison and the message.
+	// Literals are compared as written rather than bound to variables, so
+	// that an untyped constant such as 2 or nil takes the type of the other
+	// operand, as in a Go comparison.
+	var vars, inits, wheres []string
+	operands := make([]string, 2)
+	for i, side := range []struct {
+		v string
+		e ast.Expr
+	}{{"rayoL", cmp.Left}, {"rayoR", cmp.Right}} {
+		if _, lit := side.e.(*ast.Literal); lit {
+			operands[i] = emitExpr(side.e, ctx)
+			continue
+		}
+		operands[i] = side.v
+		vars, inits = append(vars, side.v), append(inits, emitExpr(side.e, ctx))
+		wheres = append(wheres, fmt.Sprintf("rayoRepr(%s) + %s", side.v, strconv.Quote(" = "+parse.Expr(side.e))))
+	}
+	detail := fmt.Sprintf("rayoRepr(%s) + %s + rayoRepr(%s)", operands[0], strconv.Quote(" "+negated[cmp.Op]+" "), operands[1])
+	if len(wheres) > 0 {
+		detail += ` + ", where " + ` + strings.Join(wheres, ` + ", " + `)
+	}
+	init := ""
+	if len(vars) > 0 {
+		init = strings.Join(vars, ", ") + " := " + strings.Join(inits, ", ") + "; "
+	}
+	fmt.Fprintf(ctx.Code, "if %s!(%s %s %s) { panic(&AssertionError{Msg: %s + \": \" + %s}) }\n",
+		init, operands[0], cmp.Op, operands[1], msg, detail)
+}
+
+// assertSupport is emitted into packages with assert statements.
+const assertSupport = `// AssertionError is raised by a failing assert statement.
+type AssertionError struct {
+	Msg string
+}
+
+func (e *AssertionError) Error() string {
+	return "AssertionError: " + e.Msg
+}
+
+// rayoRepr renders a value the way Rayo source spells it.
+func rayoRepr(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(v)
+}
+
+`
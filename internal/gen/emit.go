@@ -3,14 +3,54 @@ package gen
 import (
 	"fmt"
 	"rayo/internal/ast"
+	"rayo/internal/sem"
+	"sort"
+	"strings"
 )
 
 // EmitModule emits Go code for a module AST.
 func EmitModule(mod *ast.Module, ctx *GenContext) string {
+	out := ctx.Code
+	ctx.Code = &strings.Builder{}
+	ctx.lineBase, ctx.lineOff = 0, 0
+	ctx.usesAssert = false
+	ctx.usesPrint = false
+	ctx.types = map[string]sem.Type{}
+	ctx.scopes = nil
+	ctx.pushScope()
+	// Check if any top-level statement is a ReturnStmt
+	hasReturn := false
+	for _, stmt := range mod.Body {
+		if _, ok := stmt.(*ast.ReturnStmt); ok {
+			hasReturn = true
+			break
+		}
+	}
+	if hasReturn {
+		ctx.Code.WriteString("func main() {\n")
+		for _, stmt := range mod.Body {
+			EmitStmt(stmt, ctx)
+		}
+		ctx.Code.WriteString("}\n")
+	} else {
+		for _, stmt := range mod.Body {
+			EmitStmt(stmt, ctx)
+		}
+	}
+	body := ctx.Code.String()
+	ctx.Code = out
+	if ctx.usesAssert {
+		// Ahead of the first //line directive, so it keeps its Go lines
+		body = assertSupport + body
+	}
+	if ctx.usesPrint {
+		body = printSupport + body
+	}
+
 	ctx.Code.WriteString(fmt.Sprintf("package %s\n\n", ctx.PackageName))
 
-	// Add fmt import if needed for print()
-	hasPrint := true // FORCE TRUE for debugging
+	// Add fmt import if needed for print() and assert
+	hasPrint := ctx.usesAssert
 	for _, stmt := range mod.Body {
 		if ContainsPrint(stmt) {
 			hasPrint = true
@@ -31,45 +71,97 @@ func EmitModule(mod *ast.Module, ctx *GenContext) string {
 		}
 	}
 
-	for _, imp := range mod.Imports {
-		ctx.Code.WriteString(fmt.Sprintf("import \"%s\"\n", imp.Path))
-	}
-	// Check if any top-level statement is a ReturnStmt
-	hasReturn := false
-	for _, stmt := range mod.Body {
-		if _, ok := stmt.(*ast.ReturnStmt); ok {
-			hasReturn = true
-			break
-		}
-	}
-	if hasReturn {
-		ctx.Code.WriteString("func main() {\n")
-		for _, stmt := range mod.Body {
-			EmitStmt(stmt, ctx)
+	if ctx.GoImports == nil {
+		for _, imp := range mod.Imports {
+			if sem.IsRayoImport(imp.Path) {
+				continue
+			}
+			if imp.Alias != "" {
+				ctx.Code.WriteString(fmt.Sprintf("import %s \"%s\"\n", imp.Alias, imp.Path))
+			} else {
+				ctx.Code.WriteString(fmt.Sprintf("import \"%s\"\n", imp.Path))
+			}
 		}
-		ctx.Code.WriteString("}\n")
 	} else {
-		for _, stmt := range mod.Body {
-			EmitStmt(stmt, ctx)
+		// Resolved Go packages are imported only when referenced, since
+		// Go rejects unused imports
+		for _, alias := range ctx.GoImports.Aliases() {
+			pkg := ctx.GoImports.Packages[alias]
+			if !ctx.used[alias] {
+				continue
+			}
+			if alias == pkg.Name {
+				ctx.Code.WriteString(fmt.Sprintf("import \"%s\"\n", pkg.Path))
+			} else {
+				ctx.Code.WriteString(fmt.Sprintf("import %s \"%s\"\n", alias, pkg.Path))
+			}
+		}
+	}
+	// Rayo modules are likewise imported only when referenced
+	aliases := make([]string, 0, len(ctx.Modules))
+	for alias := range ctx.Modules {
+		if ctx.used[alias] {
+			aliases = append(aliases, alias)
 		}
 	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		ctx.Code.WriteString(fmt.Sprintf("import %s \"%s\"\n", alias, ctx.Modules[alias]))
+	}
+	ctx.Code.WriteString(body)
 	return ctx.Code.String()
 }
 
+// lineDirective maps the next line of generated code to Rayo source line
+// line with a //line directive, unless it already maps there or ctx has no
+// source file.
+func (ctx *GenContext) lineDirective(line int) {
+	if ctx.File == "" || line <= 0 {
+		return
+	}
+	if ctx.lineBase > 0 && ctx.lineBase+strings.Count(ctx.Code.String()[ctx.lineOff:], "\n") == line {
+		return
+	}
+	fmt.Fprintf(ctx.Code, "//line %s:%d\n", ctx.File, line)
+	ctx.lineBase, ctx.lineOff = line, ctx.Code.Len()
+}
+
 func EmitStmt(stmt ast.Stmt, ctx *GenContext) {
+	ctx.lineDirective(stmt.Span().Start.Line)
 	switch s := stmt.(type) {
 	case *ast.FuncDef:
-		ctx.Code.WriteString(fmt.Sprintf("func %s() {\n", s.Name))
+		result := ""
+		if returnsValue(s.Body) {
+			result = " any"
+		}
+		ctx.Code.WriteString(fmt.Sprintf("func %s()%s {\n", ctx.name(s.Name), result))
+		ctx.pushScope()
+		ctx.hoist(s.Body)
 		for _, bodyStmt := range s.Body {
 			EmitStmt(bodyStmt, ctx)
 		}
+		ctx.popScope()
+		// Go reports a missing return at the closing brace.
+		ctx.lineDirective(s.Span().End.Line)
 		ctx.Code.WriteString("}\n")
 	case *ast.VarStmt:
-		ctx.Code.WriteString(fmt.Sprintf("var %s = %s\n", s.Name, emitExpr(s.Value, ctx)))
+		if len(ctx.scopes) == 1 {
+			ctx.types[s.Name] = sem.InferTypeIn(s.Value, ctx.types)
+		}
+		// A Rayo variable belongs to its function, so declaring it again
+		// in the same function rebinds it
+		if ctx.declaredLocal(s.Name) {
+			ctx.Code.WriteString(fmt.Sprintf("%s = %s\n", ctx.name(s.Name), emitExpr(s.Value, ctx)))
+			break
+		}
+		ctx.Code.WriteString(fmt.Sprintf("var %s = %s\n", ctx.name(s.Name), emitExpr(s.Value, ctx)))
+		ctx.declare(s.Name)
 	case *ast.AssignStmt:
-		// Simple strategy: use := for Name targets (assuming declaration), = for others
-		if _, ok := s.Target.(*ast.Name); ok {
+		// Assigning a name declares it, with :=, unless an enclosing block
+		// already has; other targets are plainly assigned
+		if name, ok := s.Target.(*ast.Name); ok && !ctx.declared(name.Ident) {
 			ctx.Code.WriteString(fmt.Sprintf("%s := %s\n", emitExpr(s.Target, ctx), emitExpr(s.Value, ctx)))
+			ctx.declare(name.Ident)
 		} else {
 			ctx.Code.WriteString(fmt.Sprintf("%s = %s\n", emitExpr(s.Target, ctx), emitExpr(s.Value, ctx)))
 		}
@@ -79,16 +171,31 @@ func EmitStmt(stmt ast.Stmt, ctx *GenContext) {
 		// Go requires bool expression. Rayo might allow implicit bool (e.g. len(args)).
 		// For now assume strictly bool or compatible expressions.
 		ctx.Code.WriteString(fmt.Sprintf("if %s {\n", emitExpr(s.Cond, ctx)))
+		ctx.pushScope()
 		for _, st := range s.Then {
 			EmitStmt(st, ctx)
 		}
+		ctx.popScope()
+		for _, elif := range s.Elifs {
+			ctx.Code.WriteString(fmt.Sprintf("} else if %s {\n", emitExpr(elif.Cond, ctx)))
+			ctx.pushScope()
+			for _, st := range elif.Body {
+				EmitStmt(st, ctx)
+			}
+			ctx.popScope()
+		}
 		if len(s.Else) > 0 {
 			ctx.Code.WriteString("} else {\n")
+			ctx.pushScope()
 			for _, st := range s.Else {
 				EmitStmt(st, ctx)
 			}
+			ctx.popScope()
 		}
+		ctx.lineDirective(s.Span().End.Line)
 		ctx.Code.WriteString("}\n")
+	case *ast.AssertStmt:
+		emitAssert(s, ctx)
 	case *ast.ReturnStmt:
 		if s.Value != nil {
 			ctx.Code.WriteString(fmt.Sprintf("return %s\n", emitExpr(s.Value, ctx)))
@@ -101,6 +208,9 @@ func EmitStmt(stmt ast.Stmt, ctx *GenContext) {
 func emitExpr(expr ast.Expr, ctx *GenContext) string {
 	switch e := expr.(type) {
 	case *ast.Literal:
+		if e.Value == nil {
+			return "nil"
+		}
 		if s, ok := e.Value.(string); ok {
 			// Check if it looks like a number (hacky check but works for "2")
 			// Or check the parser logic. Parser stores TokenNumber value as string.
@@ -131,16 +241,22 @@ func emitExpr(expr ast.Expr, ctx *GenContext) string {
 		}
 		return fmt.Sprintf("%v", e.Value)
 	case *ast.Name:
-		return e.Ident
+		if goBool[e.Ident] != "" && !ctx.declared(e.Ident) {
+			return goBool[e.Ident]
+		}
+		return ctx.name(e.Ident)
 	case *ast.BinaryOp:
 		return fmt.Sprintf("(%s %s %s)", emitExpr(e.Left, ctx), e.Op, emitExpr(e.Right, ctx))
 	case *ast.Call:
 		funcName := emitExpr(e.Func, ctx)
 		if funcName == "print" {
-			funcName = "fmt.Println"
+			funcName = "rayoPrint"
+			ctx.usesPrint = true
 		}
-		if funcName == "os.Args" {
-			return "os.Args"
+		// Rayo reads Go package variables and constants with call syntax,
+		// e.g. os.Args(); Go spells that as a plain selector.
+		if _, sym := sem.PackageSymbol(e.Func, ctx.GoImports); sym != nil && !sym.Callable() && len(e.Args) == 0 {
+			return funcName
 		}
 
 		var argsStr string
@@ -154,8 +270,99 @@ func emitExpr(expr ast.Expr, ctx *GenContext) string {
 	case *ast.Index:
 		return fmt.Sprintf("%s[%s]", emitExpr(e.Target, ctx), emitExpr(e.Index, ctx))
 	case *ast.Attr:
+		if name, ok := e.Target.(*ast.Name); ok {
+			if ctx.GoImports != nil && ctx.GoImports.Packages[name.Ident] != nil {
+				ctx.useModule(name.Ident)
+				return name.Ident + "." + e.Attr
+			}
+			if _, ok := ctx.Modules[name.Ident]; ok {
+				ctx.useModule(name.Ident)
+				return name.Ident + "." + ExportName(e.Attr)
+			}
+		}
 		return fmt.Sprintf("%s.%s", emitExpr(e.Target, ctx), e.Attr)
 	default:
 		return "<expr>"
 	}
 }
+
+// returnsValue reports whether a function body returns a value, which makes
+// the generated Go function return any.
+func returnsValue(body []ast.Stmt) bool {
+	v := &returnFinder{}
+	for _, stmt := range body {
+		ast.Walk(v, stmt)
+	}
+	return v.found
+}
+
+type returnFinder struct {
+	found bool
+}
+
+func (v *returnFinder) Visit(n ast.Node) bool {
+	switch x := n.(type) {
+	case *ast.ReturnStmt:
+		if x.Value != nil {
+			v.found = true
+		}
+	case *ast.FuncDef, *ast.Lambda:
+		// Nested functions have their own returns
+		return false
+	}
+	return !v.found
+}
+
+// goBool maps Rayo's boolean constants to Go's.
+var goBool = map[string]string{"True": "true", "False": "false"}
+
+// goTypes maps the inferred types of Rayo values to Go types.
+var goTypes = map[string]string{"int": "int", "float": "float64", "str": "string", "bool": "bool"}
+
+// hoist declares at the top of a function body the variables first bound
+// inside a nested block. A Rayo variable belongs to its function rather
+// than to the block, so it stays bound after the block ends, where a Go
+// variable declared in the block would be out of scope. Each is declared
+// with the type inferred from its first binding, or any.
+func (ctx *GenContext) hoist(body []ast.Stmt) {
+	env := map[string]sem.Type{"True": &sem.BasicType{Name: "bool"}, "False": &sem.BasicType{Name: "bool"}}
+	for name, t := range ctx.types {
+		env[name] = t
+	}
+	bound := map[string]bool{}
+	var visit func(stmts []ast.Stmt, nested bool)
+	visit = func(stmts []ast.Stmt, nested bool) {
+		for _, stmt := range stmts {
+			switch s := stmt.(type) {
+			case *ast.VarStmt, *ast.AssignStmt:
+				name, value := "", ast.Expr(nil)
+				if v, ok := s.(*ast.VarStmt); ok {
+					name, value = v.Name, v.Value
+				} else if target, ok := s.(*ast.AssignStmt).Target.(*ast.Name); ok {
+					name, value = target.Ident, s.(*ast.AssignStmt).Value
+				}
+				if name == "" || bound[name] {
+					continue
+				}
+				bound[name] = true
+				env[name] = sem.InferTypeIn(value, env)
+				if !nested || ctx.declared(name) {
+					continue
+				}
+				goType := "any"
+				if t, ok := env[name].(*sem.BasicType); ok && goTypes[t.Name] != "" {
+					goType = goTypes[t.Name]
+				}
+				fmt.Fprintf(ctx.Code, "var %s %s\n_ = %s\n", name, goType, name)
+				ctx.declare(name)
+			case *ast.IfStmt:
+				visit(s.Then, true)
+				for _, elif := range s.Elifs {
+					visit(elif.Body, true)
+				}
+				visit(s.Else, true)
+			}
+		}
+	}
+	visit(body, false)
+}
@@ -2,6 +2,10 @@ package gen
 
 import (
     "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "rayo/internal/sem"
 )
 
 // GenContext holds state for code generation.
@@ -10,6 +14,33 @@ type GenContext struct {
     Imports     []string
     TempVarIdx  int
     Code        *strings.Builder
+    // GoImports is the resolved Go package namespace of the module, letting
+    // the emitter tell variables from functions. When nil, Go imports are
+    // emitted as written.
+    GoImports *sem.GoImports
+    // Modules maps the local names of imported Rayo modules to the Go
+    // import paths of the packages generated for them.
+    Modules map[string]string
+    // Names renames top-level identifiers: exported definitions of library
+    // modules and names brought in with `from ... import`.
+    Names map[string]string
+    // File is the path of the Rayo source file. When set, the generated
+    // code carries //line directives, so that Go compiler errors, panics
+    // and stack traces refer to lines of File rather than of the Go code.
+    File string
+    // StripAsserts leaves out the checks of assert statements, as -O does.
+    StripAsserts bool
+    used         map[string]bool
+    usesAssert   bool
+    usesPrint    bool
+    // types holds the inferred types of the package-level variables.
+    types map[string]sem.Type
+    // scopes holds the names declared in each enclosing Go block, the
+    // package block first.
+    scopes []map[string]bool
+    // lineBase is the Rayo line given by the last //line directive and
+    // lineOff the offset in Code just after it.
+    lineBase, lineOff int
 }
 
 func NewGenContext(pkg string) *GenContext {
@@ -20,3 +51,82 @@ func (ctx *GenContext) NewTempVar() string {
     ctx.TempVarIdx++
     return "_tmp" + string(rune(ctx.TempVarIdx+48))
 }
+
+// ExportName returns the exported Go identifier used for a top-level Rayo
+// name defined in a library module.
+func ExportName(name string) string {
+    if name == "" {
+        return name
+    }
+    r, size := utf8.DecodeRuneInString(name)
+    if !unicode.IsLetter(r) {
+        return "X" + name
+    }
+    return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// useModule records that the generated code references an imported Rayo
+// module or Go package.
+func (ctx *GenContext) useModule(alias string) {
+    if ctx.used == nil {
+        ctx.used = map[string]bool{}
+    }
+    ctx.used[alias] = true
+}
+
+// pushScope opens a Go block.
+func (ctx *GenContext) pushScope() {
+    ctx.scopes = append(ctx.scopes, map[string]bool{})
+}
+
+// popScope closes the innermost Go block, forgetting its declarations.
+func (ctx *GenContext) popScope() {
+    ctx.scopes = ctx.scopes[:len(ctx.scopes)-1]
+}
+
+// declare records that name is declared in the innermost Go block.
+func (ctx *GenContext) declare(name string) {
+    if len(ctx.scopes) == 0 {
+        ctx.pushScope()
+    }
+    ctx.scopes[len(ctx.scopes)-1][name] = true
+}
+
+// declared reports whether name is declared in an enclosing Go block.
+func (ctx *GenContext) declared(name string) bool {
+    for _, scope := range ctx.scopes {
+        if scope[name] {
+            return true
+        }
+    }
+    return false
+}
+
+// declaredLocal reports whether name is declared in a Go block of the
+// enclosing function, rather than at package level.
+func (ctx *GenContext) declaredLocal(name string) bool {
+    for _, scope := range ctx.scopes[1:] {
+        if scope[name] {
+            return true
+        }
+    }
+    return false
+}
+
+// name returns the Go spelling of a top-level Rayo identifier.
+func (ctx *GenContext) name(ident string) string {
+    if ctx.GoImports != nil {
+        if ref, ok := ctx.GoImports.Names[ident]; ok {
+            ctx.useModule(ref.Package)
+            return ref.Package + "." + ref.Symbol.Name
+        }
+    }
+    goName, ok := ctx.Names[ident]
+    if !ok {
+        return ident
+    }
+    if i := strings.IndexByte(goName, '.'); i > 0 {
+        ctx.useModule(goName[:i])
+    }
+    return goName
+}
@@ -0,0 +1,343 @@
+//go:build go1.18
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"rayo/internal/ast"
+	"rayo/internal/diff"
+	"rayo/internal/interp"
+	"rayo/internal/parse"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// FuzzDifferential generates a random well-typed Rayo program from each
+// seed, compiles it with the Go toolchain and compares its output with that
+// of the interpreter, which serves as reference semantics. Any difference
+// is a miscompilation.
+// The seed corpus runs with go test; go test -fuzz=FuzzDifferential
+// searches further.
+func FuzzDifferential(f *testing.F) {
+	if testing.Short() {
+		f.Skip("not compiling generated programs in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		f.Skip("go toolchain not found")
+	}
+	for seed := int64(1); seed <= 64; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		t.Parallel()
+		src := parse.PrettyPrint(genProgram(seed))
+		p := parse.NewParser(src)
+		mod := p.ParseModule()
+		if errs := p.Errors(); len(errs) > 0 {
+			t.Fatalf("seed %d: generated program does not parse: %v\n%s", seed, errs[0], src)
+		}
+		want, err := refRun(mod)
+		if err != nil {
+			t.Fatalf("seed %d: reference evaluator: %v\n%s", seed, err, src)
+		}
+		code := EmitModule(mod, NewGenContext("main"))
+		got, err := goRun(t, code)
+		if err != nil {
+			t.Fatalf("seed %d: %v\nprogram:\n%s\ngenerated Go:\n%s", seed, err, src, code)
+		}
+		if d := diff.Unified("reference", "go", want, got); d != "" {
+			t.Errorf("seed %d: miscompiled\n%s\nprogram:\n%s\ngenerated Go:\n%s", seed, d, src, code)
+		}
+	})
+}
+
+// goRun builds and runs a generated Go main package, returning its output.
+func goRun(t *testing.T, code string) (string, error) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module fuzzprog\n\ngo 1.22\n"), 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0644); err != nil {
+		return "", err
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("go run: %v\n%s", err, stderr.Bytes())
+	}
+	return stdout.String(), nil
+}
+
+// A rayoType is a type of the generated programs.
+type rayoType int
+
+const (
+	tInt rayoType = iota
+	tStr
+	tBool
+)
+
+// progGen generates random programs from the subset of Rayo the backend
+// supports: top-level variables, functions without parameters, var
+// declarations, assignments, if/else, print, comparisons and len over
+// ints, strings and bools. Every variable is printed at the end of the
+// block declaring it, so each is used and its final value checked.
+// Functions only assign their own locals.
+//
+// Rayo variables belong to the function rather than the block, which the
+// generator exercises in two ways: a block may bind a name that an earlier,
+// closed block bound, and both branches of an if may bind a new name that
+// is then used after the if.
+type progGen struct {
+	rnd    *rand.Rand
+	names  int
+	scopes []map[string]rayoType
+	// closed holds the variables of the current function whose blocks
+	// have ended. Rayo still binds them, but the generator only rebinds
+	// them, with a value of the same type.
+	closed map[string]rayoType
+	funcs  []string // functions callable from the one being generated
+	inMain bool
+	depth  int
+}
+
+func genProgram(seed int64) *ast.Module {
+	g := &progGen{rnd: rand.New(rand.NewSource(seed)), scopes: []map[string]rayoType{{}}}
+	mod := &ast.Module{}
+	for i := g.rnd.Intn(3); i > 0; i-- {
+		t := g.typ()
+		value := g.expr(t, 2)
+		name := g.declare(t)
+		mod.Body = append(mod.Body, &ast.VarStmt{Name: name, Value: value})
+	}
+	for i := g.rnd.Intn(4); i > 0; i-- {
+		name := g.newName("f")
+		g.closed = map[string]rayoType{}
+		mod.Body = append(mod.Body, &ast.FuncDef{Name: name, Body: g.block(false)})
+		g.funcs = append(g.funcs, name)
+	}
+	g.inMain = true
+	g.closed = map[string]rayoType{}
+	mod.Body = append(mod.Body, &ast.FuncDef{Name: "main", Body: g.block(false)})
+	return mod
+}
+
+func (g *progGen) newName(prefix string) string {
+	g.names++
+	return prefix + strconv.Itoa(g.names)
+}
+
+func (g *progGen) typ() rayoType {
+	return rayoType(g.rnd.Intn(3))
+}
+
+// declare declares a variable of type t in the current block, half the
+// time reusing the name of one in a closed block.
+func (g *progGen) declare(t rayoType) string {
+	var reusable []string
+	for name, ct := range g.closed {
+		if ct == t {
+			reusable = append(reusable, name)
+		}
+	}
+	sort.Strings(reusable)
+	var name string
+	if len(reusable) > 0 && g.rnd.Intn(2) == 0 {
+		name = reusable[g.rnd.Intn(len(reusable))]
+		delete(g.closed, name)
+	} else {
+		name = g.newName("v")
+	}
+	g.scopes[len(g.scopes)-1][name] = t
+	return name
+}
+
+// vars returns the variables of type t in scope; locals only unless
+// globals is set.
+func (g *progGen) vars(t rayoType, globals bool) []string {
+	var names []string
+	start := 1
+	if globals {
+		start = 0
+	}
+	for _, scope := range g.scopes[start:] {
+		for name, vt := range scope {
+			if vt == t {
+				names = append(names, name)
+			}
+		}
+	}
+	// Map order is random; the program must depend on the seed alone.
+	sort.Strings(names)
+	return names
+}
+
+// block generates the statements of a block. canReturn allows it to end
+// with a return.
+func (g *progGen) block(canReturn bool) []ast.Stmt {
+	g.scopes = append(g.scopes, map[string]rayoType{})
+	g.depth++
+	var body []ast.Stmt
+	for i := 1 + g.rnd.Intn(5); i > 0; i-- {
+		body = append(body, g.stmt())
+	}
+	var declared []string
+	for name := range g.scopes[len(g.scopes)-1] {
+		declared = append(declared, name)
+	}
+	sort.Strings(declared)
+	for _, name := range declared {
+		body = append(body, printStmt(&ast.Name{Ident: name}))
+		if g.depth > 1 {
+			g.closed[name] = g.scopes[len(g.scopes)-1][name]
+		}
+	}
+	if canReturn && g.rnd.Intn(3) == 0 {
+		body = append(body, &ast.ReturnStmt{})
+	}
+	g.depth--
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	return body
+}
+
+func (g *progGen) stmt() ast.Stmt {
+	for {
+		switch g.rnd.Intn(6) {
+		case 0:
+			t := g.typ()
+			value := g.expr(t, 3)
+			return &ast.VarStmt{Name: g.declare(t), Value: value}
+		case 1:
+			t := g.typ()
+			value := g.expr(t, 3)
+			return &ast.AssignStmt{Target: &ast.Name{Ident: g.declare(t)}, Value: value}
+		case 2:
+			t := g.typ()
+			if vars := g.vars(t, false); len(vars) > 0 {
+				return &ast.AssignStmt{Target: &ast.Name{Ident: vars[g.rnd.Intn(len(vars))]}, Value: g.expr(t, 3)}
+			}
+		case 3:
+			var args []ast.Expr
+			for i := 1 + g.rnd.Intn(3); i > 0; i-- {
+				args = append(args, g.expr(g.typ(), 3))
+			}
+			return printStmt(args...)
+		case 4:
+			if g.depth < 4 {
+				// Only functions other than main return early, so that
+				// main always runs to its end.
+				s := &ast.IfStmt{Cond: g.cond(), Then: g.block(!g.inMain)}
+				if g.rnd.Intn(2) == 0 {
+					s.Else = g.block(!g.inMain)
+					if g.rnd.Intn(2) == 0 {
+						g.bindInBranches(s)
+					}
+				}
+				return s
+			}
+		case 5:
+			if len(g.funcs) > 0 {
+				name := g.funcs[g.rnd.Intn(len(g.funcs))]
+				return &ast.ExprStmt{Expr: &ast.Call{Func: &ast.Name{Ident: name}}}
+			}
+		}
+	}
+}
+
+// bindInBranches makes every branch of s, which has an else, start by
+// binding the same new variable, which stays bound after s.
+func (g *progGen) bindInBranches(s *ast.IfStmt) {
+	t := g.typ()
+	name := g.newName("v")
+	bind := func(body []ast.Stmt) []ast.Stmt {
+		return append([]ast.Stmt{&ast.AssignStmt{Target: &ast.Name{Ident: name}, Value: g.expr(t, 2)}}, body...)
+	}
+	s.Then = bind(s.Then)
+	s.Else = bind(s.Else)
+	g.scopes[len(g.scopes)-1][name] = t
+}
+
+func (g *progGen) cond() ast.Expr {
+	return g.compare(2)
+}
+
+// compare generates a comparison of two expressions of the same type.
+// Bools are only compared for equality, and only as variables or
+// constants: the parser gives all comparison operators the same
+// precedence, so a nested comparison would not print as it parses.
+func (g *progGen) compare(depth int) ast.Expr {
+	ops := []string{"<", ">", "==", "!="}
+	t := g.typ()
+	if t == tBool {
+		ops, depth = ops[2:], 1
+	}
+	return &ast.BinaryOp{Op: ops[g.rnd.Intn(len(ops))], Left: g.expr(t, depth-1), Right: g.expr(t, depth-1)}
+}
+
+func (g *progGen) expr(t rayoType, depth int) ast.Expr {
+	choice := g.rnd.Intn(4)
+	if depth == 0 {
+		choice %= 2
+	}
+	switch choice {
+	case 1:
+		if vars := g.vars(t, true); len(vars) > 0 {
+			return &ast.Name{Ident: vars[g.rnd.Intn(len(vars))]}
+		}
+	case 2, 3:
+		if t == tBool {
+			return g.compare(depth)
+		}
+	}
+	switch choice {
+	case 2:
+		op := "+"
+		if t == tInt && g.rnd.Intn(2) == 0 {
+			op = "-"
+		}
+		return &ast.BinaryOp{Op: op, Left: g.expr(t, depth-1), Right: g.expr(t, depth-1)}
+	case 3:
+		if t == tInt {
+			return &ast.Call{Func: &ast.Name{Ident: "len"}, Args: []ast.Expr{g.expr(tStr, depth-1)}}
+		}
+	}
+	switch t {
+	case tInt:
+		return &ast.Literal{Value: g.rnd.Intn(100)}
+	case tBool:
+		return &ast.Name{Ident: [...]string{"False", "True"}[g.rnd.Intn(2)]}
+	}
+	const letters = "abcxyz "
+	b := make([]byte, g.rnd.Intn(4))
+	for i := range b {
+		b[i] = letters[g.rnd.Intn(len(letters))]
+	}
+	return &ast.Literal{Value: string(b)}
+}
+
+func printStmt(args ...ast.Expr) ast.Stmt {
+	return &ast.ExprStmt{Expr: &ast.Call{Func: &ast.Name{Ident: "print"}, Args: args}}
+}
+
+// refRun runs mod's main function with the interpreter, the reference
+// semantics, and returns what it prints.
+func refRun(mod *ast.Module) (string, error) {
+	var out strings.Builder
+	in := interp.New()
+	in.Stdout = &out
+	m, err := in.ExecModule("main", mod, nil)
+	if err == nil {
+		err = in.CallMain(m)
+	}
+	return out.String(), err
+}
@@ -1,7 +1,14 @@
 package gen
 
 import (
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"os/exec"
 	"rayo/internal/ast"
+	"rayo/internal/diag"
+	"rayo/internal/parse"
+	"rayo/internal/sem"
 	"strings"
 	"testing"
 )
@@ -25,3 +32,167 @@ func TestEmitModule(t *testing.T) {
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+func TestEmitPackageVariableRead(t *testing.T) {
+	mod := &ast.Module{
+		Imports: []*ast.Import{{Path: "os"}},
+		Body: []ast.Stmt{
+			&ast.VarStmt{Name: "args", Value: &ast.Call{Func: &ast.Attr{Target: &ast.Name{Ident: "os"}, Attr: "Args"}}},
+			&ast.VarStmt{Name: "wd", Value: &ast.Call{Func: &ast.Attr{Target: &ast.Name{Ident: "os"}, Attr: "Getwd"}}},
+		},
+	}
+	ctx := NewGenContext("main")
+	ctx.GoImports = sem.ResolveImports(mod, sem.NewGoImporter("."), nopReporter{})
+	code := EmitModule(mod, ctx)
+	if !contains(code, "var args = os.Args\n") || !contains(code, "var wd = os.Getwd()\n") {
+		t.Errorf("package selectors emitted incorrectly: %s", code)
+	}
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Report(diag.Span, string) {}
+
+func TestEmitGoImportAliases(t *testing.T) {
+	p := parse.NewParser("import \"strings\" as str\nimport \"os\"\nfrom \"os\" import Args as argv, Getenv\nvar a = str.ToUpper(\"x\")\nvar b = argv()\nvar c = Getenv(\"HOME\")")
+	mod := p.ParseModule()
+	ctx := NewGenContext("main")
+	ctx.GoImports = sem.ResolveImports(mod, sem.NewGoImporter("."), nopReporter{})
+	code := EmitModule(mod, ctx)
+	for _, want := range []string{"import \"os\"\n", "import str \"strings\"\n", "var a = str.ToUpper(\"x\")\n", "var b = os.Args\n", "var c = os.Getenv(\"HOME\")\n"} {
+		if !contains(code, want) {
+			t.Errorf("missing %q in:\n%s", want, code)
+		}
+	}
+}
+
+func TestEmitAssignDeclaresOnce(t *testing.T) {
+	src := "var g = 1\ndef main() {\n    x = 1\n    x = 2\n    g = x\n    if x == 2 {\n        x = 3\n        y = 4\n    } else {\n        y = 5\n    }\n    y = 6\n}\n"
+	code := EmitModule(parse.NewParser(src).ParseModule(), NewGenContext("main"))
+	// y is first bound inside the if, so it is declared at the top of
+	// the function, which it belongs to in Rayo, and stays bound after it.
+	want := "var g = 1\nfunc main() {\nvar y int\n_ = y\nx := 1\nx = 2\ng = x\nif (x == 2) {\nx = 3\ny = 4\n} else {\ny = 5\n}\ny = 6\n}\n"
+	if !strings.HasSuffix(code, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", code, want)
+	}
+}
+
+func TestEmitLineDirectives(t *testing.T) {
+	src := "def main() {\n    x = 1\n\n    if x == 1 {\n        print(x)\n    }\n}\n"
+	mod := parse.NewParser(src).ParseModule()
+	ctx := NewGenContext("main")
+	ctx.File = "/src/hello.ryo"
+	code := EmitModule(mod, ctx)
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, "main.go", code, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, code)
+	}
+	// The Go position of each construct of main, as the compiler would
+	// report it.
+	var got []string
+	main := file.Scope.Lookup("main").Decl.(*goast.FuncDecl)
+	goast.Inspect(main, func(n goast.Node) bool {
+		switch n.(type) {
+		case *goast.FuncDecl, *goast.AssignStmt, *goast.IfStmt, *goast.CallExpr:
+			got = append(got, fset.Position(n.Pos()).String())
+		case *goast.BlockStmt:
+			got = append(got, "} "+fset.Position(n.End()-1).String())
+		}
+		return true
+	})
+	want := []string{
+		"/src/hello.ryo:1",   // func main
+		"} /src/hello.ryo:7", // its closing brace
+		"/src/hello.ryo:2",   // x := 1
+		"/src/hello.ryo:4",   // if
+		"} /src/hello.ryo:6",
+		"/src/hello.ryo:5", // print(x)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("positions:\n%s\nwant:\n%s\ncode:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"), code)
+	}
+	// Lines that follow on from the previous one need no directive.
+	if n := strings.Count(code, "//line "); n != 2 {
+		t.Errorf("got %d directives, want 2:\n%s", n, code)
+	}
+	if code := EmitModule(mod, NewGenContext("main")); strings.Contains(code, "//line") {
+		t.Errorf("directives emitted without a source file:\n%s", code)
+	}
+}
+
+func TestEmitTestFile(t *testing.T) {
+	mod := parse.NewParser("def helper() {\n}\ndef test_a() {\n}\ndef testing() {\n}\ndef test_b() {\n}\n").ParseModule()
+	tests := TestFuncs(mod)
+	if len(tests) != 2 || tests[0].Name != "test_a" || tests[1].Name != "test_b" {
+		t.Fatalf("TestFuncs found %v", tests)
+	}
+	code := EmitTestFile("main", tests, "/src")
+	if _, err := goparser.ParseFile(token.NewFileSet(), "rayo_test.go", code, 0); err != nil {
+		t.Fatalf("test file does not parse: %v\n%s", err, code)
+	}
+	for _, want := range []string{"func Test_test_a(t *testing.T) {\n\trayoRunTest(t, func() { test_a() })\n}\n", "func Test_test_b(", "const rayoRoot = \"/src\"\n"} {
+		if !contains(code, want) {
+			t.Errorf("missing %q in:\n%s", want, code)
+		}
+	}
+}
+
+func TestEmitAssert(t *testing.T) {
+	src := "def main() {\n    x = 3\n    assert x + 1 == 5\n    assert x, \"x is set\"\n}\n"
+	for _, strip := range []bool{false, true} {
+		ctx := NewGenContext("main")
+		ctx.File = "/src/a.ryo"
+		ctx.StripAsserts = strip
+		code := EmitModule(parse.NewParser(src).ParseModule(), ctx)
+		fset := token.NewFileSet()
+		file, err := goparser.ParseFile(fset, "main.go", code, 0)
+		if err != nil {
+			t.Fatalf("generated code does not parse: %v\n%s", err, code)
+		}
+		var ifs []string
+		goast.Inspect(file, func(n goast.Node) bool {
+			if n, ok := n.(*goast.IfStmt); ok && fset.Position(n.Pos()).Filename == ctx.File {
+				ifs = append(ifs, fset.Position(n.Pos()).String()+" "+fset.Position(n.End()).String())
+			}
+			return true
+		})
+		// Each assert is one line, so that it fails at its Rayo line.
+		if want := "/src/a.ryo:3 /src/a.ryo:3\n/src/a.ryo:4 /src/a.ryo:4"; strings.Join(ifs, "\n") != want {
+			t.Errorf("strip=%v: asserts at %q, want %q\n%s", strip, ifs, want, code)
+		}
+		if strip == contains(code, "AssertionError") {
+			t.Errorf("strip=%v: AssertionError emitted %v:\n%s", strip, !strip, code)
+		}
+	}
+	code := EmitModule(parse.NewParser(src).ParseModule(), NewGenContext("main"))
+	for _, want := range []string{
+		`if rayoL := (x + 1); !(rayoL == 5) { panic(&AssertionError{Msg: "assert x + 1 == 5" + ": " + rayoRepr(rayoL) + " != " + rayoRepr(5) + ", where " + rayoRepr(rayoL) + " = x + 1"}) }`,
+		`if !(x) { panic(&AssertionError{Msg: fmt.Sprint("x is set")}) }`,
+		"import \"fmt\"\n",
+	} {
+		if !contains(code, want) {
+			t.Errorf("missing %q in:\n%s", want, code)
+		}
+	}
+}
+
+func TestEmitAssertConstants(t *testing.T) {
+	if testing.Short() {
+		t.Skip("not compiling generated programs in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	// Constants take the type of the other operand, as in Go: 2 compares
+	// with a float and None with any value
+	src := "import \"math\"\ndef none() {\n    return None\n}\ndef main() {\n    assert math.Sqrt(4) == 2\n    assert none() == None\n    assert math.Sqrt(4) == 3\n}\n"
+	mod := parse.NewParser(src).ParseModule()
+	ctx := NewGenContext("main")
+	ctx.GoImports = sem.ResolveImports(mod, sem.NewGoImporter("."), nopReporter{})
+	code := EmitModule(mod, ctx)
+	_, err := goRun(t, code)
+	if want := "AssertionError: assert math.Sqrt(4) == 3: 2 != 3, where 2 = math.Sqrt(4)"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want a failure with %q\n%s", err, want, code)
+	}
+}
@@ -0,0 +1,23 @@
+package gen
+
+// printSupport is emitted into packages that call print. rayoPrint prints
+// None and booleans the way Rayo spells them rather than as nil, true and
+// false.
+const printSupport = `// rayoPrint writes its arguments as Rayo's print does.
+func rayoPrint(args ...any) {
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case nil:
+			args[i] = "None"
+		case bool:
+			if arg {
+				args[i] = "True"
+			} else {
+				args[i] = "False"
+			}
+		}
+	}
+	fmt.Println(args...)
+}
+
+`
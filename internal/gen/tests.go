@@ -0,0 +1,78 @@
+package gen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rayo/internal/ast"
+)
+
+// TestPrefix starts the names of Rayo test functions.
+const TestPrefix = "test_"
+
+// TestFuncs returns the test functions of mod: its top-level functions
+// named test_*, in source order.
+func TestFuncs(mod *ast.Module) []*ast.FuncDef {
+	var tests []*ast.FuncDef
+	for _, stmt := range mod.Body {
+		if def, ok := stmt.(*ast.FuncDef); ok && strings.HasPrefix(def.Name, TestPrefix) {
+			tests = append(tests, def)
+		}
+	}
+	return tests
+}
+
+// TestName returns the name of the Go test function that runs the Rayo
+// test function name.
+func TestName(name string) string {
+	return "Test_" + name
+}
+
+// EmitTestFile emits a Go _test.go file for package pkg with a test
+// function running each of tests with the testing package. A test fails
+// when it panics; the failure is reported at the innermost Rayo line on
+// the stack, with the file name relative to the directory root.
+func EmitTestFile(pkg string, tests []*ast.FuncDef, root string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "package %s\n\n", pkg)
+	sb.WriteString("import (\n\t\"fmt\"\n\t\"path/filepath\"\n\t\"runtime\"\n\t\"strings\"\n\t\"testing\"\n)\n\n")
+	fmt.Fprintf(&sb, "const rayoRoot = %s\n", strconv.Quote(root))
+	for _, test := range tests {
+		fmt.Fprintf(&sb, "\nfunc %s(t *testing.T) {\n\trayoRunTest(t, func() { %s() })\n}\n", TestName(test.Name), test.Name)
+	}
+	sb.WriteString(testHarness)
+	return sb.String()
+}
+
+const testHarness = `
+// rayoRunTest runs a Rayo test function, failing t if it panics.
+func rayoRunTest(t *testing.T, test func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("%s%v", rayoPanicPos(), r)
+		}
+	}()
+	test()
+}
+
+// rayoPanicPos returns "file:line: " for the innermost Rayo frame of the
+// panicking goroutine, or "" if there is none.
+func rayoPanicPos() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		f, more := frames.Next()
+		if strings.HasSuffix(f.File, ".ryo") {
+			file := f.File
+			if rel, err := filepath.Rel(rayoRoot, file); err == nil {
+				file = filepath.ToSlash(rel)
+			}
+			return fmt.Sprintf("%s:%d: ", file, f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+`
@@ -0,0 +1,459 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rayo/internal/diag"
+	"rayo/runtime/dict"
+)
+
+// builtins are the functions every module sees.
+var builtins = map[string]func(in *Interp, args []any) (any, error){
+	"print":  builtinPrint,
+	"input":  builtinInput,
+	"len":    builtinLen,
+	"str":    unaryBuiltin("str", func(v any) (any, error) { return Str(v), nil }),
+	"repr":   unaryBuiltin("repr", func(v any) (any, error) { return Repr(v), nil }),
+	"bool":   unaryBuiltin("bool", func(v any) (any, error) { return Truthy(v), nil }),
+	"int":    unaryBuiltin("int", toInt),
+	"float":  unaryBuiltin("float", toFloatValue),
+	"type":   unaryBuiltin("type", func(v any) (any, error) { return TypeName(v), nil }),
+	"abs":    unaryBuiltin("abs", abs),
+	"range":  builtinRange,
+	"list":   builtinList,
+	"sorted": builtinSorted,
+	"sum":    builtinSum,
+	"min":    extremum("min", -1),
+	"max":    extremum("max", 1),
+}
+
+func arity(name string, args []any, min, max int) error {
+	if len(args) < min || len(args) > max {
+		want := strconv.Itoa(min)
+		if max != min {
+			want = fmt.Sprintf("%d to %d", min, max)
+		}
+		return &Exception{Type: "TypeError", Msg: fmt.Sprintf("%s() takes %s arguments but %d were given", name, want, len(args))}
+	}
+	return nil
+}
+
+func typeError(format string, args ...any) error {
+	return &Exception{Type: "TypeError", Msg: fmt.Sprintf(format, args...)}
+}
+
+func unaryBuiltin(name string, fn func(v any) (any, error)) func(*Interp, []any) (any, error) {
+	return func(in *Interp, args []any) (any, error) {
+		if err := arity(name, args, 1, 1); err != nil {
+			return nil, err
+		}
+		return fn(args[0])
+	}
+}
+
+func builtinPrint(in *Interp, args []any) (any, error) {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = Str(arg)
+	}
+	_, err := fmt.Fprintln(in.Stdout, strings.Join(parts, " "))
+	return nil, err
+}
+
+// builtinInput prints the prompt, if any, and reads a line of input
+// without its line ending.
+func builtinInput(in *Interp, args []any) (any, error) {
+	if err := arity("input", args, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		fmt.Fprint(in.Stdout, Str(args[0]))
+	}
+	if in.stdin == nil {
+		in.stdin = bufio.NewReader(in.Stdin)
+	}
+	line, err := in.stdin.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return nil, &Exception{Type: "EOFError", Msg: "end of input", Err: err}
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func builtinLen(in *Interp, args []any) (any, error) {
+	if err := arity("len", args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case string:
+		return len(v), nil
+	case *List:
+		return len(v.Elems), nil
+	case map[string]any:
+		return len(v), nil
+	}
+	return nil, typeError("%s has no len()", TypeName(args[0]))
+}
+
+func toInt(v any) (any, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, &Exception{Type: "ValueError", Msg: fmt.Sprintf("invalid literal for int(): %s", strconv.Quote(v))}
+		}
+		return i, nil
+	}
+	return nil, typeError("int() argument must be a string or a number, not %s", TypeName(v))
+}
+
+func toFloatValue(v any) (any, error) {
+	if f, ok := toFloat(v); ok {
+		return f, nil
+	}
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, &Exception{Type: "ValueError", Msg: fmt.Sprintf("could not convert string to float: %s", strconv.Quote(s))}
+		}
+		return f, nil
+	}
+	return nil, typeError("float() argument must be a string or a number, not %s", TypeName(v))
+}
+
+func abs(v any) (any, error) {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case float64:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	}
+	return nil, typeError("bad operand type for abs(): %s", TypeName(v))
+}
+
+// builtinRange returns range(stop), range(start, stop) or range(start,
+// stop, step) as a list.
+func builtinRange(in *Interp, args []any) (any, error) {
+	if err := arity("range", args, 1, 3); err != nil {
+		return nil, err
+	}
+	bounds := []int{0, 0, 1}
+	for i, arg := range args {
+		n, ok := arg.(int)
+		if !ok {
+			return nil, typeError("range() arguments must be int, not %s", TypeName(arg))
+		}
+		bounds[i] = n
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+	start, stop, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return nil, &Exception{Type: "ValueError", Msg: "range() step must not be zero"}
+	}
+	list := &List{}
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		list.Elems = append(list.Elems, i)
+	}
+	return list, nil
+}
+
+func builtinList(in *Interp, args []any) (any, error) {
+	if err := arity("list", args, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return &List{}, nil
+	}
+	items, err := iterate(args[0], diag.Span{})
+	if err != nil {
+		return nil, err
+	}
+	return &List{Elems: items}, nil
+}
+
+func builtinSorted(in *Interp, args []any) (any, error) {
+	if err := arity("sorted", args, 1, 1); err != nil {
+		return nil, err
+	}
+	items, err := iterate(args[0], diag.Span{})
+	if err != nil {
+		return nil, err
+	}
+	if err := sortValues(items); err != nil {
+		return nil, err
+	}
+	return &List{Elems: items}, nil
+}
+
+func sortValues(items []any) error {
+	var err error
+	sort.SliceStable(items, func(i, j int) bool {
+		c, cerr := compare(items[i], items[j], diag.Span{})
+		if cerr != nil && err == nil {
+			err = cerr
+		}
+		return c < 0
+	})
+	return err
+}
+
+func builtinSum(in *Interp, args []any) (any, error) {
+	if err := arity("sum", args, 1, 1); err != nil {
+		return nil, err
+	}
+	items, err := iterate(args[0], diag.Span{})
+	if err != nil {
+		return nil, err
+	}
+	var total any = 0
+	for _, item := range items {
+		if total, err = binary("+", total, item, diag.Span{}); err != nil {
+			return nil, err
+		}
+	}
+	return total, nil
+}
+
+// extremum returns min (sign -1) or max (sign 1), of a list or of several
+// arguments.
+func extremum(name string, sign int) func(*Interp, []any) (any, error) {
+	return func(in *Interp, args []any) (any, error) {
+		items := args
+		if len(args) == 1 {
+			var err error
+			if items, err = iterate(args[0], diag.Span{}); err != nil {
+				return nil, err
+			}
+		}
+		if len(items) == 0 {
+			return nil, &Exception{Type: "ValueError", Msg: name + "() of an empty sequence"}
+		}
+		best := items[0]
+		for _, item := range items[1:] {
+			c, err := compare(item, best, diag.Span{})
+			if err != nil {
+				return nil, err
+			}
+			if c*sign > 0 {
+				best = item
+			}
+		}
+		return best, nil
+	}
+}
+
+// newException returns the builtin constructing exceptions of type typ,
+// with an optional message.
+func newException(typ string) func(*Interp, []any) (any, error) {
+	return func(in *Interp, args []any) (any, error) {
+		if err := arity(typ, args, 0, 1); err != nil {
+			return nil, err
+		}
+		e := &Exception{Type: typ}
+		if len(args) == 1 {
+			e.Msg = Str(args[0])
+		}
+		return e, nil
+	}
+}
+
+// methods holds the builtin methods of lists, strings and dicts.
+var methods = map[string]map[string]func(in *Interp, recv any, args []any) (any, error){
+	"list": {
+		"append": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("append", args, 1, 1); err != nil {
+				return nil, err
+			}
+			l := recv.(*List)
+			l.Elems = append(l.Elems, args[0])
+			return nil, nil
+		},
+		"extend": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("extend", args, 1, 1); err != nil {
+				return nil, err
+			}
+			items, err := iterate(args[0], diag.Span{})
+			if err != nil {
+				return nil, err
+			}
+			l := recv.(*List)
+			l.Elems = append(l.Elems, items...)
+			return nil, nil
+		},
+		"pop": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("pop", args, 0, 1); err != nil {
+				return nil, err
+			}
+			l := recv.(*List)
+			var key any = -1
+			if len(args) == 1 {
+				key = args[0]
+			}
+			i, err := position(key, len(l.Elems), diag.Span{})
+			if err != nil {
+				return nil, err
+			}
+			v := l.Elems[i]
+			l.Elems = append(l.Elems[:i], l.Elems[i+1:]...)
+			return v, nil
+		},
+		"sort": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("sort", args, 0, 0); err != nil {
+				return nil, err
+			}
+			return nil, sortValues(recv.(*List).Elems)
+		},
+	},
+	"str": {
+		"upper": stringMethod(0, func(s string, args []any) (any, error) { return strings.ToUpper(s), nil }),
+		"lower": stringMethod(0, func(s string, args []any) (any, error) { return strings.ToLower(s), nil }),
+		"strip": stringMethod(0, func(s string, args []any) (any, error) { return strings.TrimSpace(s), nil }),
+		"startswith": stringMethod(1, func(s string, args []any) (any, error) {
+			return strings.HasPrefix(s, args[0].(string)), nil
+		}),
+		"endswith": stringMethod(1, func(s string, args []any) (any, error) {
+			return strings.HasSuffix(s, args[0].(string)), nil
+		}),
+		"replace": stringMethod(2, func(s string, args []any) (any, error) {
+			return strings.ReplaceAll(s, args[0].(string), args[1].(string)), nil
+		}),
+		"find": stringMethod(1, func(s string, args []any) (any, error) {
+			return strings.Index(s, args[0].(string)), nil
+		}),
+		"split": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("split", args, 0, 1); err != nil {
+				return nil, err
+			}
+			var parts []string
+			if len(args) == 0 {
+				parts = strings.Fields(recv.(string))
+			} else if sep, ok := args[0].(string); ok {
+				parts = strings.Split(recv.(string), sep)
+			} else {
+				return nil, typeError("split() separator must be str, not %s", TypeName(args[0]))
+			}
+			list := &List{}
+			for _, part := range parts {
+				list.Elems = append(list.Elems, part)
+			}
+			return list, nil
+		},
+		"join": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("join", args, 1, 1); err != nil {
+				return nil, err
+			}
+			items, err := iterate(args[0], diag.Span{})
+			if err != nil {
+				return nil, err
+			}
+			parts := make([]string, len(items))
+			for i, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return nil, typeError("join() expects str items, found %s", TypeName(item))
+				}
+				parts[i] = s
+			}
+			return strings.Join(parts, recv.(string)), nil
+		},
+	},
+	"dict": {
+		"get": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("get", args, 1, 2); err != nil {
+				return nil, err
+			}
+			key, ok := args[0].(string)
+			if !ok {
+				return nil, nil
+			}
+			var def any
+			if len(args) == 2 {
+				def = args[1]
+			}
+			return dict.Get(recv.(map[string]any), key, def), nil
+		},
+		"keys": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("keys", args, 0, 0); err != nil {
+				return nil, err
+			}
+			items, _ := iterate(recv, diag.Span{})
+			return &List{Elems: items}, nil
+		},
+		"values": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("values", args, 0, 0); err != nil {
+				return nil, err
+			}
+			d := recv.(map[string]any)
+			list := &List{}
+			for _, key := range sortedKeys(d) {
+				list.Elems = append(list.Elems, d[key])
+			}
+			return list, nil
+		},
+		"items": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("items", args, 0, 0); err != nil {
+				return nil, err
+			}
+			d := recv.(map[string]any)
+			list := &List{}
+			for _, key := range sortedKeys(d) {
+				list.Elems = append(list.Elems, &List{Elems: []any{key, d[key]}})
+			}
+			return list, nil
+		},
+		"copy": func(in *Interp, recv any, args []any) (any, error) {
+			if err := arity("copy", args, 0, 0); err != nil {
+				return nil, err
+			}
+			return dict.DeepCopy(recv.(map[string]any)), nil
+		},
+	},
+}
+
+// stringMethod wraps a string method taking n string arguments.
+func stringMethod(n int, fn func(s string, args []any) (any, error)) func(*Interp, any, []any) (any, error) {
+	return func(in *Interp, recv any, args []any) (any, error) {
+		if len(args) != n {
+			return nil, typeError("method takes %d arguments but %d were given", n, len(args))
+		}
+		for _, arg := range args {
+			if _, ok := arg.(string); !ok {
+				return nil, typeError("expected str argument, found %s", TypeName(arg))
+			}
+		}
+		return fn(recv.(string), args)
+	}
+}
+
+// method returns v's builtin method name bound to v, or nil.
+func method(v any, name string) *Method {
+	fn, ok := methods[TypeName(v)][name]
+	if !ok {
+		return nil
+	}
+	return &Method{Name: name, Recv: v, Fn: fn}
+}
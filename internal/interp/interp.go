@@ -0,0 +1,625 @@
+// Package interp evaluates Rayo syntax trees directly, without compiling
+// them to Go. It gives instant execution for scripts, backs the REPL, and
+// serves as the reference semantics the Go backend is tested against.
+//
+// Values are represented by Go values: None is nil, bool, int, float64 and
+// string stand for themselves, dicts are map[string]any as in the runtime
+// dict package, and lists are *List. Functions, modules and exceptions
+// have types of their own; values returned by Go packages that have no
+// Rayo counterpart are kept as they are.
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+	"rayo/internal/parse"
+	"rayo/internal/sem"
+)
+
+// maxDepth bounds the depth of nested calls, so that runaway recursion is
+// a RecursionError rather than a crash of the interpreter.
+const maxDepth = 1000
+
+// Interp evaluates Rayo modules. Its zero value is not usable; see New.
+type Interp struct {
+	// Stdout receives the output of print.
+	Stdout io.Writer
+	// Stdin is read by input.
+	Stdin io.Reader
+	// Args are the program arguments returned by os.Args(), the program
+	// name first.
+	Args []string
+
+	builtins    *Env
+	stdin       *bufio.Reader
+	depth       int
+	interrupted atomic.Bool
+}
+
+// New returns an interpreter writing to os.Stdout and reading os.Stdin.
+func New() *Interp {
+	in := &Interp{Stdout: os.Stdout, Stdin: os.Stdin}
+	in.builtins = NewEnv(nil)
+	for name, fn := range builtins {
+		in.builtins.Set(name, &Builtin{Name: name, Fn: fn})
+	}
+	for _, name := range exceptionTypes {
+		in.builtins.Set(name, &Builtin{Name: name, Fn: newException(name)})
+	}
+	in.builtins.Set("True", true)
+	in.builtins.Set("False", false)
+	return in
+}
+
+// Env is a namespace: the globals of a module or the locals of a function
+// call, whose parent is the namespace the function was defined in.
+type Env struct {
+	vars   map[string]any
+	parent *Env
+	module string // set on module globals
+}
+
+// NewEnv returns an empty namespace inside parent.
+func NewEnv(parent *Env) *Env {
+	return &Env{vars: map[string]any{}, parent: parent}
+}
+
+// Get looks name up in e and its parents.
+func (e *Env) Get(name string) (any, bool) {
+	for ; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// moduleName returns the name of the module e is in.
+func (e *Env) moduleName() string {
+	for ; e != nil; e = e.parent {
+		if e.module != "" {
+			return e.module
+		}
+	}
+	return ""
+}
+
+// Set binds name in e itself.
+func (e *Env) Set(name string, v any) {
+	e.vars[name] = v
+}
+
+// Assign rebinds name in the innermost of e and its parents binding it,
+// as assignment in the compiled program does, or else binds it in e. The
+// builtins are never rebound: assigning a builtin's name shadows it.
+func (e *Env) Assign(name string, v any) {
+	for s := e; s.parent != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			s.vars[name] = v
+			return
+		}
+	}
+	e.vars[name] = v
+}
+
+// Names returns the names bound in e itself, sorted.
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Module is an evaluated Rayo module; its attributes are its globals.
+type Module struct {
+	Name    string
+	Globals *Env
+}
+
+// NewModule returns an empty module whose globals see the builtins.
+func (in *Interp) NewModule(name string) *Module {
+	globals := NewEnv(in.builtins)
+	globals.module = name
+	return &Module{Name: name, Globals: globals}
+}
+
+// BuiltinNames returns the names of the builtins, sorted.
+func (in *Interp) BuiltinNames() []string {
+	return in.builtins.Names()
+}
+
+// ExecModule evaluates mod as the module named name: it binds its imports
+// and runs its top-level statements. Rayo imports are bound to deps, keyed
+// by import path as written; they must have been evaluated already.
+func (in *Interp) ExecModule(name string, mod *ast.Module, deps map[string]*Module) (*Module, error) {
+	m := in.NewModule(name)
+	if err := in.Import(m, mod.Imports, deps); err != nil {
+		return m, inModule(err, name)
+	}
+	_, err := in.Exec(m, mod.Body)
+	return m, inModule(err, name)
+}
+
+// Import binds imports in m's globals.
+func (in *Interp) Import(m *Module, imports []*ast.Import, deps map[string]*Module) error {
+	for _, imp := range imports {
+		var val any
+		if sem.IsRayoImport(imp.Path) {
+			dep, ok := deps[imp.Path]
+			if !ok {
+				return raise(imp.Span(), "ImportError", "module %q is not loaded", imp.Path)
+			}
+			val = dep
+		} else {
+			pkg, ok := in.goPackage(imp.Path)
+			if !ok {
+				return raise(imp.Span(), "ImportError", "Go package %q is not available to the interpreter", imp.Path)
+			}
+			val = pkg
+		}
+		if len(imp.Names) == 0 {
+			local := imp.Alias
+			if local == "" {
+				local = sem.ImportName(imp.Path)
+			}
+			m.Globals.Set(local, val)
+			continue
+		}
+		for _, n := range imp.Names {
+			if pkg, ok := val.(*Package); ok {
+				// A Go variable is imported as a function reading it, as
+				// the compiled program reads it through call syntax
+				if v, ok := pkg.Members[n.Name]; ok && !isFunc(v) {
+					m.Globals.Set(n.Local(), &Builtin{Name: n.Local(), Fn: func(*Interp, []any) (any, error) {
+						return fromGo(reflectValue(v)), nil
+					}})
+					continue
+				}
+			}
+			v, err := in.attr(val, n.Name, n.Span())
+			if err != nil {
+				return err
+			}
+			m.Globals.Set(n.Local(), v)
+		}
+	}
+	return nil
+}
+
+// Interrupt makes the code being run raise KeyboardInterrupt before its
+// next statement, as Ctrl-C does. It may be called from another goroutine;
+// an interrupt that arrives when no code runs is dropped.
+func (in *Interp) Interrupt() {
+	in.interrupted.Store(true)
+}
+
+// start begins running code from outside the interpreter, dropping any
+// interrupt left over from code that has finished.
+func (in *Interp) start() {
+	if in.depth == 0 {
+		in.interrupted.Store(false)
+	}
+}
+
+// checkInterrupt raises KeyboardInterrupt at span if Interrupt was called.
+func (in *Interp) checkInterrupt(span diag.Span) error {
+	if in.interrupted.Swap(false) {
+		return raise(span, "KeyboardInterrupt", "")
+	}
+	return nil
+}
+
+// CallMain calls the main function of m, if it defines one.
+func (in *Interp) CallMain(m *Module) error {
+	in.start()
+	main, ok := m.Globals.vars["main"]
+	if !ok {
+		return nil
+	}
+	_, err := in.Call(main, nil, diag.Span{})
+	return err
+}
+
+// Exec runs top-level statements in m, returning the value of the last
+// one if it is an expression statement, for the REPL to show.
+func (in *Interp) Exec(m *Module, stmts []ast.Stmt) (any, error) {
+	in.start()
+	var last any
+	for _, stmt := range stmts {
+		last = nil
+		if es, ok := stmt.(*ast.ExprStmt); ok {
+			v, err := in.eval(es.Expr, m.Globals)
+			if err != nil {
+				return nil, err
+			}
+			last = v
+			continue
+		}
+		f, err := in.exec(stmt, m.Globals)
+		if err != nil {
+			return nil, err
+		}
+		if f.returning {
+			break
+		}
+	}
+	return last, nil
+}
+
+// Eval evaluates expr in m's globals.
+func (in *Interp) Eval(m *Module, expr ast.Expr) (any, error) {
+	in.start()
+	return in.eval(expr, m.Globals)
+}
+
+// flow tells the statement following another how control continues.
+type flow struct {
+	returning bool
+	value     any
+}
+
+func (in *Interp) block(stmts []ast.Stmt, env *Env) (flow, error) {
+	for _, stmt := range stmts {
+		if f, err := in.exec(stmt, env); err != nil || f.returning {
+			return f, err
+		}
+	}
+	return flow{}, nil
+}
+
+func (in *Interp) exec(stmt ast.Stmt, env *Env) (flow, error) {
+	if err := in.checkInterrupt(stmt.Span()); err != nil {
+		return flow{}, err
+	}
+	switch s := stmt.(type) {
+	case *ast.FuncDef:
+		env.Set(s.Name, &Function{Name: s.Name, Params: s.Params, Body: s.Body, Env: env, Module: env.moduleName()})
+	case *ast.VarStmt:
+		v, err := in.eval(s.Value, env)
+		if err != nil {
+			return flow{}, err
+		}
+		env.Set(s.Name, v)
+	case *ast.AssignStmt:
+		v, err := in.eval(s.Value, env)
+		if err != nil {
+			return flow{}, err
+		}
+		return flow{}, in.assign(s.Target, v, env)
+	case *ast.ExprStmt:
+		_, err := in.eval(s.Expr, env)
+		return flow{}, err
+	case *ast.IfStmt:
+		branches := append([]*ast.Elif{{Cond: s.Cond, Body: s.Then}}, s.Elifs...)
+		for _, b := range branches {
+			cond, err := in.eval(b.Cond, env)
+			if err != nil {
+				return flow{}, err
+			}
+			if Truthy(cond) {
+				return in.block(b.Body, env)
+			}
+		}
+		return in.block(s.Else, env)
+	case *ast.WhileStmt:
+		for {
+			// Checked on each iteration, as the body may be empty
+			if err := in.checkInterrupt(s.Span()); err != nil {
+				return flow{}, err
+			}
+			cond, err := in.eval(s.Cond, env)
+			if err != nil || !Truthy(cond) {
+				return flow{}, err
+			}
+			if f, err := in.block(s.Body, env); err != nil || f.returning {
+				return f, err
+			}
+		}
+	case *ast.ForStmt:
+		iter, err := in.eval(s.Iter, env)
+		if err != nil {
+			return flow{}, err
+		}
+		items, err := iterate(iter, s.Iter.Span())
+		if err != nil {
+			return flow{}, err
+		}
+		for _, item := range items {
+			env.Set(s.Var, item)
+			if f, err := in.block(s.Body, env); err != nil || f.returning {
+				return f, err
+			}
+		}
+	case *ast.ReturnStmt:
+		f := flow{returning: true}
+		if s.Value != nil {
+			v, err := in.eval(s.Value, env)
+			if err != nil {
+				return flow{}, err
+			}
+			f.value = v
+		}
+		return f, nil
+	case *ast.AssertStmt:
+		return flow{}, in.assert(s, env)
+	case *ast.TryStmt:
+		return in.try(s, env)
+	case *ast.BadStmt:
+		return flow{}, raise(s.Span(), "SyntaxError", "invalid statement")
+	default:
+		return flow{}, raise(stmt.Span(), "SyntaxError", "unsupported statement %T", stmt)
+	}
+	return flow{}, nil
+}
+
+// assign stores v into target: a name, a list element or dict entry, or
+// an attribute.
+func (in *Interp) assign(target ast.Expr, v any, env *Env) error {
+	switch t := target.(type) {
+	case *ast.Name:
+		env.Assign(t.Ident, v)
+		return nil
+	case *ast.Index:
+		container, err := in.eval(t.Target, env)
+		if err != nil {
+			return err
+		}
+		key, err := in.eval(t.Index, env)
+		if err != nil {
+			return err
+		}
+		return setIndex(container, key, v, t.Span())
+	case *ast.Attr:
+		container, err := in.eval(t.Target, env)
+		if err != nil {
+			return err
+		}
+		return setAttr(container, t.Attr, v, t.Span())
+	}
+	return raise(target.Span(), "SyntaxError", "cannot assign to %s", parse.Expr(target))
+}
+
+// assert checks an assert statement. Failures read like those of the
+// generated Go code, showing the operands of a failing comparison.
+func (in *Interp) assert(s *ast.AssertStmt, env *Env) error {
+	cmp, isCmp := s.Test.(*ast.BinaryOp)
+	if isCmp && negated[cmp.Op] == "" {
+		isCmp = false
+	}
+	var ok bool
+	var left, right any
+	if isCmp {
+		var err error
+		if left, err = in.eval(cmp.Left, env); err != nil {
+			return err
+		}
+		if right, err = in.eval(cmp.Right, env); err != nil {
+			return err
+		}
+		res, err := binary(cmp.Op, left, right, cmp.Span())
+		if err != nil {
+			return err
+		}
+		ok = Truthy(res)
+	} else {
+		v, err := in.eval(s.Test, env)
+		if err != nil {
+			return err
+		}
+		ok = Truthy(v)
+	}
+	if ok {
+		return nil
+	}
+	msg := "assert " + parse.Expr(s.Test)
+	if s.Msg != nil {
+		v, err := in.eval(s.Msg, env)
+		if err != nil {
+			return err
+		}
+		msg = Str(v)
+	}
+	if isCmp {
+		msg += fmt.Sprintf(": %s %s %s", Repr(left), negated[cmp.Op], Repr(right))
+		sep := ", where "
+		for _, side := range []struct {
+			v any
+			e ast.Expr
+		}{{left, cmp.Left}, {right, cmp.Right}} {
+			if _, lit := side.e.(*ast.Literal); !lit {
+				msg += sep + Repr(side.v) + " = " + parse.Expr(side.e)
+				sep = ", "
+			}
+		}
+	}
+	return &Exception{Type: "AssertionError", Msg: msg, Span: s.Span()}
+}
+
+// negated maps a comparison operator to the one that holds when it fails.
+var negated = map[string]string{"==": "!=", "!=": "==", "<": ">=", ">": "<=", "<=": ">", ">=": "<"}
+
+func (in *Interp) try(s *ast.TryStmt, env *Env) (f flow, err error) {
+	if len(s.Finally) > 0 {
+		defer func() {
+			// A return or exception in finally replaces the outcome
+			if ff, ferr := in.block(s.Finally, env); ferr != nil || ff.returning {
+				f, err = ff, ferr
+			}
+		}()
+	}
+	f, err = in.block(s.Body, env)
+	exc, ok := err.(*Exception)
+	if !ok {
+		return f, err
+	}
+	for _, handler := range s.Excepts {
+		if !exc.Matches(ast.TypeString(handler.Type)) {
+			continue
+		}
+		if handler.Var != "" {
+			env.Set(handler.Var, exc)
+		}
+		return in.block(handler.Body, env)
+	}
+	return f, err
+}
+
+func (in *Interp) eval(expr ast.Expr, env *Env) (any, error) {
+	switch e := expr.(type) {
+	case *ast.Literal:
+		return e.Value, nil
+	case *ast.Name:
+		if v, ok := env.Get(e.Ident); ok {
+			return v, nil
+		}
+		return nil, raise(e.Span(), "NameError", "name %q is not defined", e.Ident)
+	case *ast.ListLit:
+		list := &List{}
+		for _, elem := range e.Elems {
+			v, err := in.eval(elem, env)
+			if err != nil {
+				return nil, err
+			}
+			list.Elems = append(list.Elems, v)
+		}
+		return list, nil
+	case *ast.DictLit:
+		d := map[string]any{}
+		for i, keyExpr := range e.Keys {
+			key, err := in.eval(keyExpr, env)
+			if err != nil {
+				return nil, err
+			}
+			v, err := in.eval(e.Vals[i], env)
+			if err != nil {
+				return nil, err
+			}
+			if err := setIndex(d, key, v, keyExpr.Span()); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case *ast.UnaryOp:
+		v, err := in.eval(e.Right, env)
+		if err != nil {
+			return nil, err
+		}
+		return unary(e.Op, v, e.Span())
+	case *ast.BinaryOp:
+		l, err := in.eval(e.Left, env)
+		if err != nil {
+			return nil, err
+		}
+		// and/or short-circuit and yield an operand, as in Python
+		switch e.Op {
+		case "and", "&&":
+			if !Truthy(l) {
+				return l, nil
+			}
+			return in.eval(e.Right, env)
+		case "or", "||":
+			if Truthy(l) {
+				return l, nil
+			}
+			return in.eval(e.Right, env)
+		}
+		r, err := in.eval(e.Right, env)
+		if err != nil {
+			return nil, err
+		}
+		return binary(e.Op, l, r, e.Span())
+	case *ast.Call:
+		var fn any
+		var err error
+		if attr, ok := e.Func.(*ast.Attr); ok {
+			target, err := in.eval(attr.Target, env)
+			if err != nil {
+				return nil, err
+			}
+			// Rayo reads Go package variables and constants with call
+			// syntax, e.g. os.Args()
+			if pkg, ok := target.(*Package); ok && len(e.Args) == 0 {
+				if v, ok := pkg.Members[attr.Attr]; ok && !isFunc(v) {
+					return fromGo(reflectValue(v)), nil
+				}
+			}
+			if fn, err = in.attr(target, attr.Attr, attr.Span()); err != nil {
+				return nil, err
+			}
+		} else if fn, err = in.eval(e.Func, env); err != nil {
+			return nil, err
+		}
+		args := make([]any, len(e.Args))
+		for i, arg := range e.Args {
+			if args[i], err = in.eval(arg, env); err != nil {
+				return nil, err
+			}
+		}
+		return in.Call(fn, args, e.Span())
+	case *ast.Index:
+		container, err := in.eval(e.Target, env)
+		if err != nil {
+			return nil, err
+		}
+		key, err := in.eval(e.Index, env)
+		if err != nil {
+			return nil, err
+		}
+		return index(container, key, e.Span())
+	case *ast.Attr:
+		v, err := in.eval(e.Target, env)
+		if err != nil {
+			return nil, err
+		}
+		return in.attr(v, e.Attr, e.Span())
+	case *ast.Lambda:
+		return &Function{Name: "<lambda>", Params: e.Params, Result: e.Body, Env: env, Module: env.moduleName()}, nil
+	case *ast.BadExpr:
+		return nil, raise(e.Span(), "SyntaxError", "invalid expression")
+	}
+	return nil, raise(expr.Span(), "SyntaxError", "unsupported expression %T", expr)
+}
+
+// Call calls fn with args; span is where the call is, for errors.
+func (in *Interp) Call(fn any, args []any, span diag.Span) (any, error) {
+	in.depth++
+	defer func() { in.depth-- }()
+	if in.depth > maxDepth {
+		return nil, raise(span, "RecursionError", "maximum call depth of %d exceeded", maxDepth)
+	}
+	switch f := fn.(type) {
+	case *Function:
+		if len(args) != len(f.Params) {
+			return nil, raise(span, "TypeError", "%s() takes %d arguments but %d were given", f.Name, len(f.Params), len(args))
+		}
+		locals := NewEnv(f.Env)
+		for i, p := range f.Params {
+			locals.Set(p.Name, args[i])
+		}
+		if f.Result != nil {
+			v, err := in.eval(f.Result, locals)
+			return v, inModule(err, f.Module)
+		}
+		fl, err := in.block(f.Body, locals)
+		return fl.value, inModule(err, f.Module)
+	case *Builtin:
+		v, err := f.Fn(in, args)
+		return v, at(err, span)
+	case *Method:
+		v, err := f.Fn(in, f.Recv, args)
+		return v, at(err, span)
+	case *goFunc:
+		v, err := in.callGo(f, args)
+		return v, at(err, span)
+	}
+	return nil, raise(span, "TypeError", "%s is not callable", TypeName(fn))
+}
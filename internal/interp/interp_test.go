@@ -0,0 +1,304 @@
+package interp
+
+import (
+	"bytes"
+	"errors"
+	"rayo/internal/ast"
+	"rayo/internal/parse"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run parses src, evaluates it as the main module and calls main,
+// returning what it printed.
+func run(t *testing.T, src string) (string, error) {
+	t.Helper()
+	p := parse.NewParser(src)
+	mod := p.ParseModule()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse: %v", errs[0])
+	}
+	return runModule(mod, nil)
+}
+
+func runModule(mod *ast.Module, deps map[string]*Module) (string, error) {
+	var out bytes.Buffer
+	in := New()
+	in.Stdout = &out
+	in.Args = []string{"prog", "arg1"}
+	m, err := in.ExecModule("main", mod, deps)
+	if err == nil {
+		err = in.CallMain(m)
+	}
+	return out.String(), err
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"print", `def main() { print("hi", 1 + 2, None) }`, "hi 3 None\n"},
+		{"globals", "var x = 1\ndef main() { x = x + 1\nprint(x) }", "2\n"},
+		{"global assignment", "var n = 0\ndef bump() { n = n + 1\nvar local = 1\nlocal = 2 }\ndef main() { bump()\nbump()\nprint(n) }", "2\n"},
+		{"return", "def f() { if 1 < 2 { return \"yes\" } else { return \"no\" } }\ndef main() { print(f()) }", "yes\n"},
+		{"comparison", `def main() { print(1 == 1, "a" != "a", 2 > 3) }`, "True False False\n"},
+		{"lists", "def main() { var xs = [1, 2]\nxs.append(3)\nxs[0] = 10\nprint(xs, len(xs), xs[2]) }", "[10, 2, 3] 3 3\n"},
+		{"dicts", "def main() { var d = {\"a\": 1}\nd[\"b\"] = 2\nprint(d, d.get(\"c\", 0), d[\"a\"]) }", "{\"a\": 1, \"b\": 2} 0 1\n"},
+		{"strings", `def main() { print("ab" + "c", "-".join(["x", "y"]), "Hi".upper(), str(42) + "!") }`, "abc x-y HI 42!\n"},
+		{"builtins", `def main() { print(sorted([3, 1, 2]), sum([1, 2]), max(4, 9), type("s"), int("7") + 1) }`, "[1, 2, 3] 3 9 str 8\n"},
+		{"go package", "import \"strings\"\ndef main() { print(strings.ToUpper(\"go\"), strings.Split(\"a,b\", \",\")) }", "GO [\"a\", \"b\"]\n"},
+		{"go variable", "import \"os\"\nfrom \"os\" import Args as argv\ndef main() { print(os.Args(), argv()[1]) }", "[\"prog\", \"arg1\"] arg1\n"},
+		{"go error result", "import \"strconv\"\ndef main() { print(strconv.Atoi(\"12\") + 1) }", "13\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		src, typ, msg string
+	}{
+		{`def main() { print(y) }`, "NameError", `name "y" is not defined`},
+		{`def main() { print([1][3]) }`, "IndexError", ""},
+		{`def main() { print({"a": 1}["b"]) }`, "KeyError", ""},
+		{`def main() { print(1 + "a") }`, "TypeError", ""},
+		{`def main() { main() }`, "RecursionError", ""},
+		{"import \"strconv\"\ndef main() { strconv.Atoi(\"x\") }", "Error", "invalid syntax"},
+		{`def main() { var x = 2
+assert x + 1 == 4, "bad x" }`, "AssertionError", "bad x: 3 != 4, where 3 = x + 1"},
+		{`def main() { assert "a" == "b" }`, "AssertionError", `assert "a" == "b": "a" != "b"`},
+	}
+	for _, tt := range tests {
+		_, err := run(t, tt.src)
+		var exc *Exception
+		if !errors.As(err, &exc) {
+			t.Errorf("%s: got %v, want %s exception", tt.src, err, tt.typ)
+			continue
+		}
+		if exc.Type != tt.typ || !strings.Contains(exc.Msg, tt.msg) {
+			t.Errorf("%s: got %s: %s, want %s containing %q", tt.src, exc.Type, exc.Msg, tt.typ, tt.msg)
+		}
+		if exc.Span.Start.Line == 0 {
+			t.Errorf("%s: exception has no position", tt.src)
+		}
+	}
+}
+
+// Loops, try, parameters and lambdas are not parsed yet, so these tests
+// build their syntax trees directly.
+
+func name(s string) *ast.Name { return &ast.Name{Ident: s} }
+func lit(v any) *ast.Literal  { return &ast.Literal{Value: v} }
+func call(f ast.Expr, args ...ast.Expr) *ast.Call {
+	return &ast.Call{Func: f, Args: args}
+}
+func bin(op string, l, r ast.Expr) *ast.BinaryOp {
+	return &ast.BinaryOp{Op: op, Left: l, Right: r}
+}
+func printStmt(args ...ast.Expr) ast.Stmt {
+	return &ast.ExprStmt{Expr: call(name("print"), args...)}
+}
+func params(names ...string) []*ast.Param {
+	var ps []*ast.Param
+	for _, n := range names {
+		ps = append(ps, &ast.Param{Name: n})
+	}
+	return ps
+}
+func mainModule(body ...ast.Stmt) *ast.Module {
+	return &ast.Module{Name: "main", Body: []ast.Stmt{&ast.FuncDef{Name: "main", Body: body}}}
+}
+
+func TestLoops(t *testing.T) {
+	mod := mainModule(
+		&ast.VarStmt{Name: "n", Value: lit(0)},
+		&ast.WhileStmt{Cond: bin("<", name("n"), lit(3)), Body: []ast.Stmt{
+			&ast.AssignStmt{Target: name("n"), Value: bin("+", name("n"), lit(1))},
+		}},
+		&ast.ForStmt{Var: "k", Iter: &ast.DictLit{Keys: []ast.Expr{lit("b"), lit("a")}, Vals: []ast.Expr{lit(1), lit(2)}}, Body: []ast.Stmt{
+			printStmt(name("k")),
+		}},
+		&ast.ForStmt{Var: "i", Iter: call(name("range"), name("n")), Body: []ast.Stmt{
+			&ast.IfStmt{Cond: bin("==", name("i"), lit(1)), Then: []ast.Stmt{&ast.ReturnStmt{}}},
+			printStmt(name("i")),
+		}},
+	)
+	got, err := runModule(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\nb\n0\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	// def adder(k) { def add(x) { return x + k }; return add }
+	adder := &ast.FuncDef{Name: "adder", Params: params("k"), Body: []ast.Stmt{
+		&ast.FuncDef{Name: "add", Params: params("x"), Body: []ast.Stmt{
+			&ast.ReturnStmt{Value: bin("+", name("x"), name("k"))},
+		}},
+		&ast.ReturnStmt{Value: name("add")},
+	}}
+	mod := mainModule(
+		&ast.VarStmt{Name: "add1", Value: call(name("adder"), lit(1))},
+		&ast.VarStmt{Name: "add5", Value: call(name("adder"), lit(5))},
+		&ast.VarStmt{Name: "double", Value: &ast.Lambda{Params: params("x"), Body: bin("*", name("x"), lit(2))}},
+		printStmt(call(name("add1"), lit(1)), call(name("add5"), lit(1)), call(name("double"), lit(21))),
+	)
+	mod.Body = append(mod.Body, adder)
+	got, err := runModule(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2 6 42\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := runModule(mainModule(adder, &ast.ExprStmt{Expr: call(name("adder"))}), nil); err == nil || !strings.Contains(err.Error(), "adder() takes 1 arguments but 0 were given") {
+		t.Errorf("wrong arity: got %v", err)
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	even := &ast.Lambda{Params: params("x"), Body: bin("==", bin("%", name("x"), lit(2)), lit(0))}
+	mod := mainModule(
+		printStmt(call(&ast.Attr{Target: name("data"), Attr: "Filter"}, &ast.ListLit{Elems: []ast.Expr{lit(1), lit(2), lit(4)}}, even)),
+		printStmt(call(&ast.Attr{Target: name("data"), Attr: "Map"}, &ast.ListLit{Elems: []ast.Expr{lit("a")}}, name("str"))),
+	)
+	mod.Imports = []*ast.Import{{Path: "rayo/stdlib/data"}}
+	got, err := runModule(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[2, 4]\n[\"a\"]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// An exception in a callback unwinds the Go code calling it
+	failing := &ast.Lambda{Params: params("x"), Body: bin("/", name("x"), lit(0))}
+	mod = mainModule(printStmt(call(&ast.Attr{Target: name("data"), Attr: "Map"}, &ast.ListLit{Elems: []ast.Expr{lit(1)}}, failing)))
+	mod.Imports = []*ast.Import{{Path: "rayo/stdlib/data"}}
+	_, err = runModule(mod, nil)
+	var exc *Exception
+	if !errors.As(err, &exc) || exc.Type != "ZeroDivisionError" {
+		t.Errorf("failing callback: got %v, want ZeroDivisionError", err)
+	}
+}
+
+func TestTry(t *testing.T) {
+	mod := mainModule(
+		&ast.TryStmt{
+			Body: []ast.Stmt{printStmt(bin("/", lit(1), lit(0)))},
+			Excepts: []*ast.Except{
+				{Type: "KeyError", Body: []ast.Stmt{printStmt(lit("key"))}},
+				{Type: "ZeroDivisionError", Var: "e", Body: []ast.Stmt{printStmt(lit("caught"), &ast.Attr{Target: name("e"), Attr: "message"})}},
+			},
+			Finally: []ast.Stmt{printStmt(lit("finally"))},
+		},
+		&ast.TryStmt{
+			Body:    []ast.Stmt{&ast.ExprStmt{Expr: call(name("ValueError"), lit("custom"))}, printStmt(lit("not raised"))},
+			Excepts: []*ast.Except{{Type: "Exception", Body: []ast.Stmt{printStmt(lit("unreachable"))}}},
+		},
+	)
+	got, err := runModule(mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "caught division by zero\nfinally\nnot raised\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	// A loop that catches every exception is still interrupted
+	mod := mainModule(&ast.WhileStmt{Cond: name("True"), Body: []ast.Stmt{
+		&ast.TryStmt{
+			Body:    []ast.Stmt{&ast.AssignStmt{Target: name("x"), Value: lit(1)}},
+			Excepts: []*ast.Except{{Body: []ast.Stmt{printStmt(lit("caught"))}}},
+		},
+	}})
+	in := New()
+	var out bytes.Buffer
+	in.Stdout = &out
+	m, err := in.ExecModule("main", mod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Until main runs, interrupts are dropped
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				in.Interrupt()
+			}
+		}
+	}()
+	err = in.CallMain(m)
+	var exc *Exception
+	if !errors.As(err, &exc) || exc.Type != "KeyboardInterrupt" {
+		t.Fatalf("got %v, want KeyboardInterrupt", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("except caught KeyboardInterrupt: %q", out.String())
+	}
+}
+
+func TestRayoImports(t *testing.T) {
+	p := parse.NewParser("var greeting = \"hello\"\ndef shout() { return greeting.upper() }")
+	lib := p.ParseModule()
+	in := New()
+	var out bytes.Buffer
+	in.Stdout = &out
+	libMod, err := in.ExecModule("lib", lib, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = parse.NewParser("import \"lib.ryo\"\nfrom \"lib.ryo\" import greeting as g\ndef main() { print(lib.shout(), g) }")
+	m, err := in.ExecModule("main", p.ParseModule(), map[string]*Module{"lib.ryo": libMod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := in.CallMain(m); err != nil {
+		t.Fatal(err)
+	}
+	if want := "HELLO hello\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	p = parse.NewParser("import \"lib.ryo\"")
+	_, err = in.ExecModule("main", p.ParseModule(), nil)
+	var exc *Exception
+	if !errors.As(err, &exc) || exc.Type != "ImportError" {
+		t.Errorf("missing dependency: got %v, want ImportError", err)
+	}
+}
+
+func TestExecLastValue(t *testing.T) {
+	in := New()
+	m := in.NewModule("repl")
+	p := parse.NewParser("var x = 20\nx + 22")
+	v, err := in.Exec(m, p.ParseModule().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 42 {
+		t.Errorf("got %v, want 42", v)
+	}
+	if Repr("a\"b") != `"a\"b"` || Repr(&List{Elems: []any{1.5, nil, true}}) != "[1.5, None, True]" {
+		t.Errorf("Repr: got %s and %s", Repr("a\"b"), Repr(&List{Elems: []any{1.5, nil, true}}))
+	}
+}
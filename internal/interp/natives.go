@@ -0,0 +1,350 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"rayo/internal/diag"
+	"rayo/stdlib/core"
+	"rayo/stdlib/data"
+	rayoio "rayo/stdlib/io"
+)
+
+// Package is a Go package imported by an interpreted program. Its members
+// are Go functions, called through reflection, and variables or constants.
+type Package struct {
+	Path    string
+	Members map[string]any
+}
+
+// packages holds the Go packages available to interpreted programs, by
+// import path. Generic functions are instantiated for any.
+var packages = map[string]map[string]any{
+	"strings": {
+		"Contains": strings.Contains, "Count": strings.Count, "Fields": strings.Fields,
+		"HasPrefix": strings.HasPrefix, "HasSuffix": strings.HasSuffix, "Index": strings.Index,
+		"Join": strings.Join, "Repeat": strings.Repeat, "Replace": strings.Replace,
+		"ReplaceAll": strings.ReplaceAll, "Split": strings.Split, "ToLower": strings.ToLower,
+		"ToUpper": strings.ToUpper, "TrimSpace": strings.TrimSpace, "Trim": strings.Trim,
+		"TrimPrefix": strings.TrimPrefix, "TrimSuffix": strings.TrimSuffix,
+	},
+	"strconv": {
+		"Atoi": strconv.Atoi, "Itoa": strconv.Itoa, "ParseFloat": strconv.ParseFloat,
+		"Quote": strconv.Quote,
+	},
+	"math": {
+		"Abs": math.Abs, "Ceil": math.Ceil, "Floor": math.Floor, "Max": math.Max,
+		"Min": math.Min, "Pow": math.Pow, "Round": math.Round, "Sqrt": math.Sqrt,
+		"E": math.E, "Pi": math.Pi,
+	},
+	"os": {
+		"Exit": os.Exit, "Getenv": os.Getenv, "Getwd": os.Getwd, "ReadFile": os.ReadFile,
+	},
+	"time": {
+		"Now": time.Now, "Since": time.Since, "Sleep": time.Sleep,
+	},
+	"rayo/stdlib/core": {
+		"Abs": core.Abs, "Pow": core.Pow, "Max": core.Max, "Min": core.Min,
+		"StrLen": core.StrLen, "StrUpper": core.StrUpper, "StrLower": core.StrLower,
+		"StrSplit": core.StrSplit, "DictKeys": core.DictKeys, "DictValues": core.DictValues,
+		"Raise": core.Raise, "Now": core.Now, "FormatTime": core.FormatTime,
+		"ParseTime": core.ParseTime,
+		"Map":       core.Map[any, any], "Filter": core.Filter[any], "Reduce": core.Reduce[any, any],
+	},
+	"rayo/stdlib/data": {
+		"Map": data.Map[any, any], "Filter": data.Filter[any], "Reduce": data.Reduce[any, any],
+		"Agg": data.Agg[any, any], "GroupBy": data.GroupBy[any, any], "Select": data.Select,
+	},
+	"rayo/stdlib/io": {
+		"ReadText": rayoio.ReadText, "WriteText": rayoio.WriteText, "LoadCSV": rayoio.LoadCSV,
+		"DumpCSV": rayoio.DumpCSV,
+	},
+}
+
+// RegisterPackage makes the Go package path, with the given members,
+// available to interpreted programs.
+func RegisterPackage(path string, members map[string]any) {
+	packages[path] = members
+}
+
+// goPackage returns the package imported as path. The os package returns
+// the interpreter's own program arguments.
+func (in *Interp) goPackage(path string) (*Package, bool) {
+	members, ok := packages[path]
+	if !ok {
+		return nil, false
+	}
+	if path == "os" {
+		withArgs := map[string]any{"Args": in.Args}
+		for name, m := range members {
+			withArgs[name] = m
+		}
+		members = withArgs
+	}
+	return &Package{Path: path, Members: members}, true
+}
+
+// goFunc is a Go function called from Rayo.
+type goFunc struct {
+	fn reflect.Value
+}
+
+func isFunc(v any) bool {
+	return reflect.TypeOf(v) != nil && reflect.TypeOf(v).Kind() == reflect.Func
+}
+
+func reflectValue(v any) reflect.Value {
+	return reflect.ValueOf(v)
+}
+
+// callbackError carries an exception out of a Rayo function called back
+// by Go code, through the Go code.
+type callbackError struct {
+	err error
+}
+
+// callGo calls a Go function, converting the arguments to the parameter
+// types. A final error result becomes an exception when not nil; the other
+// results are returned as a value, None, or a list if there are several.
+func (in *Interp) callGo(f *goFunc, args []any) (result any, rerr error) {
+	t := f.fn.Type()
+	n := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < n-1 {
+			return nil, typeError("function takes at least %d arguments but %d were given", n-1, len(args))
+		}
+	} else if len(args) != n {
+		return nil, typeError("function takes %d arguments but %d were given", n, len(args))
+	}
+	in_ := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		pt := t.In(min(i, n-1))
+		if t.IsVariadic() && i >= n-1 {
+			pt = pt.Elem()
+		}
+		v, err := in.toGo(arg, pt)
+		if err != nil {
+			return nil, err
+		}
+		in_[i] = v
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if cb, ok := r.(callbackError); ok {
+				rerr = cb.err
+				return
+			}
+			rerr = &Exception{Type: "Error", Msg: fmt.Sprint(r)}
+		}
+	}()
+	out := f.fn.Call(in_)
+	if len(out) > 0 && t.Out(len(out)-1) == errorType {
+		if e, _ := out[len(out)-1].Interface().(error); e != nil {
+			return nil, at(e, diag.Span{})
+		}
+		out = out[:len(out)-1]
+	}
+	switch len(out) {
+	case 0:
+		return nil, nil
+	case 1:
+		return fromGo(out[0]), nil
+	}
+	list := &List{}
+	for _, v := range out {
+		list.Elems = append(list.Elems, fromGo(v))
+	}
+	return list, nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// toGo converts a Rayo value to Go type t. Lists convert to slices and
+// functions to Go functions calling back into the interpreter.
+func (in *Interp) toGo(v any, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, typeError("cannot use None as Go %s", t)
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, ok := v.(int); ok {
+			return reflect.ValueOf(i).Convert(t), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := toFloat(v); ok {
+			return reflect.ValueOf(f).Convert(t), nil
+		}
+	case reflect.String:
+		if s, ok := v.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Bool:
+		if b, ok := v.(bool); ok {
+			return reflect.ValueOf(b), nil
+		}
+	case reflect.Slice:
+		if l, ok := v.(*List); ok {
+			s := reflect.MakeSlice(t, len(l.Elems), len(l.Elems))
+			for i, elem := range l.Elems {
+				e, err := in.toGo(elem, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				s.Index(i).Set(e)
+			}
+			return s, nil
+		}
+	case reflect.Map:
+		if d, ok := v.(map[string]any); ok {
+			if reflect.TypeOf(d) == t {
+				return reflect.ValueOf(d), nil
+			}
+			m := reflect.MakeMapWithSize(t, len(d))
+			for key, val := range d {
+				k, err := in.toGo(key, t.Key())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				e, err := in.toGo(val, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				m.SetMapIndex(k, e)
+			}
+			return m, nil
+		}
+	case reflect.Func:
+		switch v.(type) {
+		case *Function, *Builtin, *Method, *goFunc:
+			return in.callback(v, t), nil
+		}
+	case reflect.Interface:
+		if l, ok := v.(*List); ok {
+			// Go code expects slices, not interpreter lists
+			return in.toGo(l, reflect.TypeOf([]any{}))
+		}
+		if reflect.TypeOf(v).Implements(t) {
+			return reflect.ValueOf(v), nil
+		}
+	}
+	if reflect.TypeOf(v).AssignableTo(t) {
+		return reflect.ValueOf(v), nil
+	}
+	return reflect.Value{}, typeError("cannot use %s as Go %s", TypeName(v), t)
+}
+
+// callback returns a Go function of type t calling fn. An exception in fn
+// unwinds the Go code in between as a panic, recovered by callGo.
+func (in *Interp) callback(fn any, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		rargs := make([]any, len(args))
+		for i, arg := range args {
+			rargs[i] = fromGo(arg)
+		}
+		result, err := in.Call(fn, rargs, diag.Span{})
+		if err != nil {
+			panic(callbackError{err})
+		}
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			if i > 0 || t.Out(i) == errorType {
+				out[i] = reflect.Zero(t.Out(i))
+				continue
+			}
+			v, err := in.toGo(result, t.Out(i))
+			if err != nil {
+				panic(callbackError{err})
+			}
+			out[i] = v
+		}
+		return out
+	})
+}
+
+// fromGo converts a Go value to a Rayo value. Values without a Rayo
+// counterpart, such as structs, are kept as they are.
+func fromGo(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return fromGo(v.Elem())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			return v.Interface()
+		}
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return &List{}
+		}
+		list := &List{Elems: make([]any, v.Len())}
+		for i := range list.Elems {
+			list.Elems[i] = fromGo(v.Index(i))
+		}
+		return list
+	case reflect.Map:
+		if d, ok := v.Interface().(map[string]any); ok {
+			return d
+		}
+		d := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			d[Str(fromGo(iter.Key()))] = fromGo(iter.Value())
+		}
+		return d
+	case reflect.Func:
+		if v.IsNil() {
+			return nil
+		}
+		return &goFunc{fn: v}
+	}
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return nil
+}
+
+// goAttr returns the method or exported field name of a Go value.
+func goAttr(v any, name string) (any, bool) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, false
+	}
+	if m := rv.MethodByName(name); m.IsValid() {
+		return &goFunc{fn: m}, true
+	}
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		if f, ok := rv.Type().FieldByName(name); ok && f.IsExported() {
+			return fromGo(rv.FieldByIndex(f.Index)), true
+		}
+	}
+	return nil, false
+}
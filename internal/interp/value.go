@@ -0,0 +1,623 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+	"rayo/runtime/core"
+	"rayo/runtime/dict"
+	rerr "rayo/runtime/err"
+	"rayo/runtime/obj"
+)
+
+// List is a Rayo list. It is a pointer so that a list is shared, not
+// copied, by assignment, and grows in place with append.
+type List struct {
+	Elems []any
+}
+
+// Function is a function defined in Rayo: a def, whose Body runs, or a
+// lambda, whose Result is evaluated. Env is the namespace it was defined
+// in, in the module named Module.
+type Function struct {
+	Name   string
+	Params []*ast.Param
+	Body   []ast.Stmt
+	Result ast.Expr
+	Env    *Env
+	Module string
+}
+
+// Builtin is a function implemented by the interpreter.
+type Builtin struct {
+	Name string
+	Fn   func(in *Interp, args []any) (any, error)
+}
+
+// Method is a builtin method bound to its receiver, e.g. xs.append.
+type Method struct {
+	Name string
+	Recv any
+	Fn   func(in *Interp, recv any, args []any) (any, error)
+}
+
+// Exception is a Rayo exception, raised by the interpreter or by a Go
+// function returning an error, and caught by try/except. Its attributes
+// are kept in a runtime object.
+type Exception struct {
+	Type   string // e.g. "ValueError"
+	Msg    string
+	Span   diag.Span // where it was raised, if known
+	Module string    // name of the module Span is in
+	Err    error     // the Go error it stands for, if any
+	obj    *obj.Obj
+}
+
+func (e *Exception) Error() string {
+	if e.Msg == "" {
+		return e.Type
+	}
+	return e.Type + ": " + e.Msg
+}
+
+func (e *Exception) Unwrap() error {
+	return e.Err
+}
+
+// Matches reports whether an except clause naming typ catches e. Every
+// exception is an Exception, and a clause without a type catches all,
+// except KeyboardInterrupt: it is only caught by name, so that code
+// catching every error can still be interrupted.
+func (e *Exception) Matches(typ string) bool {
+	if e.Type == "KeyboardInterrupt" {
+		return typ == e.Type
+	}
+	return typ == "" || typ == "Exception" || typ == e.Type
+}
+
+func (e *Exception) attrs() *obj.Obj {
+	if e.obj == nil {
+		e.obj = obj.NewObj()
+		e.obj.SetAttr("message", e.Msg)
+		e.obj.SetAttr("type", e.Type)
+	}
+	return e.obj
+}
+
+// exceptionTypes are the exception types the interpreter raises; each is
+// also a builtin constructing an exception of the type.
+var exceptionTypes = []string{
+	"Exception", "AssertionError", "AttributeError", "EOFError", "ImportError", "IndexError",
+	"KeyError", "KeyboardInterrupt", "NameError", "RecursionError", "SyntaxError", "TypeError",
+	"ValueError", "ZeroDivisionError",
+}
+
+func raise(span diag.Span, typ, format string, args ...any) *Exception {
+	return &Exception{Type: typ, Msg: fmt.Sprintf(format, args...), Span: span}
+}
+
+// at gives an exception raised without a position, e.g. by a builtin, the
+// position of the call. Other errors become exceptions there, unless they
+// wrap an exception raised by a Rayo function Go code called back.
+func at(err error, span diag.Span) error {
+	if err == nil {
+		return nil
+	}
+	for e := err; e != nil; e = rerr.Unwrap(e) {
+		if exc, ok := e.(*Exception); ok {
+			if exc.Span == (diag.Span{}) {
+				exc.Span = span
+			}
+			return exc
+		}
+	}
+	return &Exception{Type: "Error", Msg: err.Error(), Span: span, Err: err}
+}
+
+// inModule gives an exception raised without a module the module name.
+func inModule(err error, module string) error {
+	if e, ok := err.(*Exception); ok && e.Module == "" {
+		e.Module = module
+	}
+	return err
+}
+
+// TypeName returns the Rayo name of the type of v.
+func TypeName(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NoneType"
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "str"
+	case *List:
+		return "list"
+	case map[string]any:
+		return "dict"
+	case *Function, *Builtin, *Method, *goFunc:
+		return "function"
+	case *Module, *Package:
+		return "module"
+	case *Exception:
+		return v.Type
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Str renders v as print and str do.
+func Str(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case *Exception:
+		return v.Msg
+	}
+	return Repr(v)
+}
+
+// Repr renders v the way Rayo source spells it, as the REPL shows values.
+func Repr(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return formatFloat(v)
+	case string:
+		return strconv.Quote(v)
+	case *List:
+		parts := make([]string, len(v.Elems))
+		for i, elem := range v.Elems {
+			parts[i] = Repr(elem)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]any:
+		keys := sortedKeys(v)
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			parts[i] = strconv.Quote(key) + ": " + Repr(v[key])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *Function:
+		return "<function " + v.Name + ">"
+	case *Builtin:
+		return "<builtin " + v.Name + ">"
+	case *Method:
+		return "<method " + TypeName(v.Recv) + "." + v.Name + ">"
+	case *Module:
+		return "<module " + v.Name + ">"
+	case *Package:
+		return "<Go package " + v.Path + ">"
+	case *Exception:
+		return v.Type + "(" + strconv.Quote(v.Msg) + ")"
+	case error:
+		return v.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// sortedKeys returns the keys of d in order, which is the order dicts are
+// printed and iterated in.
+func sortedKeys(d map[string]any) []string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Truthy reports whether v counts as true in a condition.
+func Truthy(v any) bool {
+	switch v := v.(type) {
+	case float64:
+		return v != 0
+	case *List:
+		return len(v.Elems) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return core.Truthy(v)
+}
+
+// equal reports whether a == b. Ints and floats compare by value; lists
+// and dicts compare element by element.
+func equal(a, b any) bool {
+	if x, y, ok := numbers(a, b); ok {
+		return x == y
+	}
+	switch a := a.(type) {
+	case *List:
+		b, ok := b.(*List)
+		if !ok || len(a.Elems) != len(b.Elems) {
+			return false
+		}
+		for i := range a.Elems {
+			if !equal(a.Elems[i], b.Elems[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, v := range a {
+			w, ok := b[key]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case nil, bool, string:
+		return a == b
+	}
+	return a == b
+}
+
+// compare orders a and b, which must be numbers, strings or lists.
+func compare(a, b any, span diag.Span) (int, error) {
+	if x, y, ok := numbers(a, b); ok {
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	switch a := a.(type) {
+	case string:
+		if _, ok := b.(string); ok {
+			return core.Compare(a, b), nil
+		}
+	case *List:
+		if b, ok := b.(*List); ok {
+			for i := 0; i < len(a.Elems) && i < len(b.Elems); i++ {
+				if c, err := compare(a.Elems[i], b.Elems[i], span); err != nil || c != 0 {
+					return c, err
+				}
+			}
+			return core.Compare(len(a.Elems), len(b.Elems)), nil
+		}
+	}
+	return 0, raise(span, "TypeError", "cannot compare %s and %s", TypeName(a), TypeName(b))
+}
+
+// numbers returns a and b as floats if both are numbers and either is a
+// float.
+func numbers(a, b any) (float64, float64, bool) {
+	x, aok := toFloat(a)
+	y, bok := toFloat(b)
+	return x, y, aok && bok
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func unary(op string, v any, span diag.Span) (any, error) {
+	switch op {
+	case "not", "!":
+		return !Truthy(v), nil
+	case "-":
+		switch v := v.(type) {
+		case int:
+			return -v, nil
+		case float64:
+			return -v, nil
+		}
+	case "+":
+		switch v.(type) {
+		case int, float64:
+			return v, nil
+		}
+	case "~":
+		if v, ok := v.(int); ok {
+			return ^v, nil
+		}
+	}
+	return nil, raise(span, "TypeError", "bad operand type for unary %s: %s", op, TypeName(v))
+}
+
+func binary(op string, l, r any, span diag.Span) (any, error) {
+	switch op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r, span)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+	if x, ok := l.(int); ok {
+		if y, ok := r.(int); ok {
+			return intOp(op, x, y, span)
+		}
+	}
+	if x, y, ok := numbers(l, r); ok {
+		return floatOp(op, x, y, span)
+	}
+	switch x := l.(type) {
+	case string:
+		switch y := r.(type) {
+		case string:
+			if op == "+" {
+				return x + y, nil
+			}
+		case int:
+			if op == "*" {
+				return strings.Repeat(x, max(y, 0)), nil
+			}
+		}
+	case *List:
+		switch y := r.(type) {
+		case *List:
+			if op == "+" {
+				return &List{Elems: append(append([]any{}, x.Elems...), y.Elems...)}, nil
+			}
+		case int:
+			if op == "*" {
+				out := &List{}
+				for i := 0; i < y; i++ {
+					out.Elems = append(out.Elems, x.Elems...)
+				}
+				return out, nil
+			}
+		}
+	case map[string]any:
+		if y, ok := r.(map[string]any); ok && op == "|" {
+			return dict.Merge(x, y), nil
+		}
+	}
+	return nil, raise(span, "TypeError", "unsupported operand types for %s: %s and %s", op, TypeName(l), TypeName(r))
+}
+
+func intOp(op string, x, y int, span diag.Span) (any, error) {
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		return floatOp(op, float64(x), float64(y), span)
+	case "//", "%":
+		if y == 0 {
+			return nil, raise(span, "ZeroDivisionError", "integer division or modulo by zero")
+		}
+		// Python rounds towards negative infinity
+		q, m := x/y, x%y
+		if m != 0 && (m < 0) != (y < 0) {
+			q, m = q-1, m+y
+		}
+		if op == "//" {
+			return q, nil
+		}
+		return m, nil
+	case "**":
+		if y < 0 {
+			return math.Pow(float64(x), float64(y)), nil
+		}
+		result := 1
+		for ; y > 0; y-- {
+			result *= x
+		}
+		return result, nil
+	case "&":
+		return x & y, nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	}
+	return nil, raise(span, "TypeError", "unsupported operand types for %s: int and int", op)
+}
+
+func floatOp(op string, x, y float64, span diag.Span) (any, error) {
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "//", "%":
+		if y == 0 {
+			return nil, raise(span, "ZeroDivisionError", "division by zero")
+		}
+		switch op {
+		case "/":
+			return x / y, nil
+		case "//":
+			return math.Floor(x / y), nil
+		}
+		m := math.Mod(x, y)
+		if m != 0 && (m < 0) != (y < 0) {
+			m += y
+		}
+		return m, nil
+	case "**":
+		return math.Pow(x, y), nil
+	}
+	return nil, raise(span, "TypeError", "unsupported operand types for %s: float and float", op)
+}
+
+// index returns container[key].
+func index(container, key any, span diag.Span) (any, error) {
+	switch c := container.(type) {
+	case *List:
+		i, err := position(key, len(c.Elems), span)
+		if err != nil {
+			return nil, err
+		}
+		return c.Elems[i], nil
+	case string:
+		i, err := position(key, len(c), span)
+		if err != nil {
+			return nil, err
+		}
+		return c[i : i+1], nil
+	case map[string]any:
+		k, ok := key.(string)
+		if !ok {
+			return nil, raise(span, "TypeError", "dict keys must be str, not %s", TypeName(key))
+		}
+		v, ok := c[k]
+		if !ok {
+			return nil, raise(span, "KeyError", "%s", strconv.Quote(k))
+		}
+		return v, nil
+	}
+	return nil, raise(span, "TypeError", "%s is not subscriptable", TypeName(container))
+}
+
+// position returns the index into a sequence of length n that key, which
+// may count from the end, stands for.
+func position(key any, n int, span diag.Span) (int, error) {
+	i, ok := key.(int)
+	if !ok {
+		return 0, raise(span, "TypeError", "indices must be int, not %s", TypeName(key))
+	}
+	if i < 0 {
+		i += n
+	}
+	if i < 0 || i >= n {
+		return 0, raise(span, "IndexError", "index %d out of range", key)
+	}
+	return i, nil
+}
+
+func setIndex(container, key, v any, span diag.Span) error {
+	switch c := container.(type) {
+	case *List:
+		i, err := position(key, len(c.Elems), span)
+		if err != nil {
+			return err
+		}
+		c.Elems[i] = v
+		return nil
+	case map[string]any:
+		k, ok := key.(string)
+		if !ok {
+			return raise(span, "TypeError", "dict keys must be str, not %s", TypeName(key))
+		}
+		dict.Set(c, k, v)
+		return nil
+	}
+	return raise(span, "TypeError", "%s does not support item assignment", TypeName(container))
+}
+
+// attr returns v.name: a global of a module, a member of a Go package, a
+// method, or an attribute of an exception or Go value.
+func (in *Interp) attr(v any, name string, span diag.Span) (any, error) {
+	switch v := v.(type) {
+	case *Module:
+		if x, ok := v.Globals.vars[name]; ok {
+			return x, nil
+		}
+		return nil, raise(span, "AttributeError", "module %s has no attribute %q", v.Name, name)
+	case *Package:
+		x, ok := v.Members[name]
+		if !ok {
+			return nil, raise(span, "AttributeError", "Go package %s has no member %q", v.Path, name)
+		}
+		return fromGo(reflectValue(x)), nil
+	case *Exception:
+		if x, ok := v.attrs().Attrs[name]; ok {
+			return x, nil
+		}
+	}
+	if m := method(v, name); m != nil {
+		return m, nil
+	}
+	if x, ok := goAttr(v, name); ok {
+		return x, nil
+	}
+	return nil, raise(span, "AttributeError", "%s has no attribute %q", TypeName(v), name)
+}
+
+func setAttr(v any, name string, x any, span diag.Span) error {
+	switch v := v.(type) {
+	case *Module:
+		v.Globals.Set(name, x)
+		return nil
+	case *Exception:
+		v.attrs().SetAttr(name, x)
+		return nil
+	}
+	return raise(span, "AttributeError", "cannot set attribute %q of %s", name, TypeName(v))
+}
+
+// iterate returns the items a for loop over v visits: the elements of a
+// list, the characters of a string, or the keys of a dict in order.
+func iterate(v any, span diag.Span) ([]any, error) {
+	switch v := v.(type) {
+	case *List:
+		return append([]any{}, v.Elems...), nil
+	case string:
+		var items []any
+		for _, r := range v {
+			items = append(items, string(r))
+		}
+		return items, nil
+	case map[string]any:
+		var items []any
+		for _, key := range sortedKeys(v) {
+			items = append(items, key)
+		}
+		return items, nil
+	}
+	return nil, raise(span, "TypeError", "%s is not iterable", TypeName(v))
+}
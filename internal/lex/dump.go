@@ -0,0 +1,100 @@
+package lex
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// Tokenize lexes src to the end and returns every token, including the
+// final EOF token. Trivia is dropped when keepTrivia is false.
+func Tokenize(src string, keepTrivia bool) []Token {
+    lx := NewLexer(src)
+    var toks []Token
+    for {
+        tok := lx.Next()
+        if keepTrivia || !tok.IsTrivia() {
+            toks = append(toks, tok)
+        }
+        if tok.Kind == TokenEOF {
+            return toks
+        }
+    }
+}
+
+// WriteTokens writes one line per token:
+//
+//    1:1	0	Keyword	"def"
+//
+// giving line:col, byte offset, kind name and the Go-quoted value. This is
+// the format of .tokens golden files; ReadTokens parses it back.
+func WriteTokens(w io.Writer, toks []Token) error {
+    bw := bufio.NewWriter(w)
+    for _, t := range toks {
+        fmt.Fprintf(bw, "%d:%d\t%d\t%s\t%s\n", t.Line, t.Col, t.Offset, t.Kind, strconv.Quote(t.Value))
+    }
+    return bw.Flush()
+}
+
+// FormatTokens returns the WriteTokens dump of toks as a string.
+func FormatTokens(toks []Token) string {
+    var sb strings.Builder
+    WriteTokens(&sb, toks)
+    return sb.String()
+}
+
+// ReadTokens parses a dump written by WriteTokens.
+func ReadTokens(dump string) ([]Token, error) {
+    var toks []Token
+    for i, line := range strings.Split(strings.TrimRight(dump, "\n"), "\n") {
+        if line == "" {
+            continue
+        }
+        fields := strings.SplitN(line, "\t", 4)
+        if len(fields) != 4 {
+            return nil, fmt.Errorf("line %d: expected 4 tab-separated fields", i+1)
+        }
+        var t Token
+        if _, err := fmt.Sscanf(fields[0], "%d:%d", &t.Line, &t.Col); err != nil {
+            return nil, fmt.Errorf("line %d: bad position %q", i+1, fields[0])
+        }
+        off, err := strconv.Atoi(fields[1])
+        if err != nil {
+            return nil, fmt.Errorf("line %d: bad offset %q", i+1, fields[1])
+        }
+        t.Offset = off
+        kind, ok := ParseKind(fields[2])
+        if !ok {
+            return nil, fmt.Errorf("line %d: unknown token kind %q", i+1, fields[2])
+        }
+        t.Kind = kind
+        if t.Value, err = strconv.Unquote(fields[3]); err != nil {
+            return nil, fmt.Errorf("line %d: bad value %s", i+1, fields[3])
+        }
+        toks = append(toks, t)
+    }
+    return toks, nil
+}
+
+type jsonToken struct {
+    Kind   string `json:"kind"`
+    Value  string `json:"value"`
+    Line   int    `json:"line"`
+    Col    int    `json:"col"`
+    Offset int    `json:"offset"`
+}
+
+// WriteTokensJSON writes toks as a JSON array of
+// {"kind", "value", "line", "col", "offset"} objects.
+func WriteTokensJSON(w io.Writer, toks []Token) error {
+    out := make([]jsonToken, len(toks))
+    for i, t := range toks {
+        out[i] = jsonToken{Kind: t.Kind.String(), Value: t.Value, Line: t.Line, Col: t.Col, Offset: t.Offset}
+    }
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(out)
+}
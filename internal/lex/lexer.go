@@ -1,13 +1,24 @@
 package lex
 
 import (
+    "sort"
     "unicode"
     "strings"
 )
 
 // Python keywords (subset for demo; use full list in production)
 var pythonKeywords = map[string]struct{}{
-    "if": {}, "elif": {}, "else": {}, "while": {}, "for": {}, "def": {}, "return": {}, "try": {}, "except": {}, "finally": {}, "None": {}, "import": {}, "var": {},
+    "if": {}, "elif": {}, "else": {}, "while": {}, "for": {}, "def": {}, "return": {}, "try": {}, "except": {}, "finally": {}, "None": {}, "import": {}, "from": {}, "as": {}, "var": {}, "assert": {},
+}
+
+// Keywords returns the keywords, sorted.
+func Keywords() []string {
+    words := make([]string, 0, len(pythonKeywords))
+    for w := range pythonKeywords {
+        words = append(words, w)
+    }
+    sort.Strings(words)
+    return words
 }
 
 // Lexer holds state for lexing.
@@ -26,6 +37,8 @@ func NewLexer(src string) *Lexer {
 func (lx *Lexer) Next() Token {
     for lx.offset < len(lx.src) {
         ch := lx.src[lx.offset]
+        // Tokens are positioned at their first byte.
+        line, col := lx.line, lx.col
         switch ch {
         case ' ', '\t', '\r':
             start := lx.offset
@@ -33,55 +46,55 @@ func (lx *Lexer) Next() Token {
                 lx.offset++
                 lx.col++
             }
-            return Token{Kind: TokenWhitespace, Value: lx.src[start:lx.offset], Offset: start, Line: lx.line, Col: lx.col}
+            return Token{Kind: TokenWhitespace, Value: lx.src[start:lx.offset], Offset: start, Line: line, Col: col}
         case '\n':
             lx.offset++
             lx.line++
             lx.col = 1
-            return Token{Kind: TokenWhitespace, Value: "\n", Offset: lx.offset - 1, Line: lx.line - 1, Col: 1}
+            return Token{Kind: TokenWhitespace, Value: "\n", Offset: lx.offset - 1, Line: line, Col: col}
         case '#':
             start := lx.offset
             for lx.offset < len(lx.src) && lx.src[lx.offset] != '\n' {
                 lx.offset++
                 lx.col++
             }
-            return Token{Kind: TokenComment, Value: lx.src[start:lx.offset], Offset: start, Line: lx.line, Col: lx.col}
+            return Token{Kind: TokenComment, Value: lx.src[start:lx.offset], Offset: start, Line: line, Col: col}
         case '{':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenLBrace, Value: "{", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenLBrace, Value: "{", Offset: lx.offset - 1, Line: line, Col: col}
         case '}':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenRBrace, Value: "}", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenRBrace, Value: "}", Offset: lx.offset - 1, Line: line, Col: col}
         case '(':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenLParen, Value: "(", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenLParen, Value: "(", Offset: lx.offset - 1, Line: line, Col: col}
         case ')':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenRParen, Value: ")", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenRParen, Value: ")", Offset: lx.offset - 1, Line: line, Col: col}
         case '[':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenLBracket, Value: "[", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenLBracket, Value: "[", Offset: lx.offset - 1, Line: line, Col: col}
         case ']':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenRBracket, Value: "]", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenRBracket, Value: "]", Offset: lx.offset - 1, Line: line, Col: col}
         case ',':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenComma, Value: ",", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenComma, Value: ",", Offset: lx.offset - 1, Line: line, Col: col}
         case ':':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenColon, Value: ":", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenColon, Value: ":", Offset: lx.offset - 1, Line: line, Col: col}
         case '.':
             lx.offset++
             lx.col++
-            return Token{Kind: TokenDot, Value: ".", Offset: lx.offset - 1, Line: lx.line, Col: lx.col - 1}
+            return Token{Kind: TokenDot, Value: ".", Offset: lx.offset - 1, Line: line, Col: col}
         case '"', '\'':
             quote := ch
             start := lx.offset
@@ -100,7 +113,7 @@ func (lx *Lexer) Next() Token {
                 lx.offset++
                 lx.col++
             }
-            return Token{Kind: TokenString, Value: lx.src[start:lx.offset], Offset: start, Line: lx.line, Col: lx.col}
+            return Token{Kind: TokenString, Value: lx.src[start:lx.offset], Offset: start, Line: line, Col: col}
         default:
             if unicode.IsDigit(rune(ch)) {
                 start := lx.offset
@@ -108,7 +121,7 @@ func (lx *Lexer) Next() Token {
                     lx.offset++
                     lx.col++
                 }
-                return Token{Kind: TokenNumber, Value: lx.src[start:lx.offset], Offset: start, Line: lx.line, Col: lx.col}
+                return Token{Kind: TokenNumber, Value: lx.src[start:lx.offset], Offset: start, Line: line, Col: col}
             }
             if unicode.IsLetter(rune(ch)) || ch == '_' {
                 start := lx.offset
@@ -118,9 +131,9 @@ func (lx *Lexer) Next() Token {
                 }
                 val := lx.src[start:lx.offset]
                 if _, ok := pythonKeywords[val]; ok {
-                    return Token{Kind: TokenKeyword, Value: val, Offset: start, Line: lx.line, Col: lx.col}
+                    return Token{Kind: TokenKeyword, Value: val, Offset: start, Line: line, Col: col}
                 }
-                return Token{Kind: TokenIdent, Value: val, Offset: start, Line: lx.line, Col: lx.col}
+                return Token{Kind: TokenIdent, Value: val, Offset: start, Line: line, Col: col}
             }
             // Operators
             ops := "+-*/%==!=<><=>=&&||!"
@@ -133,13 +146,13 @@ func (lx *Lexer) Next() Token {
                     lx.offset++
                     lx.col++
                 }
-                return Token{Kind: TokenOp, Value: lx.src[start:lx.offset], Offset: start, Line: lx.line, Col: lx.col}
+                return Token{Kind: TokenOp, Value: lx.src[start:lx.offset], Offset: start, Line: line, Col: col}
             }
             // Unknown char: error token
             start := lx.offset
             lx.offset++
             lx.col++
-            return Token{Kind: TokenError, Value: lx.src[start:lx.offset], Offset: start, Line: lx.line, Col: lx.col}
+            return Token{Kind: TokenError, Value: lx.src[start:lx.offset], Offset: start, Line: line, Col: col}
         }
     }
     return Token{Kind: TokenEOF, Value: "", Offset: lx.offset, Line: lx.line, Col: lx.col}
@@ -1,7 +1,11 @@
 package lex
 
 import (
+    "reflect"
+    "strings"
     "testing"
+
+    "rayo/internal/testutil"
 )
 
 func TestLexer_TableDriven(t *testing.T) {
@@ -42,3 +46,59 @@ func TestLexer_TableDriven(t *testing.T) {
         })
     }
 }
+
+func TestLexer_Positions(t *testing.T) {
+    toks := Tokenize("def f {\n  x = 'a'\n}", false)
+    want := []struct {
+        value     string
+        line, col int
+        offset    int
+    }{
+        {"def", 1, 1, 0}, {"f", 1, 5, 4}, {"{", 1, 7, 6},
+        {"x", 2, 3, 10}, {"=", 2, 5, 12}, {"'a'", 2, 7, 14},
+        {"}", 3, 1, 18}, {"", 3, 2, 19},
+    }
+    if len(toks) != len(want) {
+        t.Fatalf("got %d tokens, want %d:\n%s", len(toks), len(want), FormatTokens(toks))
+    }
+    for i, w := range want {
+        tok := toks[i]
+        if tok.Value != w.value || tok.Line != w.line || tok.Col != w.col || tok.Offset != w.offset {
+            t.Errorf("token %d: got %q at %d:%d (%d), want %q at %d:%d (%d)", i, tok.Value, tok.Line, tok.Col, tok.Offset, w.value, w.line, w.col, w.offset)
+        }
+    }
+}
+
+func TestTokenDumpRoundTrip(t *testing.T) {
+    toks := Tokenize("# note\nprint(\"a\\tb\") @\n", true)
+    dump := FormatTokens(toks)
+    if !strings.HasPrefix(dump, "1:1\t0\tComment\t\"# note\"\n1:7\t6\tWhitespace\t\"\\n\"\n2:1\t7\tIdent\t\"print\"\n") {
+        t.Errorf("unexpected dump:\n%s", dump)
+    }
+    back, err := ReadTokens(dump)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(back, toks) {
+        t.Errorf("round trip mismatch:\n%s\nvs\n%s", FormatTokens(back), dump)
+    }
+}
+
+func TestGoldenTokens(t *testing.T) {
+    cases, err := testutil.LoadGoldenCases("../../testdata/golden")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, c := range cases {
+        want, ok := c.Expect["tokens"]
+        if !ok {
+            continue
+        }
+        t.Run(c.Name, func(t *testing.T) {
+            got := FormatTokens(Tokenize(c.Source, true))
+            if d := testutil.Diff(want, got); d != "" {
+                t.Errorf("token dump mismatch:\n%s", d)
+            }
+        })
+    }
+}
@@ -1,5 +1,7 @@
 package lex
 
+import "fmt"
+
 // TokenKind enumerates all token types.
 type TokenKind int
 
@@ -32,3 +34,47 @@ type Token struct {
     Line   int // 1-based line
     Col    int // 1-based col
 }
+
+var kindNames = [...]string{
+    TokenEOF:        "EOF",
+    TokenIdent:      "Ident",
+    TokenNumber:     "Number",
+    TokenString:     "String",
+    TokenLBrace:     "LBrace",
+    TokenRBrace:     "RBrace",
+    TokenLParen:     "LParen",
+    TokenRParen:     "RParen",
+    TokenLBracket:   "LBracket",
+    TokenRBracket:   "RBracket",
+    TokenComma:      "Comma",
+    TokenColon:      "Colon",
+    TokenDot:        "Dot",
+    TokenOp:         "Op",
+    TokenKeyword:    "Keyword",
+    TokenComment:    "Comment",
+    TokenWhitespace: "Whitespace",
+    TokenError:      "Error",
+}
+
+// String returns the kind name used in token dumps, e.g. "Ident".
+func (k TokenKind) String() string {
+    if k >= 0 && int(k) < len(kindNames) {
+        return kindNames[k]
+    }
+    return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// ParseKind returns the kind with the given name.
+func ParseKind(name string) (TokenKind, bool) {
+    for k, n := range kindNames {
+        if n == name {
+            return TokenKind(k), true
+        }
+    }
+    return 0, false
+}
+
+// IsTrivia reports whether the token is whitespace or a comment.
+func (t Token) IsTrivia() bool {
+    return t.Kind == TokenWhitespace || t.Kind == TokenComment
+}
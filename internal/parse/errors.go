@@ -1,6 +1,12 @@
 package parse
 
-import "rayo/internal/diag"
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "rayo/internal/diag"
+)
 
 // ParseError represents a parser error with diagnostics.
 type ParseError struct {
@@ -10,6 +16,43 @@ type ParseError struct {
     Excerpt string
 }
 
+// Error returns the message, completed with what was expected and what was
+// found instead when the parser recorded it, e.g.
+// `expected function name, found "("`.
 func (e *ParseError) Error() string {
-    return e.Msg
+    if len(e.Expected) == 0 {
+        return e.Msg
+    }
+    found := "end of file"
+    if e.Excerpt != "" {
+        found = strconv.Quote(e.Excerpt)
+    }
+    if e.Msg == "" || e.Msg == "unexpected token" {
+        return fmt.Sprintf("expected %s, found %s", e.expected(), found)
+    }
+    return fmt.Sprintf("%s, found %s", e.Msg, found)
+}
+
+func (e *ParseError) expected() string {
+    quoted := make([]string, len(e.Expected))
+    for i, x := range e.Expected {
+        if x == "identifier" || x == "number" || x == "string" || x == "keyword" || x == "expression" || x == "statement" || x == "newline" || x == "token" {
+            quoted[i] = x
+        } else {
+            quoted[i] = "'" + x + "'"
+        }
+    }
+    return strings.Join(quoted, " or ")
+}
+
+// CodeSyntax is the diagnostic code of syntax errors.
+const CodeSyntax = "E0001"
+
+// Diagnostic returns the error as a diagnostic.
+func (e *ParseError) Diagnostic() diag.Diagnostic {
+    d := diag.Diagnostic{Severity: diag.Error, Code: CodeSyntax, Span: e.Span, Msg: e.Error()}
+    if len(e.Expected) > 0 {
+        d.Label = "expected " + e.expected()
+    }
+    return d
 }
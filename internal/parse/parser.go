@@ -5,6 +5,7 @@ import (
 	"rayo/internal/diag"
 	"rayo/internal/lex"
 	"strconv"
+	"strings"
 )
 
 // Parser implements a recursive-descent parser for Rayo.
@@ -12,6 +13,17 @@ type Parser struct {
 	lx     *lex.Lexer
 	tok    lex.Token
 	errors []error
+	// prevEnd is the end of the last token consumed, where the span of the
+	// node being parsed ends.
+	prevEnd diag.SourcePos
+	// tokens holds every token read, trivia included.
+	tokens []lex.Token
+	// comments are the comment groups read so far. lead is the group on
+	// the lines right above the current token, which documents it.
+	comments  []*ast.CommentGroup
+	lead      *ast.CommentGroup
+	ownLine   bool // the last group started on a line of its own
+	groupLine int  // the line of the last comment of the last group
 }
 
 func NewParser(src string) *Parser {
@@ -25,101 +37,316 @@ func (p *Parser) Errors() []error {
 	return p.errors
 }
 
-func (p *Parser) parseFuncDef() ast.Stmt {
-	p.expect(lex.TokenKeyword) // 'def'
+// Tokens returns every token read by the parser, whitespace and comments
+// included, ending with EOF once the module is parsed. Together with the
+// spans of the nodes they form a lossless view of the source: the values
+// of the tokens concatenate to exactly the source text.
+func (p *Parser) Tokens() []lex.Token {
+	return p.tokens
+}
 
-	// Skip whitespace
-	for p.tok.Kind == lex.TokenWhitespace {
-		p.next()
+// tokenStart returns the position of the first byte of tok.
+func tokenStart(tok lex.Token) diag.SourcePos {
+	return diag.SourcePos{Offset: tok.Offset, Line: tok.Line, Col: tok.Col}
+}
+
+// tokenEnd returns the position just past the last byte of tok.
+func tokenEnd(tok lex.Token) diag.SourcePos {
+	end := diag.SourcePos{Offset: tok.Offset + len(tok.Value), Line: tok.Line, Col: tok.Col + len(tok.Value)}
+	if i := strings.LastIndexByte(tok.Value, '\n'); i >= 0 {
+		end.Line += strings.Count(tok.Value, "\n")
+		end.Col = len(tok.Value) - i
 	}
+	return end
+}
 
-	// Function name
-	if p.tok.Kind != lex.TokenIdent {
-		err := &ParseError{Msg: "expected function name", Span: diag.Span{}, Expected: []string{"identifier"}, Excerpt: p.tok.Value}
-		p.errors = append(p.errors, err)
-		return nil
+// tokenSpan returns the span of the current token, where syntax errors are
+// reported.
+func (p *Parser) tokenSpan() diag.Span {
+	return diag.Span{Start: tokenStart(p.tok), End: tokenEnd(p.tok)}
+}
+
+// pos returns the start of the current token, where a node parsed from it
+// begins.
+func (p *Parser) pos() diag.SourcePos {
+	return tokenStart(p.tok)
+}
+
+// spanFrom returns the span from start to the end of the last consumed
+// token.
+func (p *Parser) spanFrom(start diag.SourcePos) diag.Span {
+	return diag.Span{Start: start, End: p.prevEnd}
+}
+
+// maxErrors is the number of syntax errors reported for a file: past that
+// point most errors are consequences of earlier ones. Parsing goes on to the
+// end of the file, so that the tree is complete.
+const maxErrors = 10
+
+// error records a syntax error at the current token. Only the first error
+// on a line is kept, since the parser resynchronizes at the next line and
+// anything reported in between is usually a consequence of that error.
+func (p *Parser) error(msg string, expected ...string) {
+	span := p.tokenSpan()
+	n := len(p.errors)
+	if n > maxErrors {
+		return
 	}
+	if n > 0 {
+		if last, ok := p.errors[n-1].(*ParseError); ok && last.Span.Start.Line == span.Start.Line {
+			return
+		}
+	}
+	if n == maxErrors {
+		p.errors = append(p.errors, &ParseError{Msg: "too many errors", Span: span})
+		return
+	}
+	p.errors = append(p.errors, &ParseError{Msg: msg, Span: span, Expected: expected, Excerpt: p.tok.Value})
+}
 
-	name := p.tok.Value
-	p.next()
+// stmtKeywords are the keywords that begin a statement, where parsing
+// resumes after a syntax error.
+var stmtKeywords = map[string]bool{
+	"def": true, "var": true, "if": true, "while": true, "for": true, "return": true,
+	"try": true, "import": true, "from": true, "assert": true,
+}
 
-	// Skip whitespace
-	for p.tok.Kind == lex.TokenWhitespace {
+// sync skips tokens after a syntax error up to a point where parsing can
+// resume: a statement keyword, the first token of a new line, a '}' closing
+// the current block or the end of the file. Blocks and bracketed
+// expressions opened on the way are skipped whole, even across lines.
+func (p *Parser) sync() {
+	depth := 0
+	for p.tok.Kind != lex.TokenEOF {
+		if depth == 0 && (p.tok.Kind == lex.TokenRBrace || p.tok.Line > p.prevEnd.Line ||
+			p.tok.Kind == lex.TokenKeyword && stmtKeywords[p.tok.Value]) {
+			return
+		}
+		switch p.tok.Kind {
+		case lex.TokenLBrace, lex.TokenLParen, lex.TokenLBracket:
+			depth++
+		case lex.TokenRBrace, lex.TokenRParen, lex.TokenRBracket:
+			depth = max(depth-1, 0)
+		}
 		p.next()
 	}
+}
 
-	// Parameters '(' ... ')'
-	if p.tok.Kind != lex.TokenLParen {
-		err := &ParseError{Msg: "expected '(' after function name", Span: diag.Span{}, Expected: []string{"("}, Excerpt: p.tok.Value}
-		p.errors = append(p.errors, err)
-		return nil
+// endStmt is called after each statement of a block or module, with the
+// number of errors reported before it. A statement must end at a line
+// break, a '}' or the end of the file; after an error, the rest of the
+// statement is skipped.
+func (p *Parser) endStmt(nerr int) {
+	if len(p.errors) > nerr {
+		p.sync()
+		return
+	}
+	if p.tok.Kind == lex.TokenEOF || p.tok.Kind == lex.TokenRBrace || p.tok.Line > p.prevEnd.Line {
+		return
 	}
+	p.error("expected end of statement", "newline", "}")
+	p.sync()
+}
+
+// badStmt reports that the current token cannot begin a statement and
+// skips to the next statement, returning a BadStmt that covers the
+// skipped source.
+func (p *Parser) badStmt() ast.Stmt {
+	start := p.pos()
+	p.error("expected statement", "statement")
 	p.next()
+	p.sync()
+	return ast.NewBadStmt(p.spanFrom(start))
+}
 
-	// For now, skip parameter parsing and just expect ')'
-	for p.tok.Kind != lex.TokenRParen && p.tok.Kind != 0 { // 0 is EOF
-		p.next()
-	}
+func (p *Parser) parseFuncDef() ast.Stmt {
+	start := p.pos()
+	doc := p.lead
+	p.expect(lex.TokenKeyword) // 'def'
 
-	if p.tok.Kind == lex.TokenRParen {
+	// A definition without a name is still parsed, so that errors in its
+	// body are reported too.
+	name := ""
+	if p.tok.Kind == lex.TokenIdent {
+		name = p.tok.Value
 		p.next()
+	} else {
+		p.error("expected function name", "identifier")
 	}
 
-	// Skip whitespace
-	for p.tok.Kind == lex.TokenWhitespace {
+	params := []*ast.Param{}
+	if p.tok.Kind == lex.TokenLParen {
 		p.next()
+		params = p.parseParams()
+		p.expect(lex.TokenRParen)
+	} else {
+		p.error("expected '(' after function name", "(")
 	}
 
 	// Function body '{ ... }'
 	body := p.parseBlock()
 
-	// Return a basic function definition
-	return &ast.FuncDef{
+	fn := &ast.FuncDef{
+		Doc:    doc,
 		Name:   name,
-		Params: []*ast.Param{}, // Empty for now
+		Params: params,
 		Body:   body,
 	}
+	fn.SetSpan(p.spanFrom(start))
+	return fn
 }
 
-func (p *Parser) parseBlock() []ast.Stmt {
-	p.expect(lex.TokenLBrace)
-	var stmts []ast.Stmt
-	for p.tok.Kind != lex.TokenRBrace && p.tok.Kind != lex.TokenEOF {
-		// Skip semicolons or newlines if we had them, but for now just whitespace loop in next() handles it.
-		// However, we might want to be robust.
-		if p.tok.Kind == lex.TokenWhitespace {
+// parseParams parses the parameters of a definition, up to the closing
+// parenthesis: names, each with an optional ': type'. Types are kept as
+// written, as the type checker does not read them yet.
+func (p *Parser) parseParams() []*ast.Param {
+	params := []*ast.Param{}
+	for p.tok.Kind != lex.TokenRParen && p.tok.Kind != lex.TokenLBrace && p.tok.Kind != lex.TokenEOF {
+		start := p.pos()
+		if p.tok.Kind != lex.TokenIdent {
+			p.error("expected parameter name", "identifier")
+			p.skipParam()
+		} else {
+			param := &ast.Param{Name: p.tok.Value}
 			p.next()
-			continue
+			if p.tok.Kind == lex.TokenColon {
+				p.next()
+				if typ := p.parseParamType(); typ != "" {
+					param.Type = typ
+				} else {
+					p.error("expected parameter type", "type")
+				}
+			}
+			if p.tok.Kind == lex.TokenOp && p.tok.Value == "=" {
+				p.error("default parameter values are not supported yet")
+				p.skipParam()
+			}
+			param.SetSpan(p.spanFrom(start))
+			params = append(params, param)
 		}
-		stmt := p.parseStmt()
-		if stmt != nil {
-			stmts = append(stmts, stmt)
-		} else {
-			// If we can't parse a statement, we should probably skip a token to avoid infinite loop
-			// or break if it looks like end of block
-			if p.tok.Kind == lex.TokenRBrace {
-				break
+		if p.tok.Kind != lex.TokenComma {
+			break
+		}
+		p.next()
+	}
+	return params
+}
+
+// parseParamType returns the source of a parameter type, e.g. list[int]
+// or def(int) -> bool, written with the usual spacing.
+func (p *Parser) parseParamType() string {
+	var b strings.Builder
+	depth := 0
+	for p.tok.Kind != lex.TokenEOF && p.tok.Kind != lex.TokenLBrace {
+		switch p.tok.Kind {
+		case lex.TokenLParen, lex.TokenLBracket:
+			depth++
+		case lex.TokenRParen, lex.TokenRBracket:
+			if depth == 0 {
+				return b.String()
+			}
+			depth--
+		case lex.TokenComma:
+			if depth == 0 {
+				return b.String()
+			}
+		case lex.TokenOp:
+			if p.tok.Value == "=" && depth == 0 {
+				return b.String()
+			}
+		}
+		switch {
+		case p.tok.Kind == lex.TokenComma:
+			b.WriteString(", ")
+		case p.tok.Kind == lex.TokenOp:
+			b.WriteString(" " + p.tok.Value + " ")
+		default:
+			b.WriteString(p.tok.Value)
+		}
+		p.next()
+	}
+	return b.String()
+}
+
+// skipParam skips to the end of the current parameter.
+func (p *Parser) skipParam() {
+	depth := 0
+	for p.tok.Kind != lex.TokenEOF && p.tok.Kind != lex.TokenLBrace {
+		switch p.tok.Kind {
+		case lex.TokenLParen, lex.TokenLBracket:
+			depth++
+		case lex.TokenRParen, lex.TokenRBracket:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case lex.TokenComma:
+			if depth == 0 {
+				return
 			}
-			p.next()
 		}
+		p.next()
+	}
+}
+
+// parseBlock parses '{' statements '}'. When the opening brace is missing
+// the statements are still parsed, up to the next '}'.
+func (p *Parser) parseBlock() []ast.Stmt {
+	p.expect(lex.TokenLBrace)
+	var stmts []ast.Stmt
+	for p.tok.Kind != lex.TokenRBrace && p.tok.Kind != lex.TokenEOF {
+		nerr := len(p.errors)
+		stmts = append(stmts, p.parseStmt())
+		p.endStmt(nerr)
 	}
 	p.expect(lex.TokenRBrace)
 	return stmts
 }
 
+// next advances to the next token, skipping whitespace and collecting
+// comments.
 func (p *Parser) next() {
+	p.prevEnd = tokenEnd(p.tok)
+	ncomments := len(p.comments)
 	for {
 		p.tok = p.lx.Next()
-		if p.tok.Kind != lex.TokenWhitespace {
+		p.tokens = append(p.tokens, p.tok)
+		if p.tok.Kind == lex.TokenComment {
+			p.comment()
+		}
+		if !p.tok.IsTrivia() {
 			break
 		}
 	}
+	p.lead = nil
+	if len(p.comments) > ncomments && p.ownLine && p.groupLine == p.tok.Line-1 {
+		p.lead = p.comments[len(p.comments)-1]
+	}
 }
 
+// comment adds the current token, a comment, to the comment groups: it
+// extends the last group if both are on lines of their own with no line
+// in between.
+func (p *Parser) comment() {
+	c := ast.NewComment(strings.TrimRight(p.tok.Value, "\r"), diag.Span{Start: tokenStart(p.tok), End: tokenEnd(p.tok)})
+	ownLine := p.tok.Line > p.prevEnd.Line
+	if n := len(p.comments); n > 0 && ownLine && p.ownLine && p.groupLine == p.tok.Line-1 {
+		g := p.comments[n-1]
+		g.List = append(g.List, c)
+	} else {
+		p.comments = append(p.comments, &ast.CommentGroup{List: []*ast.Comment{c}})
+		p.ownLine = ownLine
+	}
+	p.groupLine = p.tok.Line
+}
+
+// expect consumes a token of the given kind. Otherwise it reports an error
+// and returns the zero Token, leaving the current token for the caller or
+// for error recovery.
 func (p *Parser) expect(kind lex.TokenKind) lex.Token {
 	if p.tok.Kind != kind {
-		err := &ParseError{Msg: "unexpected token", Span: diag.Span{}, Expected: []string{kindToString(kind)}, Excerpt: p.tok.Value}
-		p.errors = append(p.errors, err)
+		p.error("unexpected token", kindToString(kind))
+		return lex.Token{}
 	}
 	tok := p.tok
 	p.next()
@@ -140,139 +367,222 @@ func kindToString(kind lex.TokenKind) string {
 		return "{"
 	case lex.TokenRBrace:
 		return "}"
+	case lex.TokenLParen:
+		return "("
+	case lex.TokenRParen:
+		return ")"
+	case lex.TokenRBracket:
+		return "]"
+	case lex.TokenColon:
+		return ":"
 	// ...extend as needed...
 	default:
 		return "token"
 	}
 }
 
-// ParseModule parses a module.
+// ParseModule parses a module. Syntax errors do not stop the parse: the
+// parser skips to the next statement and carries on, leaving BadStmt and
+// BadExpr nodes where the source could not be read.
 func (p *Parser) ParseModule() *ast.Module {
 	mod := &ast.Module{Imports: []*ast.Import{}, Body: []ast.Stmt{}}
-	// Example: parse imports and body
+	start := diag.SourcePos{Offset: 0, Line: 1, Col: 1}
 	for p.tok.Kind != lex.TokenEOF {
-		// Skip any whitespace tokens between statements
-		for p.tok.Kind == lex.TokenWhitespace {
+		nerr := len(p.errors)
+		switch {
+		case p.tok.Kind == lex.TokenKeyword && p.tok.Value == "import":
+			mod.Imports = append(mod.Imports, p.parseImport())
+		case p.tok.Kind == lex.TokenKeyword && p.tok.Value == "from":
+			mod.Imports = append(mod.Imports, p.parseFromImport())
+		case p.tok.Kind == lex.TokenRBrace:
+			mod.Body = append(mod.Body, p.badStmt())
+		default:
+			mod.Body = append(mod.Body, p.parseStmt())
+		}
+		p.endStmt(nerr)
+	}
+	mod.Comments = p.comments
+	mod.SetSpan(diag.Span{Start: start, End: p.pos()})
+	return mod
+}
+
+func (p *Parser) parseImport() *ast.Import {
+	start := p.pos()
+	p.expect(lex.TokenKeyword) // 'import'
+	imp := &ast.Import{Path: p.parseImportPath()}
+	if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "as" {
+		p.next()
+		imp.Alias = p.expect(lex.TokenIdent).Value
+	}
+	imp.SetSpan(p.spanFrom(start))
+	return imp
+}
+
+// parseFromImport parses `from "path" import name, name as alias`.
+func (p *Parser) parseFromImport() *ast.Import {
+	start := p.pos()
+	p.expect(lex.TokenKeyword) // 'from'
+	imp := &ast.Import{Path: p.parseImportPath()}
+	if p.tok.Kind != lex.TokenKeyword || p.tok.Value != "import" {
+		p.error("expected 'import' after module path", "import")
+		imp.SetSpan(p.spanFrom(start))
+		return imp
+	}
+	p.next()
+	for {
+		nameStart := p.pos()
+		name := &ast.ImportName{Name: p.expect(lex.TokenIdent).Value}
+		if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "as" {
 			p.next()
+			name.Alias = p.expect(lex.TokenIdent).Value
 		}
-		if p.tok.Kind == lex.TokenEOF {
+		name.SetSpan(p.spanFrom(nameStart))
+		imp.Names = append(imp.Names, name)
+		if p.tok.Kind != lex.TokenComma {
 			break
 		}
-		// Handle imports
-		if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "import" {
-			imp := p.parseImport()
-			mod.Imports = append(mod.Imports, imp)
-			continue
-		}
-		// Try to parse a statement
-		if p.tok.Kind != lex.TokenWhitespace {
-			stmt := p.parseStmt()
-			if stmt != nil {
-				mod.Body = append(mod.Body, stmt)
-				continue
-			}
-		}
-		// If not a statement or failed to parse, advance token
 		p.next()
 	}
-	return mod
+	imp.SetSpan(p.spanFrom(start))
+	return imp
 }
 
-func (p *Parser) parseImport() *ast.Import {
-	p.expect(lex.TokenKeyword) // 'import'
+func (p *Parser) parseImportPath() string {
 	pathTok := p.expect(lex.TokenString)
 	val := pathTok.Value
 	if len(val) >= 2 && (val[0] == '\'' || val[0] == '"') && val[len(val)-1] == val[0] {
 		val = val[1 : len(val)-1]
 	}
-	return &ast.Import{Path: val}
+	return val
 }
 
+// parseStmt parses a statement, which the caller has checked does not
+// start at a '}' or the end of the file.
 func (p *Parser) parseStmt() ast.Stmt {
-	// Skip whitespace
-	for p.tok.Kind == lex.TokenWhitespace {
+	start := p.pos()
+	if p.tok.Kind == lex.TokenKeyword {
+		switch p.tok.Value {
+		case "def":
+			return p.parseFuncDef()
+		case "return":
+			return p.parseReturn()
+		case "if":
+			return p.parseIf()
+		case "var":
+			return p.parseVar()
+		case "assert":
+			return p.parseAssert()
+		case "None":
+			// An expression statement.
+		default:
+			return p.badStmt()
+		}
+	} else if !p.atExprStart() {
+		return p.badStmt()
+	}
+
+	// Assignment or expression statement: parse the left-hand side as an
+	// expression, and treat it as the assignment target if '=' follows.
+	expr := p.parseExpr()
+	if p.tok.Kind == lex.TokenOp && p.tok.Value == "=" {
 		p.next()
+		rhs := p.parseExpr()
+		stmt := &ast.AssignStmt{Target: expr, Value: rhs}
+		stmt.SetSpan(p.spanFrom(start))
+		return stmt
 	}
 
-	if p.tok.Kind == lex.TokenEOF || p.tok.Kind == lex.TokenRBrace {
-		return nil
+	stmt := &ast.ExprStmt{Expr: expr}
+	stmt.SetSpan(p.spanFrom(start))
+	return stmt
+}
+
+// parseElems parses the comma-separated elements of a call, list or dict
+// literal up to the closing token, which it consumes. A trailing comma is
+// allowed, so that elements can be written one per line.
+func (p *Parser) parseElems(close lex.TokenKind, elem func()) {
+	for p.tok.Kind != close && p.tok.Kind != lex.TokenEOF {
+		elem()
+		if p.tok.Kind != lex.TokenComma {
+			break
+		}
+		p.next()
 	}
+	p.expect(close)
+}
 
-	// Function definition: def name() { ... }
-	if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "def" {
-		return p.parseFuncDef()
+// atExprStart reports whether the current token can begin an expression.
+func (p *Parser) atExprStart() bool {
+	switch p.tok.Kind {
+	case lex.TokenNumber, lex.TokenString, lex.TokenIdent, lex.TokenLParen, lex.TokenLBracket:
+		return true
+	case lex.TokenKeyword:
+		return p.tok.Value == "None"
 	}
+	return false
+}
 
-	// Return statement
-	if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "return" {
-		p.next()
-		var val ast.Expr
-		// If next token is not newline/semicolon/RBrace, parse expression
-		// For now assume if not RBrace, try parse expression
-		if p.tok.Kind != lex.TokenRBrace && p.tok.Kind != lex.TokenEOF {
-			val = p.parseExpr()
-		}
-		return &ast.ReturnStmt{Value: val}
+func (p *Parser) parseReturn() ast.Stmt {
+	start := p.pos()
+	p.next() // 'return'
+	var val ast.Expr
+	// The value, if any, is on the same line.
+	if p.tok.Kind != lex.TokenRBrace && p.tok.Kind != lex.TokenEOF && p.tok.Line == p.prevEnd.Line {
+		val = p.parseExpr()
 	}
+	ret := &ast.ReturnStmt{Value: val}
+	ret.SetSpan(p.spanFrom(start))
+	return ret
+}
 
-	// If statement
-	if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "if" {
+// parseAssert parses `assert test` or `assert test, msg`.
+func (p *Parser) parseAssert() ast.Stmt {
+	start := p.pos()
+	p.next() // 'assert'
+	stmt := &ast.AssertStmt{Test: p.parseExpr()}
+	if p.tok.Kind == lex.TokenComma {
 		p.next()
-		cond := p.parseExpr()
-		body := p.parseBlock()
-		var elseBody []ast.Stmt
-		// Check for else
-		// For simplicity, skip whitespace
-		for p.tok.Kind == lex.TokenWhitespace {
-			p.next()
-		}
-		if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "else" {
-			p.next()
-			elseBody = p.parseBlock()
-		}
-		return &ast.IfStmt{Cond: cond, Then: body, Else: elseBody}
+		stmt.Msg = p.parseExpr()
 	}
+	stmt.SetSpan(p.spanFrom(start))
+	return stmt
+}
 
-	// Var statement (if kept)
-	if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "var" {
-		p.next()
-		// Expect identifier
-		if p.tok.Kind != lex.TokenIdent {
-			return nil
-		}
-		nameTok := p.tok
-		p.next()
-		// Expect '='
-		if p.tok.Kind != lex.TokenOp || p.tok.Value != "=" {
-			return nil
-		}
+func (p *Parser) parseIf() ast.Stmt {
+	start := p.pos()
+	p.next() // 'if'
+	cond := p.parseExpr()
+	body := p.parseBlock()
+	var elseBody []ast.Stmt
+	if p.tok.Kind == lex.TokenKeyword && p.tok.Value == "else" {
 		p.next()
-		val := p.parseExpr()
-		return &ast.VarStmt{Name: nameTok.Value, Value: val}
+		elseBody = p.parseBlock()
 	}
+	stmt := &ast.IfStmt{Cond: cond, Then: body, Else: elseBody}
+	stmt.SetSpan(p.spanFrom(start))
+	return stmt
+}
 
-	// Assignment or Expression Statement
-	// Peek ahead or parse expression and check if followed by '='
-	// Since we don't have good backtracking, let's parse Left Hand Side expression first.
-	// In Rayo, lvalues are usually identifiers, index expressions, or attributes.
-	// But `parseExpr` parses a full expression.
-	// A simple approach without backtracking: parseExpr(). If next token is '=', treat as assignment target.
-
-	expr := p.parseExpr()
-	if expr == nil {
-		// Could not parse expression, so not a statement
-		return nil
+func (p *Parser) parseVar() ast.Stmt {
+	start := p.pos()
+	p.next() // 'var'
+	if p.tok.Kind != lex.TokenIdent {
+		p.error("expected variable name", "identifier")
+		return ast.NewBadStmt(p.spanFrom(start))
 	}
-
-	// Check for assignment
+	name := p.tok.Value
+	p.next()
+	var val ast.Expr
 	if p.tok.Kind == lex.TokenOp && p.tok.Value == "=" {
 		p.next()
-		rhs := p.parseExpr()
-		return &ast.AssignStmt{Target: expr, Value: rhs}
+		val = p.parseExpr()
+	} else {
+		p.error("expected '=' after variable name", "=")
+		val = ast.NewBadExpr(p.tokenSpan())
 	}
-
-	// Otherwise it's an expression statement
-	return &ast.ExprStmt{Expr: expr}
+	stmt := &ast.VarStmt{Name: name, Value: val}
+	stmt.SetSpan(p.spanFrom(start))
+	return stmt
 }
 
 func (p *Parser) parseExpr() ast.Expr {
@@ -280,37 +590,44 @@ func (p *Parser) parseExpr() ast.Expr {
 }
 
 func (p *Parser) parseComparison() ast.Expr {
+	start := p.pos()
 	expr := p.parseTerm()
 	for p.tok.Kind == lex.TokenOp && (p.tok.Value == "<" || p.tok.Value == ">" || p.tok.Value == "==" || p.tok.Value == "!=") {
 		op := p.tok.Value
 		p.next()
 		right := p.parseTerm()
-		expr = &ast.BinaryOp{Op: op, Left: expr, Right: right}
+		bin := &ast.BinaryOp{Op: op, Left: expr, Right: right}
+		bin.SetSpan(p.spanFrom(start))
+		expr = bin
 	}
 	return expr
 }
 
 func (p *Parser) parseTerm() ast.Expr {
+	start := p.pos()
 	expr := p.parsePrimary()
 	// Loop for +, - (and maybe string concatenation)
 	for p.tok.Kind == lex.TokenOp && (p.tok.Value == "+" || p.tok.Value == "-") {
 		op := p.tok.Value
 		p.next()
 		right := p.parsePrimary()
-		expr = &ast.BinaryOp{Op: op, Left: expr, Right: right}
+		bin := &ast.BinaryOp{Op: op, Left: expr, Right: right}
+		bin.SetSpan(p.spanFrom(start))
+		expr = bin
 	}
 	return expr
 }
 
 func (p *Parser) parsePrimary() ast.Expr {
 	var expr ast.Expr
+	start := p.pos()
 
 	switch p.tok.Kind {
 	case lex.TokenNumber:
 		tok := p.tok
 		p.next()
 		i, _ := strconv.Atoi(tok.Value)
-		expr = &ast.Literal{Value: i}
+		expr = ast.NewLiteral(i, p.spanFrom(start))
 	case lex.TokenString:
 		tok := p.tok
 		val := tok.Value
@@ -319,25 +636,56 @@ func (p *Parser) parsePrimary() ast.Expr {
 			val = val[1 : len(val)-1]
 		}
 		p.next()
-		expr = &ast.Literal{Value: val}
+		expr = ast.NewLiteral(val, p.spanFrom(start))
 	case lex.TokenIdent:
 		tok := p.tok
 		p.next()
-		expr = &ast.Name{Ident: tok.Value}
+		expr = ast.NewName(tok.Value, p.spanFrom(start))
+	case lex.TokenKeyword:
+		if p.tok.Value != "None" {
+			p.error("expected expression", "expression")
+			return ast.NewBadExpr(p.tokenSpan())
+		}
+		p.next()
+		expr = ast.NewLiteral(nil, p.spanFrom(start))
 	case lex.TokenLParen:
+		// A parenthesized expression keeps the span of its contents, but
+		// postfix operators applied to it start at the parenthesis.
 		p.next()
 		expr = p.parseExpr()
-		if p.tok.Kind == lex.TokenRParen {
-			p.next()
-		}
+		p.expect(lex.TokenRParen)
+	case lex.TokenLBracket:
+		p.next()
+		list := &ast.ListLit{}
+		p.parseElems(lex.TokenRBracket, func() {
+			list.Elems = append(list.Elems, p.parseExpr())
+		})
+		list.SetSpan(p.spanFrom(start))
+		expr = list
+	case lex.TokenLBrace:
+		// In expression position a brace opens a dict literal, never a
+		// block.
+		p.next()
+		dict := &ast.DictLit{}
+		p.parseElems(lex.TokenRBrace, func() {
+			key := p.parseExpr()
+			var val ast.Expr
+			if p.tok.Kind == lex.TokenColon {
+				p.next()
+				val = p.parseExpr()
+			} else {
+				p.error("expected ':' after dict key", ":")
+				val = ast.NewBadExpr(p.tokenSpan())
+			}
+			dict.Keys = append(dict.Keys, key)
+			dict.Vals = append(dict.Vals, val)
+		})
+		dict.SetSpan(p.spanFrom(start))
+		expr = dict
 	default:
-		// Try to recover or return error
-		// For now return nil, creating invalid AST but preventing panic?
-		// Better append error
-		// We should not panic.
-		// Returning nil causes trouble upstream.
-		// Let's create an ErrorExpr or similar? Or just return nil.
-		return nil
+		// The token is left for the statement to resynchronize on.
+		p.error("expected expression", "expression")
+		return ast.NewBadExpr(p.tokenSpan())
 	}
 
 	// Handle Postfix: Calls, Index, Attributes
@@ -346,39 +694,28 @@ func (p *Parser) parsePrimary() ast.Expr {
 			// Call
 			p.next()
 			var args []ast.Expr
-			if p.tok.Kind != lex.TokenRParen {
-				for {
-					arg := p.parseExpr()
-					if arg != nil {
-						args = append(args, arg)
-					}
-					if p.tok.Kind == lex.TokenComma {
-						p.next()
-					} else {
-						break
-					}
-				}
-			}
-			if p.tok.Kind == lex.TokenRParen {
-				p.next()
-			}
-			expr = &ast.Call{Func: expr, Args: args}
+			p.parseElems(lex.TokenRParen, func() {
+				args = append(args, p.parseExpr())
+			})
+			call := &ast.Call{Func: expr, Args: args}
+			call.SetSpan(p.spanFrom(start))
+			expr = call
 		} else if p.tok.Kind == lex.TokenLBracket {
 			// Index
 			p.next()
 			idx := p.parseExpr()
-			if p.tok.Kind == lex.TokenRBracket {
-				p.next()
-			}
-			expr = &ast.Index{Target: expr, Index: idx}
+			p.expect(lex.TokenRBracket)
+			index := &ast.Index{Target: expr, Index: idx}
+			index.SetSpan(p.spanFrom(start))
+			expr = index
 		} else if p.tok.Kind == lex.TokenDot {
 			// Attribute or Method Call
+			// A missing name leaves an Attr without one, as typed by
+			// someone about to complete it.
 			p.next()
-			if p.tok.Kind == lex.TokenIdent {
-				attrName := p.tok.Value
-				p.next()
-				expr = &ast.Attr{Target: expr, Attr: attrName}
-			}
+			attr := &ast.Attr{Target: expr, Attr: p.expect(lex.TokenIdent).Value}
+			attr.SetSpan(p.spanFrom(start))
+			expr = attr
 		} else {
 			break
 		}
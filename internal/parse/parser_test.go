@@ -1,7 +1,12 @@
 package parse
 
 import (
+    "fmt"
+    "strings"
     "testing"
+
+    "rayo/internal/ast"
+    "rayo/internal/testutil"
 )
 
 func TestParser_ParseModule(t *testing.T) {
@@ -30,3 +35,325 @@ func TestParser_ParseModule(t *testing.T) {
         }
     }
 }
+
+func TestParser_ModuleImports(t *testing.T) {
+    src := "import \"./utils.ryo\" as u\nfrom \"./shapes.ryo\" import area, perimeter\nimport \"os\""
+    p := NewParser(src)
+    mod := p.ParseModule()
+    if len(p.Errors()) > 0 {
+        t.Fatalf("unexpected parse errors: %v", p.Errors())
+    }
+    if len(mod.Imports) != 3 {
+        t.Fatalf("expected 3 imports, got %d", len(mod.Imports))
+    }
+    if imp := mod.Imports[0]; imp.Path != "./utils.ryo" || imp.Alias != "u" {
+        t.Errorf("aliased import parsed as %+v", imp)
+    }
+    from := mod.Imports[1]
+    if from.Path != "./shapes.ryo" || len(from.Names) != 2 || from.Names[0].Name != "area" || from.Names[1].Name != "perimeter" {
+        t.Errorf("from-import parsed as %+v", from)
+    }
+    if imp := mod.Imports[2]; imp.Path != "os" || imp.Alias != "" || imp.Names != nil {
+        t.Errorf("plain import parsed as %+v", imp)
+    }
+}
+
+func TestPrettyPrintRoundTrip(t *testing.T) {
+    src := `import "strings" as s
+from "./lib.ryo" import f, g as h
+
+def main() {
+    var x = (1 + 2) - (3 - 4)
+    if x == 0 {
+        print(s.ToUpper("hi"), x[1].y)
+    } else {
+        y = foo(1)
+    }
+    assert x == 3, "x is " + s.Itoa(x)
+    assert ok(x)
+    return x
+}
+`
+    p := NewParser(src)
+    mod := p.ParseModule()
+    if len(p.Errors()) > 0 {
+        t.Fatalf("unexpected parse errors: %v", p.Errors())
+    }
+    out := PrettyPrint(mod)
+    if !strings.Contains(out, "var x = 1 + 2 - (3 - 4)\n") {
+        t.Errorf("parentheses not minimized:\n%s", out)
+    }
+    p2 := NewParser(out)
+    mod2 := p2.ParseModule()
+    if len(p2.Errors()) > 0 {
+        t.Fatalf("reparsing pretty-printed source: %v\n%s", p2.Errors(), out)
+    }
+    ast.ClearSpans(mod)
+    ast.ClearSpans(mod2)
+    if got, want := ast.Sexpr(mod2), ast.Sexpr(mod); got != want {
+        t.Errorf("pretty-printed source parses differently:\n%s\nwant:\n%s", got, want)
+    }
+    if again := PrettyPrint(mod2); again != out {
+        t.Errorf("pretty printing is not stable:\n%s\nvs\n%s", again, out)
+    }
+}
+
+func TestGoldenAST(t *testing.T) {
+    cases, err := testutil.LoadGoldenCases("../../testdata/golden")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, c := range cases {
+        want, ok := c.Expect["ast"]
+        if !ok {
+            continue
+        }
+        t.Run(c.Name, func(t *testing.T) {
+            got := ast.Sexpr(NewParser(c.Source).ParseModule())
+            if d := testutil.Diff(want, got); d != "" {
+                t.Errorf("AST dump mismatch:\n%s", d)
+            }
+        })
+    }
+}
+
+func TestParseErrorMessage(t *testing.T) {
+    p := NewParser("def (")
+    p.ParseModule()
+    if len(p.Errors()) == 0 {
+        t.Fatal("expected a syntax error")
+    }
+    pe := p.Errors()[0].(*ParseError)
+    if got, want := pe.Error(), `expected function name, found "("`; got != want {
+        t.Errorf("Error() = %q, want %q", got, want)
+    }
+    d := pe.Diagnostic()
+    if d.Code != CodeSyntax || d.Label != "expected identifier" {
+        t.Errorf("unexpected diagnostic %+v", d)
+    }
+    eof := &ParseError{Msg: "unexpected token", Expected: []string{"}"}}
+    if got, want := eof.Error(), "expected '}', found end of file"; got != want {
+        t.Errorf("Error() = %q, want %q", got, want)
+    }
+}
+
+func TestParser_Spans(t *testing.T) {
+    src := "from \"os\" import Args as argv\ndef main() {\n    var total = foo(1, \"a\") + x.y[2]\n    if total == 3 {\n        return total\n    }\n}\n"
+    p := NewParser(src)
+    mod := p.ParseModule()
+    if len(p.Errors()) > 0 {
+        t.Fatalf("unexpected parse errors: %v", p.Errors())
+    }
+    // Every node gets a span, and the span covers exactly its source text.
+    want := map[string]string{
+        "Module":       src,
+        "Import":       `from "os" import Args as argv`,
+        "ImportName":   "Args as argv",
+        "VarStmt":      `var total = foo(1, "a") + x.y[2]`,
+        "BinaryOp +":   `foo(1, "a") + x.y[2]`,
+        "Call":         `foo(1, "a")`,
+        "Literal 1":    "1",
+        "Literal a":    `"a"`,
+        "Index":        "x.y[2]",
+        "Attr":         "x.y",
+        "IfStmt":       "if total == 3 {\n        return total\n    }",
+        "BinaryOp ==":  "total == 3",
+        "ReturnStmt":   "return total",
+    }
+    got := map[string]string{}
+    var missing []string
+    ast.Walk(visitFunc(func(n ast.Node) {
+        span := n.Span()
+        if span.Start.Line == 0 {
+            missing = append(missing, fmt.Sprintf("%T", n))
+            return
+        }
+        key := strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+        switch x := n.(type) {
+        case *ast.BinaryOp:
+            key += " " + x.Op
+        case *ast.Literal:
+            key += fmt.Sprintf(" %v", x.Value)
+        }
+        text := src[span.Start.Offset:span.End.Offset]
+        got[key] = text
+        // Line and column agree with the offset.
+        line := strings.Count(src[:span.Start.Offset], "\n") + 1
+        col := span.Start.Offset - strings.LastIndex(src[:span.Start.Offset], "\n")
+        if span.Start.Line != line || span.Start.Col != col {
+            t.Errorf("%s starts at %d:%d, offset %d is %d:%d", key, span.Start.Line, span.Start.Col, span.Start.Offset, line, col)
+        }
+    }), mod)
+    if len(missing) > 0 {
+        t.Errorf("nodes without spans: %v", missing)
+    }
+    for key, text := range want {
+        if got[key] != text {
+            t.Errorf("%s spans %q, want %q", key, got[key], text)
+        }
+    }
+}
+
+func TestParseErrorSpan(t *testing.T) {
+    p := NewParser("def main() {\n}\ndef (")
+    p.ParseModule()
+    if len(p.Errors()) == 0 {
+        t.Fatal("expected a syntax error")
+    }
+    span := p.Errors()[0].(*ParseError).Span
+    if span.Start.Line != 3 || span.Start.Col != 5 || span.End.Col != 6 {
+        t.Errorf("error reported at %+v, want 3:5-3:6", span)
+    }
+}
+
+type visitFunc func(ast.Node)
+
+func (f visitFunc) Visit(n ast.Node) bool {
+    f(n)
+    return true
+}
+
+func TestParserRecovery(t *testing.T) {
+    src := `def main() {
+    var = 1
+    x = 1 + * 2
+    print(x)
+    while x { y = x }
+    return x y
+}
+def other() {
+    print(
+}
+var z = 2
+`
+    p := NewParser(src)
+    mod := p.ParseModule()
+    want := []string{
+        "2:9: expected variable name, found \"=\"",
+        "3:13: expected expression, found \"*\"",
+        "5:5: expected statement, found \"while\"",
+        "6:14: expected end of statement, found \"y\"",
+        "10:1: expected expression, found \"}\"",
+    }
+    var got []string
+    for _, err := range p.Errors() {
+        pe := err.(*ParseError)
+        got = append(got, fmt.Sprintf("%d:%d: %s", pe.Span.Start.Line, pe.Span.Start.Col, pe.Error()))
+    }
+    if strings.Join(got, "\n") != strings.Join(want, "\n") {
+        t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+    }
+
+    // Both functions and the statement after them survive, with bad nodes
+    // where the source could not be read.
+    if len(mod.Body) != 3 {
+        t.Fatalf("expected 3 top-level statements, got %d:\n%s", len(mod.Body), ast.Sexpr(mod))
+    }
+    main := mod.Body[0].(*ast.FuncDef)
+    if len(main.Body) != 5 {
+        t.Fatalf("expected 5 statements in main, got %d:\n%s", len(main.Body), ast.Sexpr(main))
+    }
+    if bad, ok := main.Body[0].(*ast.BadStmt); !ok || bad.Span().Start.Line != 2 {
+        t.Errorf("var without a name parsed as %s", ast.Sexpr(main.Body[0]))
+    }
+    if bad, ok := main.Body[3].(*ast.BadStmt); !ok || src[bad.Span().Start.Offset:bad.Span().End.Offset] != "while x { y = x }" {
+        t.Errorf("while statement parsed as %s", ast.Sexpr(main.Body[3]))
+    }
+    call := mod.Body[1].(*ast.FuncDef).Body[0].(*ast.ExprStmt).Expr.(*ast.Call)
+    if _, ok := call.Args[0].(*ast.BadExpr); !ok {
+        t.Errorf("missing argument parsed as %s", ast.Sexpr(call))
+    }
+    if v, ok := mod.Body[2].(*ast.VarStmt); !ok || v.Name != "z" {
+        t.Errorf("statement after the errors parsed as %s", ast.Sexpr(mod.Body[2]))
+    }
+}
+
+func TestParserErrorLimit(t *testing.T) {
+    src := strings.Repeat("x = )\n", 3*maxErrors)
+    p := NewParser(src)
+    mod := p.ParseModule()
+    errs := p.Errors()
+    if len(errs) != maxErrors+1 {
+        t.Fatalf("got %d errors, want %d", len(errs), maxErrors+1)
+    }
+    if msg := errs[maxErrors].Error(); msg != "too many errors" {
+        t.Errorf("last error is %q", msg)
+    }
+    if len(mod.Body) != 3*maxErrors {
+        t.Errorf("parsing stopped after %d statements", len(mod.Body))
+    }
+}
+
+func TestParserComments(t *testing.T) {
+    src := `# Package comment.
+
+import "os"  # for Args
+
+# main is the entry point.
+# It prints things.
+def main() {  # header
+    # leading
+    x = 1  # trailing
+    if x == 1 {
+        print(x)
+        # end of if
+    }
+    # end of main
+}
+# end of file
+`
+    p := NewParser(src)
+    mod := p.ParseModule()
+    if len(p.Errors()) > 0 {
+        t.Fatalf("unexpected parse errors: %v", p.Errors())
+    }
+
+    // The tokens give back the source exactly.
+    var sb strings.Builder
+    for _, tok := range p.Tokens() {
+        sb.WriteString(tok.Value)
+    }
+    if sb.String() != src {
+        t.Errorf("tokens do not round-trip:\n%s", sb.String())
+    }
+
+    var groups []string
+    for _, g := range mod.Comments {
+        groups = append(groups, g.Text())
+    }
+    want := []string{"Package comment.", "for Args", "main is the entry point.\nIt prints things.", "header", "leading", "trailing", "end of if", "end of main", "end of file"}
+    if strings.Join(groups, "|") != strings.Join(want, "|") {
+        t.Errorf("comment groups %q, want %q", groups, want)
+    }
+
+    main := mod.Body[0].(*ast.FuncDef)
+    if got := main.Doc.Text(); got != "main is the entry point.\nIt prints things." {
+        t.Errorf("doc comment %q", got)
+    }
+
+    ifStmt := main.Body[1].(*ast.IfStmt)
+    owners := map[string]ast.Node{
+        "Package comment.": mod.Imports[0],
+        "for Args":         mod.Imports[0],
+        "main is the entry point.\nIt prints things.": main,
+        "header":      main,
+        "leading":     main.Body[0],
+        "trailing":    main.Body[0],
+        "end of if":   ifStmt,
+        "end of main": main,
+        "end of file": mod,
+    }
+    cm := ast.NewCommentMap(mod)
+    n := 0
+    for node, gs := range cm {
+        for _, g := range gs {
+            n++
+            if owners[g.Text()] != node {
+                t.Errorf("comment %q attached to %s", g.Text(), ast.Sexpr(node))
+            }
+        }
+    }
+    if n != len(mod.Comments) {
+        t.Errorf("comment map has %d groups, want %d", n, len(mod.Comments))
+    }
+}
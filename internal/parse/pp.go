@@ -1,45 +1,280 @@
 package parse
 
 import (
-    "rayo/internal/ast"
     "fmt"
     "strings"
+
+    "rayo/internal/ast"
 )
 
-// PrettyPrint reconstructs source-like code from AST for debugging.
+// PrettyPrint renders an AST back to Rayo source. Blocks are indented with
+// four spaces and expressions are parenthesized only where precedence
+// requires it, so parsing the output yields the same tree (spans aside).
 func PrettyPrint(n ast.Node) string {
-    var sb strings.Builder
-    ppNode(&sb, n, 0)
-    return sb.String()
+    pp := &printer{}
+    pp.node(n)
+    return pp.sb.String()
 }
 
-func ppNode(sb *strings.Builder, n ast.Node, indent int) {
-    if n == nil {
-        return
+type printer struct {
+    sb     strings.Builder
+    indent int
+}
+
+func (pp *printer) line(format string, args ...any) {
+    pp.sb.WriteString(strings.Repeat("    ", pp.indent))
+    fmt.Fprintf(&pp.sb, format, args...)
+    pp.sb.WriteByte('\n')
+}
+
+// block prints `header {`, the statements, and the closing brace, which
+// starts the next line so that elif/else/except/finally can follow it.
+func (pp *printer) block(header string, body []ast.Stmt) {
+    pp.sb.WriteString(header)
+    pp.sb.WriteString(" {\n")
+    pp.indent++
+    for _, s := range body {
+        pp.node(s)
     }
-    pad := strings.Repeat("  ", indent)
+    pp.indent--
+    pp.sb.WriteString(strings.Repeat("    ", pp.indent))
+    pp.sb.WriteString("}")
+}
+
+func (pp *printer) startLine() {
+    pp.sb.WriteString(strings.Repeat("    ", pp.indent))
+}
+
+func (pp *printer) node(n ast.Node) {
     switch x := n.(type) {
+    case nil:
+        return
     case *ast.Module:
-        sb.WriteString(fmt.Sprintf("module %s {\n", x.Name))
         for _, imp := range x.Imports {
-            ppNode(sb, imp, indent+1)
+            pp.node(imp)
+        }
+        if len(x.Imports) > 0 && len(x.Body) > 0 {
+            pp.sb.WriteByte('\n')
         }
         for _, stmt := range x.Body {
-            ppNode(sb, stmt, indent+1)
+            pp.node(stmt)
         }
-        sb.WriteString("}\n")
     case *ast.Import:
-        sb.WriteString(pad + fmt.Sprintf("import '%s'\n", x.Path))
+        if len(x.Names) > 0 {
+            var names []string
+            for _, name := range x.Names {
+                names = append(names, importName(name))
+            }
+            pp.line("from %s import %s", quote(x.Path), strings.Join(names, ", "))
+        } else if x.Alias != "" {
+            pp.line("import %s as %s", quote(x.Path), x.Alias)
+        } else {
+            pp.line("import %s", quote(x.Path))
+        }
+    case *ast.ImportName:
+        pp.line("%s", importName(x))
+    case *ast.FuncDef:
+        pp.startLine()
+        pp.block(fmt.Sprintf("def %s(%s)", x.Name, params(x.Params)), x.Body)
+        pp.sb.WriteByte('\n')
+    case *ast.Param:
+        pp.line("%s", param(x))
     case *ast.VarStmt:
-        sb.WriteString(pad + fmt.Sprintf("var %s = ...\n", x.Name))
+        pp.line("var %s = %s", x.Name, Expr(x.Value))
+    case *ast.AssignStmt:
+        pp.line("%s = %s", Expr(x.Target), Expr(x.Value))
     case *ast.IfStmt:
-        sb.WriteString(pad + "if ... {\n")
-        for _, stmt := range x.Then {
-            ppNode(sb, stmt, indent+1)
+        pp.startLine()
+        pp.block("if "+Expr(x.Cond), x.Then)
+        for _, elif := range x.Elifs {
+            pp.block(" elif "+Expr(elif.Cond), elif.Body)
+        }
+        if len(x.Else) > 0 {
+            pp.block(" else", x.Else)
         }
-        sb.WriteString(pad + "}\n")
+        pp.sb.WriteByte('\n')
+    case *ast.Elif:
+        pp.startLine()
+        pp.block("elif "+Expr(x.Cond), x.Body)
+        pp.sb.WriteByte('\n')
+    case *ast.WhileStmt:
+        pp.startLine()
+        pp.block("while "+Expr(x.Cond), x.Body)
+        pp.sb.WriteByte('\n')
+    case *ast.ForStmt:
+        pp.startLine()
+        pp.block(fmt.Sprintf("for %s in %s", x.Var, Expr(x.Iter)), x.Body)
+        pp.sb.WriteByte('\n')
     case *ast.ReturnStmt:
-        sb.WriteString(pad + "return ...\n")
-    // ...extend for other node types...
+        if x.Value == nil {
+            pp.line("return")
+        } else {
+            pp.line("return %s", Expr(x.Value))
+        }
+    case *ast.AssertStmt:
+        if x.Msg == nil {
+            pp.line("assert %s", Expr(x.Test))
+        } else {
+            pp.line("assert %s, %s", Expr(x.Test), Expr(x.Msg))
+        }
+    case *ast.TryStmt:
+        pp.startLine()
+        pp.block("try", x.Body)
+        for _, exc := range x.Excepts {
+            pp.block(" "+exceptHeader(exc), exc.Body)
+        }
+        if len(x.Finally) > 0 {
+            pp.block(" finally", x.Finally)
+        }
+        pp.sb.WriteByte('\n')
+    case *ast.Except:
+        pp.startLine()
+        pp.block(exceptHeader(x), x.Body)
+        pp.sb.WriteByte('\n')
+    case *ast.ExprStmt:
+        pp.line("%s", Expr(x.Expr))
+    case *ast.BadStmt:
+        pp.line("<bad statement>")
+    case ast.Expr:
+        pp.line("%s", Expr(x))
+    }
+}
+
+func importName(n *ast.ImportName) string {
+    if n.Alias != "" {
+        return n.Name + " as " + n.Alias
+    }
+    return n.Name
+}
+
+func param(p *ast.Param) string {
+    if t := ast.TypeString(p.Type); t != "" {
+        return p.Name + ": " + t
+    }
+    return p.Name
+}
+
+func params(ps []*ast.Param) string {
+    var parts []string
+    for _, p := range ps {
+        parts = append(parts, param(p))
+    }
+    return strings.Join(parts, ", ")
+}
+
+func exceptHeader(e *ast.Except) string {
+    header := "except"
+    if t := ast.TypeString(e.Type); t != "" {
+        header += " " + t
+    }
+    if e.Var != "" {
+        header += " as " + e.Var
+    }
+    return header
+}
+
+// quote wraps a string as it appeared in source. The parser keeps string
+// contents unescaped, so they are written back verbatim.
+func quote(s string) string {
+    if strings.Contains(s, `"`) && !strings.Contains(s, "'") {
+        return "'" + s + "'"
+    }
+    return `"` + s + `"`
+}
+
+// Binding strength of binary operators; higher binds tighter.
+var precedence = map[string]int{
+    "or": 1, "||": 1,
+    "and": 2, "&&": 2,
+    "==": 3, "!=": 3,
+    "<": 4, "<=": 4, ">": 4, ">=": 4,
+    "+": 5, "-": 5,
+    "*": 6, "/": 6, "//": 6, "%": 6,
+    "**": 7,
+}
+
+const (
+    precUnary   = 8
+    precPostfix = 9
+)
+
+// Expr renders an expression as Rayo source.
+func Expr(e ast.Expr) string {
+    return expr(e, 0)
+}
+
+// expr renders e, parenthesized if it binds looser than prec.
+func expr(e ast.Expr, prec int) string {
+    s, p := exprPrec(e)
+    if p < prec {
+        return "(" + s + ")"
+    }
+    return s
+}
+
+func exprPrec(e ast.Expr) (string, int) {
+    switch x := e.(type) {
+    case nil:
+        return "<missing>", precPostfix
+    case *ast.Literal:
+        if s, ok := x.Value.(string); ok {
+            return quote(s), precPostfix
+        }
+        return ast.LiteralString(x.Value), precPostfix
+    case *ast.Name:
+        return x.Ident, precPostfix
+    case *ast.Call:
+        var args []string
+        for _, a := range x.Args {
+            args = append(args, expr(a, 0))
+        }
+        return expr(x.Func, precPostfix) + "(" + strings.Join(args, ", ") + ")", precPostfix
+    case *ast.Index:
+        return expr(x.Target, precPostfix) + "[" + expr(x.Index, 0) + "]", precPostfix
+    case *ast.Attr:
+        return expr(x.Target, precPostfix) + "." + x.Attr, precPostfix
+    case *ast.UnaryOp:
+        op := x.Op
+        if op == "not" {
+            op += " "
+        }
+        return op + expr(x.Right, precUnary), precUnary
+    case *ast.BinaryOp:
+        p, ok := precedence[x.Op]
+        if !ok {
+            p = 1
+        }
+        left, right := p, p+1
+        if x.Op == "**" {
+            // Right-associative
+            left, right = p+1, p
+        }
+        return expr(x.Left, left) + " " + x.Op + " " + expr(x.Right, right), p
+    case *ast.DictLit:
+        var entries []string
+        for i := range x.Keys {
+            var val ast.Expr
+            if i < len(x.Vals) {
+                val = x.Vals[i]
+            }
+            entries = append(entries, expr(x.Keys[i], 0)+": "+expr(val, 0))
+        }
+        return "{" + strings.Join(entries, ", ") + "}", precPostfix
+    case *ast.ListLit:
+        var elems []string
+        for _, el := range x.Elems {
+            elems = append(elems, expr(el, 0))
+        }
+        return "[" + strings.Join(elems, ", ") + "]", precPostfix
+    case *ast.Lambda:
+        head := "lambda"
+        if len(x.Params) > 0 {
+            head += " " + params(x.Params)
+        }
+        return head + ": " + expr(x.Body, 0), 0
+    case *ast.BadExpr:
+        return "<bad expression>", precPostfix
+    default:
+        return fmt.Sprintf("<%T>", e), precPostfix
     }
 }
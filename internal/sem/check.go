@@ -1,6 +1,8 @@
 package sem
 
 import (
+    "sort"
+
     "rayo/internal/ast"
     "rayo/internal/diag"
 )
@@ -10,98 +12,173 @@ type Scope struct {
     Parent *Scope
     Symbols map[string]Type
     Used    map[string]bool
+    Decls   map[string]diag.Span // where each symbol is declared
 }
 
 func NewScope(parent *Scope) *Scope {
-    return &Scope{Parent: parent, Symbols: map[string]Type{}, Used: map[string]bool{}}
+    return &Scope{Parent: parent, Symbols: map[string]Type{}, Used: map[string]bool{}, Decls: map[string]diag.Span{}}
+}
+
+func (s *Scope) declare(name string, span diag.Span) {
+    s.Symbols[name] = ast.Any{}
+    s.Used[name] = false
+    s.Decls[name] = span
+}
+
+// markUsed records a reference to name in the innermost scope declaring it.
+func (s *Scope) markUsed(name string) {
+    for sc := s; sc != nil; sc = sc.Parent {
+        if _, ok := sc.Symbols[name]; ok {
+            sc.Used[name] = true
+            return
+        }
+    }
 }
 
-// Reporter for diagnostics
-var reporter diag.Reporter
+// checker walks a module, reporting diagnostics to rep.
+type checker struct {
+    rep diag.Reporter
+    // Function bodies are checked after the enclosing scope, since they
+    // may refer to variables declared after the function.
+    funcs  []func()
+    scopes []*Scope // scopes to report unused variables of
+}
 
-// CheckModule performs semantic checks on a module.
+// CheckModule performs semantic checks on a module. Diagnostics carry
+// severities and codes when rep is a diag.DiagnosticReporter.
 func CheckModule(mod *ast.Module, rep diag.Reporter) {
-    reporter = rep
+    c := &checker{rep: rep}
     scope := NewScope(nil)
-    for _, stmt := range mod.Body {
-        checkStmt(stmt, scope)
+    c.scopes = append(c.scopes, scope)
+    c.stmts(mod.Body, scope)
+    for len(c.funcs) > 0 {
+        fn := c.funcs[0]
+        c.funcs = c.funcs[1:]
+        fn()
+    }
+    checkUnusedImports(mod, rep)
+    for _, sc := range c.scopes {
+        c.reportUnused(sc)
     }
-    // Warn for unused vars
+}
+
+// reportUnused warns about the variables of scope that are never read, in
+// declaration order.
+func (c *checker) reportUnused(scope *Scope) {
+    var names []string
     for name, used := range scope.Used {
         if !used {
-            reporter.Report(diag.Span{}, "unused variable: "+name)
+            names = append(names, name)
         }
     }
+    sort.Slice(names, func(i, j int) bool {
+        a, b := scope.Decls[names[i]].Start.Offset, scope.Decls[names[j]].Start.Offset
+        if a != b {
+            return a < b
+        }
+        return names[i] < names[j]
+    })
+    for _, name := range names {
+        report(c.rep, diag.Warning, CodeUnusedVar, scope.Decls[name], "unused variable: "+name)
+    }
+}
+
+func (c *checker) stmts(stmts []ast.Stmt, scope *Scope) {
+    for _, stmt := range stmts {
+        c.stmt(stmt, scope)
+    }
 }
 
-func checkStmt(stmt ast.Stmt, scope *Scope) {
+func (c *checker) stmt(stmt ast.Stmt, scope *Scope) {
     switch s := stmt.(type) {
-    case *ast.VarStmt:
-        typ := ast.Any{}
-        if s.Value != nil {
-            typ = ast.Any{} // Could use InferType(s.Value)
+    case *ast.FuncDef:
+        scope.Symbols[s.Name] = ast.Any{}
+        fn := NewScope(scope)
+        for _, p := range s.Params {
+            fn.Symbols[p.Name] = ast.Any{}
         }
-        scope.Symbols[s.Name] = typ
-        scope.Used[s.Name] = false
+        c.scopes = append(c.scopes, fn)
+        c.funcs = append(c.funcs, func() { c.stmts(s.Body, fn) })
+    case *ast.VarStmt:
+        c.use(s.Value, scope)
+        scope.declare(s.Name, s.Span())
     case *ast.AssignStmt:
-        // Mark as used
-        if name, ok := s.Target.(*ast.Name); ok {
-            scope.Used[name.Ident] = true
-        }
+        c.use(s.Value, scope)
+        // Assigning to a variable counts as using it; assigning to an
+        // element or attribute reads the container.
+        c.use(s.Target, scope)
     case *ast.IfStmt:
-        for _, stmt := range s.Then {
-            checkStmt(stmt, scope)
-        }
+        c.use(s.Cond, scope)
+        c.stmts(s.Then, scope)
         for _, elif := range s.Elifs {
-            for _, stmt := range elif.Body {
-                checkStmt(stmt, scope)
-            }
-        }
-        for _, stmt := range s.Else {
-            checkStmt(stmt, scope)
+            c.use(elif.Cond, scope)
+            c.stmts(elif.Body, scope)
         }
+        c.stmts(s.Else, scope)
     case *ast.WhileStmt:
-        for _, stmt := range s.Body {
-            checkStmt(stmt, scope)
-        }
+        c.use(s.Cond, scope)
+        c.stmts(s.Body, scope)
     case *ast.ForStmt:
-        scope.Symbols[s.Var] = ast.Any{}
-        scope.Used[s.Var] = false
-        for _, stmt := range s.Body {
-            checkStmt(stmt, scope)
-        }
+        c.use(s.Iter, scope)
+        scope.declare(s.Var, s.Span())
+        c.stmts(s.Body, scope)
     case *ast.ReturnStmt:
         // Could check return type
+        c.use(s.Value, scope)
+    case *ast.AssertStmt:
+        c.use(s.Test, scope)
+        c.use(s.Msg, scope)
+        c.checkExprNullSafety(s.Test)
     case *ast.TryStmt:
-        for _, stmt := range s.Body {
-            checkStmt(stmt, scope)
-        }
+        c.stmts(s.Body, scope)
         for _, exc := range s.Excepts {
-            for _, stmt := range exc.Body {
-                checkStmt(stmt, scope)
-            }
-        }
-        for _, stmt := range s.Finally {
-            checkStmt(stmt, scope)
+            c.stmts(exc.Body, scope)
         }
+        c.stmts(s.Finally, scope)
     case *ast.ExprStmt:
-        checkExprNullSafety(s.Expr, scope)
+        c.use(s.Expr, scope)
+        c.checkExprNullSafety(s.Expr)
     }
+}
 
+// use marks every variable referenced in expr as used.
+func (c *checker) use(expr ast.Expr, scope *Scope) {
+    if expr == nil {
+        return
+    }
+    refs := &nameCollector{names: map[string]bool{}}
+    ast.Walk(refs, expr)
+    for name := range refs.names {
+        scope.markUsed(name)
+    }
 }
 
 // checkExprNullSafety checks for unsafe dereference and safe navigation.
-func checkExprNullSafety(expr ast.Expr, scope *Scope) {
+func (c *checker) checkExprNullSafety(expr ast.Expr) {
     switch e := expr.(type) {
     case *ast.Attr:
         typ := InferType(e.Target)
         if _, ok := typ.(*OptionalType); ok {
-            reporter.Report(diag.Span{}, "unsafe dereference of optional value")
+            diag.Emit(c.rep, diag.Diagnostic{
+                Severity: diag.Error,
+                Code:     CodeOptionalAttr,
+                Span:     e.Span(),
+                Msg:      "unsafe dereference of optional value",
+                Label:    "value may be None",
+                Fixes:    []diag.Fix{{Msg: "use ?. to yield None instead, or check for None first"}},
+            })
         }
     case *ast.Index:
         typ := InferType(e.Target)
         if _, ok := typ.(*OptionalType); ok {
-            reporter.Report(diag.Span{}, "unsafe index of optional value")
+            diag.Emit(c.rep, diag.Diagnostic{
+                Severity: diag.Error,
+                Code:     CodeOptionalIndex,
+                Span:     e.Span(),
+                Msg:      "unsafe index of optional value",
+                Label:    "value may be None",
+                Fixes:    []diag.Fix{{Msg: "use ?[ to yield None instead, or check for None first"}},
+            })
         }
     }
 }
@@ -1,9 +1,11 @@
 package sem
 
 import (
+    "strings"
     "testing"
     "rayo/internal/ast"
     "rayo/internal/diag"
+    "rayo/internal/parse"
 )
 
 type testReporter struct {
@@ -69,3 +71,64 @@ func TestIndexNullSafetyDiagnostics(t *testing.T) {
         t.Errorf("expected index null safety diagnostic")
     }
 }
+
+func TestCheckDiagnosticCodes(t *testing.T) {
+    src := `var unused = 1
+var later = 2
+def f() {
+    var local = 3
+    return later
+}
+`
+    p := parse.NewParser(src)
+    mod := p.ParseModule()
+    if len(p.Errors()) > 0 {
+        t.Fatalf("parse errors: %v", p.Errors())
+    }
+    mod.Body = append(mod.Body, &ast.ExprStmt{Expr: &ast.Attr{Target: &ast.Literal{Value: nil}, Attr: "x"}})
+    list := &diag.List{File: "t.ryo"}
+    CheckModule(mod, list)
+    var got []string
+    for _, d := range list.Diagnostics {
+        got = append(got, d.Severity.String()+" "+d.Code+" "+d.Msg)
+    }
+    want := []string{
+        "error E0201 unsafe dereference of optional value",
+        "warning W0001 unused variable: unused",
+        "warning W0001 unused variable: local",
+    }
+    if strings.Join(got, "\n") != strings.Join(want, "\n") {
+        t.Errorf("diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+    }
+    if list.Count(diag.Error) != 1 || list.Count(diag.Warning) != 2 {
+        t.Errorf("counts: %d errors, %d warnings", list.Count(diag.Error), list.Count(diag.Warning))
+    }
+}
+
+func TestInferTypeIn(t *testing.T) {
+    env := map[string]Type{"n": &BasicType{Name: "int"}, "s": &OptionalType{Elem: &BasicType{Name: "str"}}}
+    tests := map[string]string{
+        `1 + 2`:          "int",
+        `n + 1`:          "int",
+        `"a" + "b"`:      "str",
+        `[1] + [2]`:      "list",
+        `n < 2`:          "bool",
+        `str(n)`:         "str",
+        `len("abc") - n`: "int",
+        `s`:              "str?",
+        `None`:           "any?",
+        `m`:              "any",
+        `f(n)`:           "any",
+    }
+    for src, want := range tests {
+        p := parse.NewParser(src)
+        mod := p.ParseModule()
+        if len(p.Errors()) > 0 || len(mod.Body) != 1 {
+            t.Fatalf("%s: parse errors: %v", src, p.Errors())
+        }
+        got := TypeString(InferTypeIn(mod.Body[0].(*ast.ExprStmt).Expr, env))
+        if got != want {
+            t.Errorf("%s: got %s, want %s", src, got, want)
+        }
+    }
+}
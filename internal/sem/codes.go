@@ -0,0 +1,23 @@
+package sem
+
+import (
+    "rayo/internal/diag"
+)
+
+// Diagnostic codes reported by the checker. docs/diagnostics.md describes
+// each of them.
+const (
+    CodeImportFailed    = "E0101" // Go package cannot be loaded
+    CodeNotExported     = "E0102" // from-import of a name the package does not export
+    CodeUndefinedMember = "E0103" // pkg.Name that the package does not export
+    CodeNotCallable     = "E0104" // call of a Go variable or constant
+    CodeArgCount        = "E0105" // wrong number of arguments to a Go function
+    CodeOptionalAttr    = "E0201" // attribute access on an optional value
+    CodeOptionalIndex   = "E0202" // index of an optional value
+    CodeUnusedVar       = "W0001"
+    CodeUnusedImport    = "W0002"
+)
+
+func report(rep diag.Reporter, sev diag.Severity, code string, span diag.Span, msg string) {
+    diag.Emit(rep, diag.Diagnostic{Severity: sev, Code: code, Span: span, Msg: msg})
+}
@@ -0,0 +1,208 @@
+package sem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SymbolKind classifies an exported Go package member.
+type SymbolKind int
+
+const (
+	SymFunc SymbolKind = iota
+	SymVar
+	SymConst
+	SymType
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case SymFunc:
+		return "func"
+	case SymVar:
+		return "var"
+	case SymConst:
+		return "const"
+	case SymType:
+		return "type"
+	default:
+		return "symbol"
+	}
+}
+
+// GoSymbol is an exported member of an imported Go package.
+type GoSymbol struct {
+	Name string
+	Kind SymbolKind
+	Obj  types.Object
+}
+
+// Signature returns the function signature of a func symbol, or nil.
+func (s *GoSymbol) Signature() *types.Signature {
+	if s.Kind == SymType {
+		return nil
+	}
+	sig, _ := s.Obj.Type().Underlying().(*types.Signature)
+	return sig
+}
+
+// Callable reports whether the symbol can be called like a function.
+func (s *GoSymbol) Callable() bool {
+	return s.Kind == SymType || s.Signature() != nil
+}
+
+// Fields returns the fields of a struct type symbol, or nil.
+func (s *GoSymbol) Fields() []*types.Var {
+	if s.Kind != SymType {
+		return nil
+	}
+	st, ok := s.Obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	fields := make([]*types.Var, st.NumFields())
+	for i := range fields {
+		fields[i] = st.Field(i)
+	}
+	return fields
+}
+
+// GoPackage is a type-checked Go package imported by a Rayo module.
+type GoPackage struct {
+	Path  string
+	Name  string
+	Types *types.Package
+}
+
+// Lookup returns the exported symbol name, or nil if the package has none.
+func (p *GoPackage) Lookup(name string) *GoSymbol {
+	obj := p.Types.Scope().Lookup(name)
+	if obj == nil || !obj.Exported() {
+		return nil
+	}
+	sym := &GoSymbol{Name: name, Obj: obj}
+	switch obj.(type) {
+	case *types.Func:
+		sym.Kind = SymFunc
+	case *types.Var:
+		sym.Kind = SymVar
+	case *types.Const:
+		sym.Kind = SymConst
+	case *types.TypeName:
+		sym.Kind = SymType
+	}
+	return sym
+}
+
+// Members returns the names of the package's exported members, sorted.
+func (p *GoPackage) Members() []string {
+	var names []string
+	for _, name := range p.Types.Scope().Names() {
+		if token.IsExported(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GoImporter loads Go packages from compiler export data produced by
+// `go list -export`, so imports resolve exactly as the Go toolchain will
+// resolve them when building the generated code.
+type GoImporter struct {
+	Dir     string // directory whose module context resolves import paths
+	fset    *token.FileSet
+	exports map[string]string
+	errs    map[string]string
+	types   types.Importer
+	pkgs    map[string]*GoPackage
+}
+
+func NewGoImporter(dir string) *GoImporter {
+	gi := &GoImporter{
+		Dir:     dir,
+		fset:    token.NewFileSet(),
+		exports: map[string]string{},
+		errs:    map[string]string{},
+		pkgs:    map[string]*GoPackage{},
+	}
+	gi.types = importer.ForCompiler(gi.fset, "gc", gi.lookup)
+	return gi
+}
+
+// Import loads the Go package with the given import path.
+func (gi *GoImporter) Import(path string) (*GoPackage, error) {
+	if pkg, ok := gi.pkgs[path]; ok {
+		return pkg, nil
+	}
+	if _, ok := gi.exports[path]; !ok {
+		if err := gi.list(path); err != nil {
+			return nil, err
+		}
+	}
+	if msg, ok := gi.errs[path]; ok {
+		return nil, fmt.Errorf("cannot import %q: %s", path, msg)
+	}
+	tpkg, err := gi.types.Import(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %q: %w", path, err)
+	}
+	pkg := &GoPackage{Path: path, Name: tpkg.Name(), Types: tpkg}
+	gi.pkgs[path] = pkg
+	return pkg, nil
+}
+
+type listedPackage struct {
+	ImportPath string
+	Export     string
+	Error      *struct{ Err string }
+}
+
+// list runs `go list -export` for path and records export data locations for
+// the package and all of its dependencies.
+func (gi *GoImporter) list(path string) error {
+	cmd := exec.Command("go", "list", "-e", "-export", "-deps", "-json=ImportPath,Export,Error", "--", path)
+	cmd.Dir = gi.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("go list %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var lp listedPackage
+		if err := dec.Decode(&lp); err != nil {
+			return fmt.Errorf("go list %s: %w", path, err)
+		}
+		if lp.Error != nil {
+			gi.errs[lp.ImportPath] = lp.Error.Err
+		}
+		gi.exports[lp.ImportPath] = lp.Export
+	}
+	if _, ok := gi.exports[path]; !ok {
+		gi.errs[path] = "package not found"
+	}
+	return nil
+}
+
+func (gi *GoImporter) lookup(path string) (io.ReadCloser, error) {
+	file := gi.exports[path]
+	if file == "" {
+		if err := gi.list(path); err != nil {
+			return nil, err
+		}
+		file = gi.exports[path]
+	}
+	if file == "" {
+		return nil, fmt.Errorf("no export data for %q", path)
+	}
+	return os.Open(file)
+}
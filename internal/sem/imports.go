@@ -0,0 +1,317 @@
+package sem
+
+import (
+	"fmt"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+)
+
+// IsRayoImport reports whether an import path names a Rayo source module
+// rather than a Go package.
+func IsRayoImport(path string) bool {
+	return strings.HasSuffix(path, ".ryo")
+}
+
+// ImportName returns the name an import without an alias is referenced by:
+// the file name of a Rayo module, or the name a Go package is assumed to
+// declare, following the goimports conventions (gopkg.in/yaml.v3 -> yaml,
+// github.com/mattn/go-sqlite3 -> sqlite3, example.com/foo/v2 -> foo).
+func ImportName(importPath string) string {
+	if IsRayoImport(importPath) {
+		return identifier(strings.TrimSuffix(path.Base(importPath), ".ryo"))
+	}
+	base := path.Base(importPath)
+	if len(base) > 1 && base[0] == 'v' && strings.Trim(base[1:], "0123456789") == "" {
+		base = path.Base(path.Dir(importPath))
+	}
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	base = strings.TrimPrefix(base, "go-")
+	return identifier(base)
+}
+
+func identifier(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			sb.WriteRune(r)
+		}
+	}
+	name := sb.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "m" + name
+	}
+	return name
+}
+
+// GoRef is a Go package member bound to a local name with from-import.
+type GoRef struct {
+	Package string // key of the package in GoImports.Packages
+	Symbol  *GoSymbol
+}
+
+// GoImports is the Go package namespace of a module.
+type GoImports struct {
+	// Packages maps each name a Go package is referenced by in generated
+	// code to the package. Packages imported only through from-import are
+	// given a hidden name.
+	Packages map[string]*GoPackage
+	// Names maps names bound with from-import to the members they refer to.
+	Names map[string]GoRef
+}
+
+// Aliases returns the keys of Packages in sorted order.
+func (gi *GoImports) Aliases() []string {
+	aliases := make([]string, 0, len(gi.Packages))
+	for alias := range gi.Packages {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// ResolveImports loads the Go packages imported by mod and reports selectors
+// on them that do not name an exported member, names imported with
+// from-import that the package does not export, and calls whose argument
+// count does not match the Go signature.
+func ResolveImports(mod *ast.Module, gi *GoImporter, rep diag.Reporter) *GoImports {
+	imports := &GoImports{Packages: map[string]*GoPackage{}, Names: map[string]GoRef{}}
+	var fromImports []*ast.Import
+	for _, imp := range mod.Imports {
+		if IsRayoImport(imp.Path) {
+			continue
+		}
+		pkg, err := gi.Import(imp.Path)
+		if err != nil {
+			report(rep, diag.Error, CodeImportFailed, imp.Span(), err.Error())
+			continue
+		}
+		if len(imp.Names) > 0 {
+			fromImports = append(fromImports, imp)
+			continue
+		}
+		alias := imp.Alias
+		if alias == "" {
+			alias = pkg.Name
+		}
+		imports.Packages[alias] = pkg
+	}
+	for _, imp := range fromImports {
+		pkg, _ := gi.Import(imp.Path)
+		// Reuse the first name the package is already imported as
+		alias := ""
+		for _, key := range imports.Aliases() {
+			if imports.Packages[key] == pkg {
+				alias = key
+				break
+			}
+		}
+		if alias == "" {
+			alias = pkg.Name
+			for i := 2; imports.Packages[alias] != nil; i++ {
+				alias = fmt.Sprintf("%s%d", pkg.Name, i)
+			}
+			imports.Packages[alias] = pkg
+		}
+		for _, name := range imp.Names {
+			sym := pkg.Lookup(name.Name)
+			if sym == nil {
+				report(rep, diag.Error, CodeNotExported, name.Span(), fmt.Sprintf("cannot import %s: package %s has no exported member %s", name.Name, imp.Path, name.Name))
+				continue
+			}
+			imports.Names[name.Local()] = GoRef{Package: alias, Symbol: sym}
+		}
+	}
+	if len(imports.Packages) > 0 {
+		ast.Walk(&selectorChecker{imports: imports, rep: rep}, mod)
+	}
+	return imports
+}
+
+// PackageSymbol returns the Go symbol referenced by expr when expr has the
+// form pkg.Name for an imported package, or is a name bound by from-import.
+func PackageSymbol(expr ast.Expr, imports *GoImports) (*GoPackage, *GoSymbol) {
+	if imports == nil {
+		return nil, nil
+	}
+	if name, ok := expr.(*ast.Name); ok {
+		if ref, ok := imports.Names[name.Ident]; ok {
+			return imports.Packages[ref.Package], ref.Symbol
+		}
+		return nil, nil
+	}
+	attr, ok := expr.(*ast.Attr)
+	if !ok {
+		return nil, nil
+	}
+	name, ok := attr.Target.(*ast.Name)
+	if !ok {
+		return nil, nil
+	}
+	pkg := imports.Packages[name.Ident]
+	if pkg == nil {
+		return nil, nil
+	}
+	return pkg, pkg.Lookup(attr.Attr)
+}
+
+type selectorChecker struct {
+	imports *GoImports
+	rep     diag.Reporter
+}
+
+func (c *selectorChecker) Visit(n ast.Node) bool {
+	switch x := n.(type) {
+	case *ast.Attr:
+		pkg, sym := PackageSymbol(x, c.imports)
+		if pkg != nil && sym == nil {
+			d := diag.Diagnostic{
+				Severity: diag.Error,
+				Code:     CodeUndefinedMember,
+				Span:     x.Span(),
+				Msg:      fmt.Sprintf("undefined: %s.%s", pkg.Name, x.Attr),
+				Label:    "not exported by package " + pkg.Name,
+			}
+			if match := closest(x.Attr, pkg.Members()); match != "" {
+				alias := x.Target.(*ast.Name).Ident
+				d.Fixes = []diag.Fix{{
+					Msg:         fmt.Sprintf("did you mean %s.%s?", alias, match),
+					Span:        x.Span(),
+					Replacement: alias + "." + match,
+				}}
+			}
+			diag.Emit(c.rep, d)
+		}
+	case *ast.Call:
+		pkg, sym := PackageSymbol(x.Func, c.imports)
+		if pkg == nil || sym == nil {
+			return true
+		}
+		qual := pkg.Name + "." + sym.Name
+		if !sym.Callable() {
+			if len(x.Args) > 0 {
+				diag.Emit(c.rep, diag.Diagnostic{
+					Severity: diag.Error,
+					Code:     CodeNotCallable,
+					Span:     x.Span(),
+					Msg:      fmt.Sprintf("cannot call %s: %s is a %s, not a function", qual, qual, sym.Kind),
+					Label:    "not a function",
+					Fixes:    []diag.Fix{{Msg: fmt.Sprintf("refer to the %s without parentheses: %s", sym.Kind, qual)}},
+				})
+			}
+			return true
+		}
+		if sym.Kind == SymType {
+			if len(x.Args) != 1 {
+				report(c.rep, diag.Error, CodeArgCount, x.Span(), fmt.Sprintf("conversion to %s takes exactly 1 argument, got %d", qual, len(x.Args)))
+			}
+			return true
+		}
+		sig := sym.Signature()
+		want := sig.Params().Len()
+		msg := ""
+		switch {
+		case sig.Variadic() && len(x.Args) < want-1:
+			msg = fmt.Sprintf("not enough arguments in call to %s: have %d, want at least %d", qual, len(x.Args), want-1)
+		case !sig.Variadic() && len(x.Args) != want:
+			msg = fmt.Sprintf("wrong argument count in call to %s: have %d, want %d", qual, len(x.Args), want)
+		}
+		if msg != "" {
+			diag.Emit(c.rep, diag.Diagnostic{
+				Severity: diag.Error,
+				Code:     CodeArgCount,
+				Span:     x.Span(),
+				Msg:      msg,
+				Notes:    []string{fmt.Sprintf("%s is declared as func%s", qual, strings.TrimPrefix(types.TypeString(sig, types.RelativeTo(pkg.Types)), "func"))},
+			})
+		}
+	}
+	return true
+}
+
+// checkUnusedImports reports imports whose bound names are never referenced
+// in the module body.
+func checkUnusedImports(mod *ast.Module, rep diag.Reporter) {
+	refs := &nameCollector{names: map[string]bool{}}
+	for _, stmt := range mod.Body {
+		ast.Walk(refs, stmt)
+	}
+	for _, imp := range mod.Imports {
+		if len(imp.Names) == 0 {
+			local := imp.Alias
+			if local == "" {
+				local = ImportName(imp.Path)
+			}
+			if !refs.names[local] {
+				diag.Emit(rep, diag.Diagnostic{
+					Severity: diag.Warning,
+					Code:     CodeUnusedImport,
+					Span:     imp.Span(),
+					Msg:      fmt.Sprintf("unused import: %q imported as %s and not used", imp.Path, local),
+					Fixes:    []diag.Fix{{Msg: "remove the import", Span: imp.Span()}},
+				})
+			}
+			continue
+		}
+		for _, name := range imp.Names {
+			if !refs.names[name.Local()] {
+				report(rep, diag.Warning, CodeUnusedImport, name.Span(), fmt.Sprintf("unused import: %s from %q", name.Local(), imp.Path))
+			}
+		}
+	}
+}
+
+// closest returns the candidate most similar to name, or "" if none is
+// close enough to be a likely typo: same spelling in another case, or an
+// edit distance of at most a third of the name's length.
+func closest(name string, candidates []string) string {
+	best, bestDist := "", len(name)/3+1
+	for _, c := range candidates {
+		if strings.EqualFold(c, name) {
+			return c
+		}
+		if d := editDistance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+type nameCollector struct {
+	names map[string]bool
+}
+
+func (c *nameCollector) Visit(n ast.Node) bool {
+	if name, ok := n.(*ast.Name); ok {
+		c.names[name.Ident] = true
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package sem
+
+import (
+	"strings"
+	"testing"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+)
+
+func call(pkg, name string, args ...ast.Expr) ast.Stmt {
+	fn := &ast.Attr{Target: &ast.Name{Ident: pkg}, Attr: name}
+	return &ast.ExprStmt{Expr: &ast.Call{Func: fn, Args: args}}
+}
+
+func TestResolveImports(t *testing.T) {
+	mod := &ast.Module{
+		Imports: []*ast.Import{{Path: "os"}, {Path: "strings"}, {Path: "./util.ryo"}},
+		Body: []ast.Stmt{
+			call("strings", "ToUpper", &ast.Literal{Value: "a"}),
+			call("os", "Args"),
+			call("os", "NoSuchThing"),
+			call("strings", "ToUpper"),
+			call("os", "Args", &ast.Literal{Value: 1}),
+		},
+	}
+	rep := &testReporter{}
+	pkgs := ResolveImports(mod, NewGoImporter("."), rep).Packages
+	if len(pkgs) != 2 || pkgs["os"] == nil || pkgs["strings"] == nil {
+		t.Fatalf("expected os and strings to resolve, got %v", pkgs)
+	}
+	if sym := pkgs["os"].Lookup("Args"); sym == nil || sym.Kind != SymVar || sym.Callable() {
+		t.Errorf("os.Args should resolve to a non-callable var, got %+v", sym)
+	}
+	if sym := pkgs["strings"].Lookup("Builder"); sym == nil || sym.Kind != SymType {
+		t.Errorf("strings.Builder should resolve to a type, got %+v", sym)
+	}
+	want := []string{
+		"undefined: os.NoSuchThing",
+		"wrong argument count in call to strings.ToUpper: have 0, want 1",
+		"cannot call os.Args: os.Args is a var, not a function",
+	}
+	if len(rep.errors) != len(want) {
+		t.Fatalf("got diagnostics %q, want %q", rep.errors, want)
+	}
+	for i := range want {
+		if rep.errors[i] != want[i] {
+			t.Errorf("diagnostic %d: got %q, want %q", i, rep.errors[i], want[i])
+		}
+	}
+}
+
+func TestResolveImportsUnknownPackage(t *testing.T) {
+	mod := &ast.Module{Imports: []*ast.Import{{Path: "rayo/no/such/pkg"}}}
+	rep := &testReporter{}
+	ResolveImports(mod, NewGoImporter("."), rep)
+	if len(rep.errors) != 1 {
+		t.Fatalf("expected one diagnostic for a missing package, got %q", rep.errors)
+	}
+}
+
+func TestResolveFromImports(t *testing.T) {
+	mod := &ast.Module{
+		Imports: []*ast.Import{
+			{Path: "strings", Alias: "str"},
+			{Path: "strings", Names: []*ast.ImportName{{Name: "ToUpper"}, {Name: "ToLower", Alias: "lower"}}},
+			{Path: "os", Names: []*ast.ImportName{{Name: "Args"}, {Name: "Missing"}}},
+		},
+		Body: []ast.Stmt{
+			&ast.ExprStmt{Expr: &ast.Call{Func: &ast.Name{Ident: "lower"}, Args: []ast.Expr{&ast.Literal{Value: "A"}}}},
+			&ast.ExprStmt{Expr: &ast.Call{Func: &ast.Name{Ident: "Args"}, Args: []ast.Expr{&ast.Literal{Value: 1}}}},
+		},
+	}
+	rep := &testReporter{}
+	imports := ResolveImports(mod, NewGoImporter("."), rep)
+	if got := imports.Aliases(); len(got) != 2 || got[0] != "os" || got[1] != "str" {
+		t.Errorf("package aliases = %v, want [os str]", got)
+	}
+	if ref := imports.Names["lower"]; ref.Package != "str" || ref.Symbol.Name != "ToLower" {
+		t.Errorf("lower bound to %+v", ref)
+	}
+	if ref := imports.Names["ToUpper"]; ref.Package != "str" || ref.Symbol.Name != "ToUpper" {
+		t.Errorf("ToUpper bound to %+v", ref)
+	}
+	want := []string{
+		"cannot import Missing: package os has no exported member Missing",
+		"cannot call os.Args: os.Args is a var, not a function",
+	}
+	if len(rep.errors) != len(want) {
+		t.Fatalf("got diagnostics %q, want %q", rep.errors, want)
+	}
+	for i := range want {
+		if rep.errors[i] != want[i] {
+			t.Errorf("diagnostic %d: got %q, want %q", i, rep.errors[i], want[i])
+		}
+	}
+}
+
+func TestResolveFromImportsAlias(t *testing.T) {
+	mod := &ast.Module{
+		Imports: []*ast.Import{
+			{Path: "strings", Alias: "str"},
+			{Path: "strings", Alias: "s"},
+			{Path: "strings", Names: []*ast.ImportName{{Name: "ToUpper"}}},
+		},
+	}
+	// The package has two names; the from-import always uses the first
+	for i := 0; i < 20; i++ {
+		imports := ResolveImports(mod, NewGoImporter("."), &testReporter{})
+		if ref := imports.Names["ToUpper"]; ref.Package != "s" {
+			t.Fatalf("ToUpper bound to package %q, want s", ref.Package)
+		}
+	}
+}
+
+func TestImportName(t *testing.T) {
+	cases := map[string]string{
+		"os":                          "os",
+		"rayo/stdlib/http":            "http",
+		"gopkg.in/yaml.v3":            "yaml",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+		"example.com/foo/v2":          "foo",
+		"./lib/my-utils.ryo":          "myutils",
+	}
+	for path, want := range cases {
+		if got := ImportName(path); got != want {
+			t.Errorf("ImportName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestUnusedImportWarning(t *testing.T) {
+	mod := &ast.Module{
+		Imports: []*ast.Import{
+			{Path: "os"},
+			{Path: "strings", Alias: "str"},
+			{Path: "./shapes.ryo", Names: []*ast.ImportName{{Name: "area"}, {Name: "perimeter", Alias: "per"}}},
+		},
+		Body: []ast.Stmt{
+			&ast.ExprStmt{Expr: &ast.Call{Func: &ast.Attr{Target: &ast.Name{Ident: "str"}, Attr: "ToUpper"}}},
+			&ast.ExprStmt{Expr: &ast.Call{Func: &ast.Name{Ident: "area"}}},
+		},
+	}
+	rep := &testReporter{}
+	CheckModule(mod, rep)
+	want := map[string]bool{
+		`unused import: "os" imported as os and not used`: true,
+		`unused import: per from "./shapes.ryo"`:          true,
+	}
+	for _, msg := range rep.errors {
+		delete(want, msg)
+	}
+	for msg := range want {
+		t.Errorf("missing diagnostic %q in %q", msg, rep.errors)
+	}
+}
+
+func TestUndefinedMemberSuggestion(t *testing.T) {
+	mod := &ast.Module{
+		Imports: []*ast.Import{{Path: "strings"}},
+		Body: []ast.Stmt{
+			call("strings", "ToUpperr", &ast.Literal{Value: "a"}),
+			call("strings", "toupper", &ast.Literal{Value: "a"}),
+			call("strings", "Zzzzzz"),
+			call("strings", "Repeat", &ast.Literal{Value: "a"}),
+		},
+	}
+	list := &diag.List{}
+	ResolveImports(mod, NewGoImporter("."), list)
+	var fixes []string
+	for _, d := range list.Diagnostics {
+		if d.Code != CodeUndefinedMember {
+			continue
+		}
+		if len(d.Fixes) == 0 {
+			fixes = append(fixes, "")
+			continue
+		}
+		fixes = append(fixes, d.Fixes[0].Replacement)
+	}
+	want := []string{"strings.ToUpper", "strings.ToUpper", ""}
+	if strings.Join(fixes, ",") != strings.Join(want, ",") {
+		t.Errorf("got suggestions %q, want %q", fixes, want)
+	}
+	last := list.Diagnostics[len(list.Diagnostics)-1]
+	if last.Code != CodeArgCount || len(last.Notes) != 1 || last.Notes[0] != "strings.Repeat is declared as func(s string, count int) string" {
+		t.Errorf("argument count diagnostic: %+v", last)
+	}
+}
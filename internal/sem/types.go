@@ -16,13 +16,38 @@ type OptionalType struct {
 
 type AnyType struct{}
 
+// TypeString renders t as :type in the REPL shows it, e.g. "str?".
+func TypeString(t Type) string {
+    switch t := t.(type) {
+    case *BasicType:
+        return t.Name
+    case *OptionalType:
+        return TypeString(t.Elem) + "?"
+    default:
+        return "any"
+    }
+}
+
 // InferType infers the type of an AST expression.
 func InferType(expr ast.Expr) Type {
+    return InferTypeIn(expr, nil)
+}
+
+// conversions maps builtins to the type of their result.
+var conversions = map[string]string{
+    "str": "str", "repr": "str", "int": "int", "len": "int", "float": "float", "bool": "bool",
+}
+
+// InferTypeIn infers the type of an AST expression in which the names in
+// env have the given types; other names have type any.
+func InferTypeIn(expr ast.Expr, env map[string]Type) Type {
     switch e := expr.(type) {
     case *ast.Literal:
         switch e.Value.(type) {
         case int:
             return &BasicType{Name: "int"}
+        case float64:
+            return &BasicType{Name: "float"}
         case string:
             return &BasicType{Name: "str"}
         case bool:
@@ -33,19 +58,66 @@ func InferType(expr ast.Expr) Type {
             return &AnyType{}
         }
     case *ast.Name:
+        if t, ok := env[e.Ident]; ok {
+            return t
+        }
         // Example: lookup in symbol table for null safety
         // (symbol table logic would go here)
         return &AnyType{}
+    case *ast.ListLit:
+        return &BasicType{Name: "list"}
+    case *ast.DictLit:
+        return &BasicType{Name: "dict"}
+    case *ast.Lambda:
+        return &BasicType{Name: "function"}
+    case *ast.UnaryOp:
+        if e.Op == "not" || e.Op == "!" {
+            return &BasicType{Name: "bool"}
+        }
+        return InferTypeIn(e.Right, env)
+    case *ast.BinaryOp:
+        switch e.Op {
+        case "<", ">", "<=", ">=", "==", "!=":
+            return &BasicType{Name: "bool"}
+        case "+", "-", "*":
+            l, lok := InferTypeIn(e.Left, env).(*BasicType)
+            r, rok := InferTypeIn(e.Right, env).(*BasicType)
+            if !lok || !rok {
+                break
+            }
+            numeric := map[string]bool{"int": true, "float": true}
+            sequence := map[string]bool{"str": true, "list": true}
+            switch {
+            case numeric[l.Name] && numeric[r.Name] && l.Name == r.Name:
+                return l
+            case numeric[l.Name] && numeric[r.Name]:
+                return &BasicType{Name: "float"}
+            case e.Op == "+" && sequence[l.Name] && l.Name == r.Name:
+                return l
+            case e.Op == "*" && sequence[l.Name] && r.Name == "int":
+                return l
+            case e.Op == "*" && sequence[r.Name] && l.Name == "int":
+                return r
+            }
+        }
+        return &AnyType{}
+    case *ast.Call:
+        if name, ok := e.Func.(*ast.Name); ok {
+            if _, shadowed := env[name.Ident]; !shadowed && conversions[name.Ident] != "" {
+                return &BasicType{Name: conversions[name.Ident]}
+            }
+        }
+        return &AnyType{}
     case *ast.Attr:
         // Disambiguate obj.attr vs obj["attr"]
         // If Target is known struct, return field type; else dynamic
-        if bt, ok := InferType(e.Target).(*BasicType); ok && bt.Name == "struct" {
+        if bt, ok := InferTypeIn(e.Target, env).(*BasicType); ok && bt.Name == "struct" {
             return &AnyType{} // Would be field type in real impl
         }
         return &AnyType{}
     case *ast.Index:
         // If Target is dict, return value type; else dynamic
-        if bt, ok := InferType(e.Target).(*BasicType); ok && bt.Name == "dict" {
+        if bt, ok := InferTypeIn(e.Target, env).(*BasicType); ok && bt.Name == "dict" {
             return &AnyType{} // Would be value type in real impl
         }
         return &AnyType{}
@@ -0,0 +1,196 @@
+// Package testrun runs the test functions of Rayo programs. The tests of
+// a program are compiled into a Go test binary with the testing package,
+// and its results are reported in the style of go test under their Rayo
+// names, with failures at Rayo source positions.
+package testrun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"rayo/internal/build"
+	"rayo/internal/gen"
+)
+
+// Options configures a test run.
+type Options struct {
+	// Run selects the tests whose names match; all tests run when nil.
+	Run *regexp.Regexp
+	// Verbose prints every test with its output, not only failing ones.
+	Verbose bool
+	// Mod holds the go.mod settings of the generated module.
+	Mod build.GoModule
+	// CacheDir is where test binaries are built and kept; see
+	// build.Program.CachedBinary.
+	CacheDir string
+}
+
+// Result counts the outcome of a test run.
+type Result struct {
+	Passed, Failed, Skipped int
+	// OK is false when a test failed or the test binary itself did, e.g.
+	// by crashing outside of a test.
+	OK bool
+}
+
+// Run runs the test functions of the entry module of prog, named name in
+// the output, writing the results to w. Tests run in the directory of the
+// entry module. The error reports failures to build or start the tests;
+// failing tests are counted in the result.
+func Run(w io.Writer, prog *build.Program, name string, opts Options) (Result, error) {
+	tests := gen.TestFuncs(prog.Entry.AST)
+	var selected []string
+	for _, test := range tests {
+		if opts.Run == nil || opts.Run.MatchString(test.Name) {
+			selected = append(selected, gen.TestName(test.Name))
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Fprintf(w, "ok  \t%s\t[no tests to run]\n", name)
+		return Result{OK: true}, nil
+	}
+
+	// Every test is compiled in, so that the binary does not depend on
+	// the selection.
+	extra := map[string]string{"rayo_test.go": gen.EmitTestFile(prog.Entry.Package, tests, prog.Root)}
+	binary, err := prog.CachedBinary(opts.CacheDir, opts.Mod, extra, func(dir, binary string) error {
+		cmd := exec.Command("go", "test", "-c", "-o", binary, ".")
+		cmd.Dir = dir
+		var stderr bytes.Buffer
+		cmd.Stdout = &stderr
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if berr := prog.GoBuildError(dir, stderr.String()); berr != nil {
+				return berr
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	cmd := exec.Command("go", "tool", "test2json", "-t", binary, "-test.v=test2json", "-test.run", "^("+strings.Join(selected, "|")+")$")
+	cmd.Dir = prog.Root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return Result{}, err
+	}
+	r := &reporter{w: w, name: name, verbose: opts.Verbose, output: map[string][]string{}}
+	dec := json.NewDecoder(bufio.NewReader(out))
+	for {
+		var ev event
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			cmd.Wait()
+			return Result{}, fmt.Errorf("reading test results: %v", err)
+		}
+		r.event(ev)
+	}
+	// test2json exits with the status of the tests; the events tell.
+	if err := cmd.Wait(); err != nil && !r.done {
+		return Result{}, fmt.Errorf("running tests: %v\n%s", err, stderr.Bytes())
+	}
+	return r.result, nil
+}
+
+// event is a test2json event.
+type event struct {
+	Action  string
+	Test    string
+	Output  string
+	Elapsed float64
+}
+
+// reporter prints the events of a test run.
+type reporter struct {
+	w       io.Writer
+	name    string
+	verbose bool
+	// output holds the output of each running test, printed when it
+	// fails unless verbose.
+	output map[string][]string
+	result Result
+	done   bool
+}
+
+// goLogPrefix matches the file:line prefix testing puts on log lines;
+// the harness reports Rayo positions itself.
+var goLogPrefix = regexp.MustCompile(`^(\s*)\w+_test\.go:\d+: `)
+
+func (r *reporter) event(ev event) {
+	name := strings.TrimPrefix(ev.Test, "Test_")
+	switch ev.Action {
+	case "run":
+		if r.verbose {
+			fmt.Fprintf(r.w, "=== RUN   %s\n", name)
+		}
+	case "output":
+		if isFrame(ev.Output) {
+			return
+		}
+		line := goLogPrefix.ReplaceAllString(ev.Output, "$1")
+		switch {
+		case ev.Test == "":
+			fmt.Fprint(r.w, line)
+		case r.verbose:
+			fmt.Fprint(r.w, line)
+		default:
+			r.output[ev.Test] = append(r.output[ev.Test], line)
+		}
+	case "pass", "fail", "skip":
+		if ev.Test == "" {
+			r.done = true
+			r.result.OK = ev.Action != "fail" && r.result.Failed == 0
+			status := "ok  "
+			if !r.result.OK {
+				status = "FAIL"
+			}
+			fmt.Fprintf(r.w, "%s\t%s\t%.3fs\n", status, r.name, ev.Elapsed)
+			return
+		}
+		switch ev.Action {
+		case "pass":
+			r.result.Passed++
+		case "fail":
+			r.result.Failed++
+		case "skip":
+			r.result.Skipped++
+		}
+		if r.verbose || ev.Action == "fail" {
+			fmt.Fprintf(r.w, "--- %s: %s (%.2fs)\n", strings.ToUpper(ev.Action), name, ev.Elapsed)
+			for _, line := range r.output[ev.Test] {
+				fmt.Fprint(r.w, line)
+			}
+		}
+		delete(r.output, ev.Test)
+	}
+}
+
+// isFrame reports whether a line of test output is framing that the
+// reporter prints itself, such as "=== RUN" or the final "PASS".
+func isFrame(line string) bool {
+	for _, prefix := range []string{"=== ", "--- PASS", "--- FAIL", "--- SKIP"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	switch strings.TrimSpace(line) {
+	case "PASS", "FAIL":
+		return true
+	}
+	return false
+}
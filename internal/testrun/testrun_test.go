@@ -0,0 +1,93 @@
+package testrun
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"rayo/internal/build"
+)
+
+func TestReporter(t *testing.T) {
+	events := []event{
+		{Action: "run", Test: "Test_test_a"},
+		{Action: "output", Test: "Test_test_a", Output: "=== RUN   Test_test_a\n"},
+		{Action: "output", Test: "Test_test_a", Output: "printed\n"},
+		{Action: "output", Test: "Test_test_a", Output: "--- PASS: Test_test_a (0.00s)\n"},
+		{Action: "pass", Test: "Test_test_a"},
+		{Action: "run", Test: "Test_test_b"},
+		{Action: "output", Test: "Test_test_b", Output: "    rayo_test.go:12: m_test.ryo:3: boom\n"},
+		{Action: "output", Test: "Test_test_b", Output: "--- FAIL: Test_test_b (0.01s)\n"},
+		{Action: "fail", Test: "Test_test_b", Elapsed: 0.01},
+		{Action: "output", Output: "FAIL\n"},
+		{Action: "fail", Elapsed: 0.25},
+	}
+	for _, tc := range []struct {
+		verbose bool
+		want    string
+	}{
+		{false, "--- FAIL: test_b (0.01s)\n    m_test.ryo:3: boom\nFAIL\tm_test.ryo\t0.250s\n"},
+		{true, "=== RUN   test_a\nprinted\n--- PASS: test_a (0.00s)\n=== RUN   test_b\n    m_test.ryo:3: boom\n--- FAIL: test_b (0.01s)\nFAIL\tm_test.ryo\t0.250s\n"},
+	} {
+		var buf bytes.Buffer
+		r := &reporter{w: &buf, name: "m_test.ryo", verbose: tc.verbose, output: map[string][]string{}}
+		for _, ev := range events {
+			r.event(ev)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("verbose=%v: got:\n%s\nwant:\n%s", tc.verbose, buf.String(), tc.want)
+		}
+		if want := (Result{Passed: 1, Failed: 1}); r.result != want {
+			t.Errorf("verbose=%v: result %+v, want %+v", tc.verbose, r.result, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	dir := t.TempDir()
+	src := "def test_pass() {\n    print(\"hello\")\n    assert 1 < 2\n}\n\ndef test_fail() {\n    x = 3\n    assert x == 4\n}\n"
+	file := filepath.Join(dir, "m_test.ryo")
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prog, err := build.Load(file, build.Options{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	opts := Options{CacheDir: filepath.Join(dir, "cache")}
+
+	var out bytes.Buffer
+	res, err := Run(&out, prog, "m_test.ryo", opts)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Passed != 1 || res.Failed != 1 || res.OK {
+		t.Errorf("result %+v\n%s", res, out.String())
+	}
+	if !strings.Contains(out.String(), "--- FAIL: test_fail") || !strings.Contains(out.String(), "    m_test.ryo:8: AssertionError: assert x == 4: 3 != 4, where 3 = x\n") {
+		t.Errorf("failure not reported at its Rayo line:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "hello") {
+		t.Errorf("output of a passing test shown:\n%s", out.String())
+	}
+
+	out.Reset()
+	opts.Run = regexp.MustCompile("pass")
+	opts.Verbose = true
+	if res, err = Run(&out, prog, "m_test.ryo", opts); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Passed != 1 || res.Failed != 0 || !res.OK {
+		t.Errorf("result %+v\n%s", res, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "=== RUN   test_pass\nhello\n--- PASS: test_pass") {
+		t.Errorf("verbose output:\n%s", out.String())
+	}
+}
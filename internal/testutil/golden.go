@@ -1,21 +1,38 @@
 package testutil
 
 import (
-	"bytes"
-	"fmt"
+	"flag"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"testing"
+
+	"rayo/internal/diff"
 )
 
+// Update makes CheckGolden rewrite golden files with the actual output
+// instead of comparing, when tests run with -update.
+var Update = flag.Bool("update", false, "rewrite golden files with the actual output")
+
+// GoldenKinds are the kinds of expected output a golden case can have, by
+// file extension: the program's output, its token dump, syntax tree and
+// generated Go code.
+var GoldenKinds = []string{"out", "tokens", "ast", "go"}
+
 // GoldenCase represents a single golden test case.
 type GoldenCase struct {
 	Name   string
+	Dir    string
 	Source string
 	Expect map[string]string // e.g. {"out": "...", "tokens": "..."}
 }
 
+// Path returns the path of the case's golden file of the given kind.
+func (c GoldenCase) Path(kind string) string {
+	return filepath.Join(c.Dir, c.Name+"."+kind)
+}
+
 // LoadGoldenCases loads all .ryo files and their expected outputs from a directory.
 func LoadGoldenCases(dir string) ([]GoldenCase, error) {
 	var cases []GoldenCase
@@ -33,15 +50,16 @@ func LoadGoldenCases(dir string) ([]GoldenCase, error) {
 			}
 			expect := make(map[string]string)
 			// Look for .out, .tokens, .ast, .go files
-			for _, ext := range []string{".out", ".tokens", ".ast", ".go"} {
-				outPath := filepath.Join(dir, base+ext)
+			for _, kind := range GoldenKinds {
+				outPath := filepath.Join(dir, base+"."+kind)
 				if _, err := os.Stat(outPath); err == nil {
 					outBytes, _ := ioutil.ReadFile(outPath)
-					expect[ext[1:]] = string(outBytes)
+					expect[kind] = string(outBytes)
 				}
 			}
 			cases = append(cases, GoldenCase{
 				Name:   base,
+				Dir:    dir,
 				Source: string(srcBytes),
 				Expect: expect,
 			})
@@ -50,26 +68,31 @@ func LoadGoldenCases(dir string) ([]GoldenCase, error) {
 	return cases, nil
 }
 
-// Diff outputs for golden test, returns empty string if equal.
+// Diff outputs for golden test, returns empty string if equal. The
+// difference is a unified diff from expected to actual.
 func Diff(expected, actual string) string {
-	if expected == actual {
-		return ""
-	}
-	// Simple line-by-line diff
-	expLines := strings.Split(expected, "\n")
-	actLines := strings.Split(actual, "\n")
-	var buf bytes.Buffer
-	for i := 0; i < len(expLines) || i < len(actLines); i++ {
-		var exp, act string
-		if i < len(expLines) {
-			exp = expLines[i]
-		}
-		if i < len(actLines) {
-			act = actLines[i]
-		}
-		if exp != act {
-			fmt.Fprintf(&buf, "- %s\n+ %s\n", exp, act)
+	return diff.Unified("want", "got", expected, actual)
+}
+
+// CheckGolden compares got with the golden file of kind for c, failing t
+// with a unified diff if they differ. With -update the golden file is
+// written instead, and created if the case had none.
+func CheckGolden(t testing.TB, c GoldenCase, kind, got string) {
+	t.Helper()
+	if *Update {
+		if want, ok := c.Expect[kind]; !ok || want != got {
+			if err := os.WriteFile(c.Path(kind), []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+			t.Logf("updated %s", c.Path(kind))
 		}
+		return
+	}
+	want, ok := c.Expect[kind]
+	if !ok {
+		return
+	}
+	if d := Diff(want, got); d != "" {
+		t.Errorf("%s differs from %s (rerun with -update to accept):\n%s", kind, c.Path(kind), d)
 	}
-	return buf.String()
 }
@@ -1,14 +1,97 @@
 package testutil
 
-import "testing"
+import (
+    "bytes"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
 
+    "rayo/internal/ast"
+    "rayo/internal/build"
+    "rayo/internal/lex"
+    "rayo/internal/parse"
+)
+
+const goldenDir = "../../testdata/golden"
+
+// TestGolden runs every golden case through the pipeline. The tokens and
+// syntax tree are checked for every case; the generated Go code and the
+// output of running it only for sources that parse cleanly. Run with
+// -update to rewrite the golden files from the actual results.
 func TestGolden(t *testing.T) {
-    cases, err := LoadGoldenCases("../../testdata/golden")
+    cases, err := LoadGoldenCases(goldenDir)
     if err != nil {
         t.Fatalf("failed to load golden cases: %v", err)
     }
     if len(cases) == 0 {
         t.Errorf("no golden cases found")
     }
-    // Add more checks as needed
-}
\ No newline at end of file
+    for _, c := range cases {
+        c := c
+        t.Run(c.Name, func(t *testing.T) {
+            CheckGolden(t, c, "tokens", lex.FormatTokens(lex.Tokenize(c.Source, true)))
+            p := parse.NewParser(c.Source)
+            mod := p.ParseModule()
+            CheckGolden(t, c, "ast", ast.Sexpr(mod))
+            if errs := p.Errors(); len(errs) > 0 {
+                for _, kind := range []string{"go", "out"} {
+                    if _, ok := c.Expect[kind]; ok {
+                        t.Errorf("has a .%s file, but the source does not parse: %v", kind, errs[0])
+                    }
+                }
+                return
+            }
+
+            prog, err := build.Load(c.Path("ryo"), build.Options{RayoPath: []string{}})
+            if err != nil {
+                t.Fatalf("Load: %v", err)
+            }
+            dir := t.TempDir()
+            if err := prog.Emit(dir, build.GoModule{}); err != nil {
+                t.Fatalf("Emit: %v", err)
+            }
+            code, err := os.ReadFile(filepath.Join(dir, prog.Entry.GoFile()))
+            if err != nil {
+                t.Fatal(err)
+            }
+            // The //line directives name the source by its absolute path.
+            CheckGolden(t, c, "go", strings.ReplaceAll(string(code), prog.Root+string(filepath.Separator), ""))
+
+            if testing.Short() {
+                t.Skip("not running the program in short mode")
+            }
+            if _, err := exec.LookPath("go"); err != nil {
+                t.Skip("go toolchain not found")
+            }
+            binary := filepath.Join(dir, "prog")
+            cmd := exec.Command("go", "build", "-o", binary, ".")
+            cmd.Dir = dir
+            if out, err := cmd.CombinedOutput(); err != nil {
+                t.Fatalf("go build: %v\n%s", err, out)
+            }
+            var stdout, stderr bytes.Buffer
+            cmd = exec.Command(binary)
+            cmd.Dir = c.Dir
+            cmd.Stdout = &stdout
+            cmd.Stderr = &stderr
+            if err := cmd.Run(); err != nil {
+                t.Fatalf("running the program: %v\n%s", err, stderr.Bytes())
+            }
+            CheckGolden(t, c, "out", stdout.String())
+        })
+    }
+}
+
+func TestDiff(t *testing.T) {
+    if d := Diff("a\nb\n", "a\nb\n"); d != "" {
+        t.Errorf("Diff of equal texts = %q, want \"\"", d)
+    }
+    d := Diff("a\nb\nc\n", "a\nx\nc\n")
+    for _, line := range []string{"--- want", "+++ got", "-b", "+x", " a"} {
+        if !strings.Contains(d, line+"\n") {
+            t.Errorf("Diff is missing %q:\n%s", line, d)
+        }
+    }
+}
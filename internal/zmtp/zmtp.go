@@ -0,0 +1,380 @@
+// Package zmtp implements the part of ZMTP 3.0, the ZeroMQ message
+// transport protocol, that a Jupyter kernel needs: sockets bound to TCP
+// addresses that exchange multipart messages with ZeroMQ peers, using the
+// NULL security mechanism.
+//
+// Routing is left to the caller: a message is received together with the
+// connection it came from, and a reply is sent on that connection, which
+// is what ROUTER and REP sockets do for peers that are not themselves
+// routers. A PUB socket sends to every subscriber, ignoring the topics
+// they subscribed to.
+package zmtp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Message is a multipart message, one byte slice per frame.
+type Message [][]byte
+
+// Frame flags.
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// maxFrame bounds the size of received frames.
+const maxFrame = 1 << 30
+
+// greeting returns the ZMTP 3.0 greeting announcing the NULL mechanism.
+func greeting() []byte {
+	g := make([]byte, 64)
+	g[0], g[9] = 0xff, 0x7f
+	g[10], g[11] = 3, 0
+	copy(g[12:32], "NULL")
+	return g
+}
+
+// Conn is a connection to a ZeroMQ peer, after the handshake.
+type Conn struct {
+	c  net.Conn
+	r  *bufio.Reader
+	mu sync.Mutex // serializes Send
+	// PeerType is the socket type the peer announced, e.g. "DEALER".
+	PeerType string
+}
+
+// handshake exchanges greetings and READY commands with the peer of c.
+// The peer's READY is read before sending ours, so that by the time a
+// connecting peer completes its handshake, the listener has registered
+// the connection; register is called in between.
+func handshake(c net.Conn, socketType string, register func(*Conn)) (*Conn, error) {
+	conn := &Conn{c: c, r: bufio.NewReader(c)}
+	if _, err := c.Write(greeting()); err != nil {
+		return nil, err
+	}
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(conn.r, peer); err != nil {
+		return nil, fmt.Errorf("zmtp: reading greeting: %w", err)
+	}
+	if peer[0] != 0xff || peer[9] != 0x7f || peer[10] < 3 {
+		return nil, errors.New("zmtp: peer does not speak ZMTP 3")
+	}
+	if mech := string(bytes.TrimRight(peer[12:32], "\x00")); mech != "NULL" {
+		return nil, fmt.Errorf("zmtp: unsupported security mechanism %s", mech)
+	}
+	if err := conn.readReady(); err != nil {
+		return nil, err
+	}
+	if register != nil {
+		register(conn)
+	}
+	if err := conn.writeFrame(ready(socketType), flagCommand); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialHandshake is the handshake of the connecting side, which sends its
+// READY first.
+func dialHandshake(c net.Conn, socketType string) (*Conn, error) {
+	conn := &Conn{c: c, r: bufio.NewReader(c)}
+	if _, err := c.Write(greeting()); err != nil {
+		return nil, err
+	}
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(conn.r, peer); err != nil {
+		return nil, fmt.Errorf("zmtp: reading greeting: %w", err)
+	}
+	if err := conn.writeFrame(ready(socketType), flagCommand); err != nil {
+		return nil, err
+	}
+	if err := conn.readReady(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ready returns the body of a READY command for a socket of type typ.
+func ready(typ string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(5)
+	b.WriteString("READY")
+	for _, prop := range [][2]string{{"Socket-Type", typ}, {"Identity", ""}} {
+		b.WriteByte(byte(len(prop[0])))
+		b.WriteString(prop[0])
+		binary.Write(&b, binary.BigEndian, uint32(len(prop[1])))
+		b.WriteString(prop[1])
+	}
+	return b.Bytes()
+}
+
+// readReady reads the peer's READY command and records its socket type.
+func (c *Conn) readReady() error {
+	body, flags, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	if flags&flagCommand == 0 || len(body) < 1 {
+		return errors.New("zmtp: expected READY command")
+	}
+	n := 1 + int(body[0])
+	if len(body) < n {
+		return errors.New("zmtp: expected READY command")
+	}
+	name, props := string(body[1:n]), body[n:]
+	if name == "ERROR" {
+		return fmt.Errorf("zmtp: peer refused connection: %s", props)
+	}
+	if name != "READY" {
+		return fmt.Errorf("zmtp: expected READY command, got %s", name)
+	}
+	for len(props) > 0 {
+		n := int(props[0])
+		if len(props) < 1+n+4 {
+			return errors.New("zmtp: malformed READY command")
+		}
+		key := string(props[1 : 1+n])
+		size := int(binary.BigEndian.Uint32(props[1+n:]))
+		props = props[1+n+4:]
+		if len(props) < size {
+			return errors.New("zmtp: malformed READY command")
+		}
+		if key == "Socket-Type" {
+			c.PeerType = string(props[:size])
+		}
+		props = props[size:]
+	}
+	return nil
+}
+
+func (c *Conn) readFrame() ([]byte, byte, error) {
+	flags, err := c.r.ReadByte()
+	if err != nil {
+		return nil, 0, err
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		var b [8]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return nil, 0, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	} else {
+		n, err := c.r.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		size = uint64(n)
+	}
+	if size > maxFrame {
+		return nil, 0, fmt.Errorf("zmtp: frame of %d bytes is too large", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, 0, err
+	}
+	return body, flags, nil
+}
+
+func (c *Conn) writeFrame(body []byte, flags byte) error {
+	var head []byte
+	if len(body) > 255 {
+		head = binary.BigEndian.AppendUint64([]byte{flags | flagLong}, uint64(len(body)))
+	} else {
+		head = []byte{flags, byte(len(body))}
+	}
+	if _, err := c.c.Write(head); err != nil {
+		return err
+	}
+	_, err := c.c.Write(body)
+	return err
+}
+
+// Recv reads the next message, skipping commands such as PING.
+func (c *Conn) Recv() (Message, error) {
+	var msg Message
+	for {
+		body, flags, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			continue
+		}
+		msg = append(msg, body)
+		if flags&flagMore == 0 {
+			return msg, nil
+		}
+	}
+}
+
+// Send writes msg as one multipart message.
+func (c *Conn) Send(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, frame := range msg {
+		var flags byte
+		if i < len(msg)-1 {
+			flags = flagMore
+		}
+		if err := c.writeFrame(frame, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
+
+// Dial connects to a ZeroMQ socket at the TCP address addr as a socket of
+// type socketType, e.g. "DEALER".
+func Dial(addr, socketType string) (*Conn, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialHandshake(c, socketType)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Received is a message and the connection it came from.
+type Received struct {
+	Conn *Conn
+	Msg  Message
+}
+
+// Socket is a socket bound to a TCP address, accepting any number of
+// peers.
+type Socket struct {
+	Type string // e.g. "ROUTER"
+	ln   net.Listener
+	recv chan Received
+	done chan struct{}
+
+	mu    sync.Mutex
+	conns map[*Conn]bool
+}
+
+// Listen binds a socket of type socketType to the TCP address addr; a port
+// of 0 picks a free port. Messages from its peers are delivered by Recv.
+func Listen(addr, socketType string) (*Socket, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{Type: socketType, ln: ln, recv: make(chan Received), done: make(chan struct{}), conns: map[*Conn]bool{}}
+	go s.accept()
+	return s, nil
+}
+
+// Port returns the TCP port the socket is bound to.
+func (s *Socket) Port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *Socket) accept() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(c)
+	}
+}
+
+// serve reads the messages of one peer until it disconnects.
+func (s *Socket) serve(c net.Conn) {
+	defer c.Close()
+	conn, err := handshake(c, s.Type, func(conn *Conn) {
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+	})
+	if err != nil {
+		return
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+	for {
+		msg, err := conn.Recv()
+		if err != nil {
+			return
+		}
+		if s.Type == "PUB" {
+			// Subscriptions: every peer gets every message
+			continue
+		}
+		select {
+		case s.recv <- Received{Conn: conn, Msg: msg}:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Recv returns the next message from any peer. It fails once the socket
+// is closed.
+func (s *Socket) Recv() (Received, error) {
+	select {
+	case <-s.done:
+		return Received{}, net.ErrClosed
+	default:
+	}
+	select {
+	case r := <-s.recv:
+		return r, nil
+	case <-s.done:
+		return Received{}, net.ErrClosed
+	}
+}
+
+// Broadcast sends msg to every peer, as a PUB socket does. Peers that
+// cannot be written to are dropped.
+func (s *Socket) Broadcast(msg Message) {
+	s.mu.Lock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+	for _, conn := range conns {
+		if err := conn.Send(msg); err != nil {
+			conn.Close()
+		}
+	}
+}
+
+// Close stops accepting peers and disconnects the connected ones.
+func (s *Socket) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	return err
+}
@@ -0,0 +1,132 @@
+package zmtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T, typ string) *Socket {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0", typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Socket, typ string) *Conn {
+	t.Helper()
+	c, err := Dial(fmt.Sprintf("127.0.0.1:%d", s.Port()), typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRequestReply(t *testing.T) {
+	s := listen(t, "ROUTER")
+	c := dial(t, s, "DEALER")
+	if c.PeerType != "ROUTER" {
+		t.Errorf("peer type = %q, want ROUTER", c.PeerType)
+	}
+	long := bytes.Repeat([]byte("x"), 1000)
+	if err := c.Send(Message{[]byte("hello"), {}, long}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Conn.PeerType != "DEALER" {
+		t.Errorf("peer type = %q, want DEALER", r.Conn.PeerType)
+	}
+	if len(r.Msg) != 3 || string(r.Msg[0]) != "hello" || len(r.Msg[1]) != 0 || !bytes.Equal(r.Msg[2], long) {
+		t.Fatalf("received %q", r.Msg)
+	}
+	if err := r.Conn.Send(Message{[]byte("world")}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := c.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply) != 1 || string(reply[0]) != "world" {
+		t.Errorf("reply = %q", reply)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	s := listen(t, "PUB")
+	subs := []*Conn{dial(t, s, "SUB"), dial(t, s, "SUB")}
+	// A ZMTP 3.0 subscription to every topic, which PUB ignores
+	subs[0].Send(Message{{1}})
+	s.Broadcast(Message{[]byte("topic"), []byte("news")})
+	for _, sub := range subs {
+		msg, err := sub.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msg) != 2 || string(msg[1]) != "news" {
+			t.Errorf("received %q", msg)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	s := listen(t, "REP")
+	c := dial(t, s, "REQ")
+	// Undelivered: nothing receives before the socket closes
+	c.Send(Message{{}, []byte("ping")})
+	s.Close()
+	if _, err := s.Recv(); err == nil {
+		t.Error("Recv succeeded on a closed socket")
+	}
+	if _, err := c.Recv(); err == nil {
+		t.Error("peer still connected after Close")
+	}
+}
+
+func TestMalformedReady(t *testing.T) {
+	s := listen(t, "ROUTER")
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", s.Port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write(greeting()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(c, make([]byte, 64)); err != nil {
+		t.Fatal(err)
+	}
+	// A command whose name is 255 bytes long
+	body := append([]byte{255}, bytes.Repeat([]byte("x"), 300)...)
+	head := binary.BigEndian.AppendUint64([]byte{flagCommand | flagLong}, uint64(len(body)))
+	if _, err := c.Write(append(head, body...)); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("after a malformed READY, read %d bytes, %v; want the connection closed", n, err)
+	}
+
+	// and the socket still serves other peers
+	d := dial(t, s, "DEALER")
+	if err := d.Send(Message{[]byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Msg) != 1 || string(r.Msg[0]) != "hello" {
+		t.Errorf("received %q", r.Msg)
+	}
+}
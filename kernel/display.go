@@ -0,0 +1,160 @@
+package kernel
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"rayo/internal/interp"
+)
+
+// maxRows is the number of rows a table shows; the rest are counted.
+const maxRows = 50
+
+// display returns the representations of v that frontends choose from,
+// keyed by MIME type. A non-empty list of dicts is shown as a table with
+// a column per key, as well as in plain text.
+func display(v any) map[string]string {
+	rows, ok := tableRows(v)
+	if !ok {
+		return map[string]string{"text/plain": interp.Repr(v)}
+	}
+	cols := columns(rows)
+	return map[string]string{
+		"text/plain": textTable(rows, cols),
+		"text/html":  htmlTable(rows, cols),
+	}
+}
+
+// tableRows returns the elements of v if it is a non-empty list of dicts.
+func tableRows(v any) ([]map[string]any, bool) {
+	list, ok := v.(*interp.List)
+	if !ok || len(list.Elems) == 0 {
+		return nil, false
+	}
+	rows := make([]map[string]any, len(list.Elems))
+	for i, elem := range list.Elems {
+		if rows[i], ok = elem.(map[string]any); !ok {
+			return nil, false
+		}
+	}
+	return rows, true
+}
+
+// columns returns the keys of rows, sorted as dicts print their keys.
+func columns(rows []map[string]any) []string {
+	seen := map[string]bool{}
+	var cols []string
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				cols = append(cols, key)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// cell renders the value of column col in row. Strings are shown without
+// quotes, and missing values are left blank.
+func cell(row map[string]any, col string) string {
+	v, ok := row[col]
+	if !ok {
+		return ""
+	}
+	return interp.Str(v)
+}
+
+// more describes the rows a table leaves out.
+func more(rows []map[string]any) string {
+	return fmt.Sprintf("... %d more rows (%d in total)", len(rows)-maxRows, len(rows))
+}
+
+// textTable lays rows out in columns, columns of numbers aligned right.
+func textTable(rows []map[string]any, cols []string) string {
+	shown := rows
+	if len(shown) > maxRows {
+		shown = shown[:maxRows]
+	}
+	widths := make([]int, len(cols))
+	right := make([]bool, len(cols))
+	for i, col := range cols {
+		widths[i] = utf8.RuneCountInString(col)
+		right[i] = true
+		for _, row := range shown {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell(row, col)))
+			if v, ok := row[col]; ok && !isNumber(v) {
+				right[i] = false
+			}
+		}
+	}
+	var b strings.Builder
+	line := func(cells []string) {
+		var l strings.Builder
+		for i, c := range cells {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c))
+			if i > 0 {
+				l.WriteString("  ")
+			}
+			if right[i] {
+				l.WriteString(pad + c)
+			} else {
+				l.WriteString(c + pad)
+			}
+		}
+		b.WriteString(strings.TrimRight(l.String(), " ") + "\n")
+	}
+	line(cols)
+	cells := make([]string, len(cols))
+	for i := range cols {
+		cells[i] = strings.Repeat("-", widths[i])
+	}
+	line(cells)
+	for _, row := range shown {
+		for i, col := range cols {
+			cells[i] = cell(row, col)
+		}
+		line(cells)
+	}
+	if len(rows) > maxRows {
+		b.WriteString(more(rows) + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int, float64:
+		return true
+	}
+	return false
+}
+
+// htmlTable renders rows as an HTML table, as notebooks show data frames.
+func htmlTable(rows []map[string]any, cols []string) string {
+	var b strings.Builder
+	b.WriteString("<table>\n<thead>\n<tr>")
+	for _, col := range cols {
+		fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(col))
+	}
+	b.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for i, row := range rows {
+		if i == maxRows {
+			break
+		}
+		b.WriteString("<tr>")
+		for _, col := range cols {
+			fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(cell(row, col)))
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>")
+	if len(rows) > maxRows {
+		fmt.Fprintf(&b, "\n<p>%s</p>", html.EscapeString(more(rows)))
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package kernel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rayo/internal/diag"
+	"rayo/internal/interp"
+	"rayo/repl"
+)
+
+// stream publishes what the code run for a request writes, as the output
+// of that request.
+type stream struct {
+	k      *Kernel
+	parent *Message
+	name   string // "stdout" or "stderr"
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	s.k.publish(s.parent, "stream", map[string]any{"name": s.name, "text": string(p)})
+	return len(p), nil
+}
+
+// execute runs the code of an execute_request in the session. Code that
+// starts with a colon is a REPL command, e.g. :type or :vars.
+func (k *Kernel) execute(msg *Message) map[string]any {
+	var req struct {
+		Code   string `json:"code"`
+		Silent bool   `json:"silent"`
+	}
+	json.Unmarshal(msg.Content, &req)
+	if !req.Silent {
+		k.count++
+		k.publish(msg, "execute_input", map[string]any{"code": req.Code, "execution_count": k.count})
+	}
+	ok := map[string]any{"status": "ok", "execution_count": k.count, "user_expressions": map[string]any{}, "payload": []any{}}
+	k.REPL.Out = &stream{k: k, parent: msg, name: "stdout"}
+	if strings.HasPrefix(strings.TrimSpace(req.Code), ":") {
+		// :quit has no meaning here; the frontend shuts the kernel down
+		k.REPL.Handle(req.Code)
+		return ok
+	}
+	v, err := k.REPL.Eval(req.Code)
+	if err != nil {
+		content := errorContent(err)
+		if !req.Silent {
+			k.publish(msg, "error", content)
+		}
+		content["status"] = "error"
+		content["execution_count"] = k.count
+		return content
+	}
+	if v != nil && !req.Silent {
+		k.publish(msg, "execute_result", map[string]any{
+			"execution_count": k.count,
+			"data":            display(v),
+			"metadata":        map[string]any{},
+		})
+	}
+	return ok
+}
+
+// errorContent describes err as error messages and replies do. Syntax
+// errors are shown with an excerpt of the code, as at the prompt.
+func errorContent(err error) map[string]any {
+	name, value, traceback := "Error", err.Error(), []string{err.Error()}
+	var serr *diag.SourceError
+	var exc *interp.Exception
+	switch {
+	case errors.As(err, &serr):
+		var b strings.Builder
+		serr.Render(&b, &diag.Renderer{Color: true})
+		name, traceback = "SyntaxError", strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	case errors.As(err, &exc):
+		name, value, traceback = exc.Type, exc.Msg, []string{exc.Error()}
+	}
+	return map[string]any{"ename": name, "evalue": value, "traceback": traceback}
+}
+
+// cursorPrefix returns the code before the cursor, which frontends place
+// by counting code points.
+func cursorPrefix(code string, cursor int) string {
+	runes := []rune(code)
+	if cursor < 0 || cursor > len(runes) {
+		cursor = len(runes)
+	}
+	return string(runes[:cursor])
+}
+
+func (k *Kernel) complete(msg *Message) map[string]any {
+	var req struct {
+		Code   string `json:"code"`
+		Cursor int    `json:"cursor_pos"`
+	}
+	json.Unmarshal(msg.Content, &req)
+	prefix := cursorPrefix(req.Code, req.Cursor)
+	start, candidates := k.REPL.Completions(prefix)
+	if candidates == nil {
+		candidates = []string{}
+	}
+	end := len([]rune(prefix))
+	return map[string]any{
+		"status":       "ok",
+		"matches":      candidates,
+		"cursor_start": len([]rune(prefix[:start])),
+		"cursor_end":   end,
+		"metadata":     map[string]any{},
+	}
+}
+
+// inspect shows the type and value of the variable at the cursor.
+func (k *Kernel) inspect(msg *Message) map[string]any {
+	var req struct {
+		Code   string `json:"code"`
+		Cursor int    `json:"cursor_pos"`
+	}
+	json.Unmarshal(msg.Content, &req)
+	runes := []rune(req.Code)
+	start := len([]rune(cursorPrefix(req.Code, req.Cursor)))
+	end := start
+	for start > 0 && isWordRune(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isWordRune(runes[end]) {
+		end++
+	}
+	content := map[string]any{"status": "ok", "found": false, "data": map[string]any{}, "metadata": map[string]any{}}
+	name := string(runes[start:end])
+	v, ok := k.REPL.Scope[name]
+	if !ok {
+		return content
+	}
+	typ, err := k.REPL.TypeOf(name)
+	if err != nil {
+		return content
+	}
+	content["found"] = true
+	content["data"] = map[string]any{"text/plain": fmt.Sprintf("%s: %s = %s", name, typ, interp.Repr(v))}
+	return content
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+func (k *Kernel) isComplete(msg *Message) map[string]any {
+	var req struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(msg.Content, &req)
+	if repl.IsComplete(req.Code) {
+		return map[string]any{"status": "complete"}
+	}
+	return map[string]any{"status": "incomplete", "indent": "    "}
+}
@@ -0,0 +1,259 @@
+// Package kernel implements a Jupyter kernel for Rayo: notebooks and
+// consoles send it code over the Jupyter messaging protocol, and it runs
+// the code in a REPL session, so that variables persist from one cell to
+// the next. Lists of dicts, the rows the stdlib data helpers work with,
+// are displayed as tables. Running code cannot be interrupted.
+package kernel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"rayo/internal/zmtp"
+	"rayo/repl"
+)
+
+// ConnectionInfo is the connection file a Jupyter frontend passes to the
+// kernels it starts: where to listen and how to sign messages.
+type ConnectionInfo struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	ControlPort     int    `json:"control_port"`
+	StdinPort       int    `json:"stdin_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	HBPort          int    `json:"hb_port"`
+	SignatureScheme string `json:"signature_scheme"`
+	Key             string `json:"key"`
+	KernelName      string `json:"kernel_name,omitempty"`
+}
+
+// ReadConnectionFile reads the connection file at path.
+func ReadConnectionFile(path string) (*ConnectionInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info ConnectionInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &info, nil
+}
+
+// Kernel is a running kernel.
+type Kernel struct {
+	// Info is where the kernel listens. Ports given as 0 in the
+	// connection info are set to the ports chosen by Start.
+	Info *ConnectionInfo
+	// Version is reported to frontends as the kernel's version.
+	Version string
+	// REPL is the session code runs in.
+	REPL *repl.REPL
+
+	key     signer
+	session string
+	count   int // execution count
+
+	shell, control, stdin, iopub, hb *zmtp.Socket
+
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+// Start binds the kernel's sockets. Serve answers the requests sent to
+// them.
+func Start(info *ConnectionInfo) (*Kernel, error) {
+	if info.Transport != "" && info.Transport != "tcp" {
+		return nil, fmt.Errorf("unsupported transport %s", info.Transport)
+	}
+	if info.Key != "" && info.SignatureScheme != "hmac-sha256" {
+		return nil, fmt.Errorf("unsupported signature scheme %s", info.SignatureScheme)
+	}
+	k := &Kernel{
+		Info:    info,
+		Version: "dev",
+		REPL:    repl.NewREPL(),
+		key:     signer(info.Key),
+		session: newID(),
+		done:    make(chan struct{}),
+	}
+	k.REPL.In = strings.NewReader("")
+	sockets := []struct {
+		sock **zmtp.Socket
+		port *int
+		typ  string
+	}{
+		{&k.shell, &info.ShellPort, "ROUTER"},
+		{&k.control, &info.ControlPort, "ROUTER"},
+		{&k.stdin, &info.StdinPort, "ROUTER"},
+		{&k.iopub, &info.IOPubPort, "PUB"},
+		{&k.hb, &info.HBPort, "REP"},
+	}
+	for _, s := range sockets {
+		sock, err := zmtp.Listen(fmt.Sprintf("%s:%d", info.IP, *s.port), s.typ)
+		if err != nil {
+			k.Close()
+			return nil, err
+		}
+		*s.sock, *s.port = sock, sock.Port()
+	}
+	return k, nil
+}
+
+// Serve answers requests until a frontend asks the kernel to shut down,
+// then closes its sockets. Code runs one request at a time; control
+// requests are answered while code runs.
+func (k *Kernel) Serve() error {
+	go k.heartbeat()
+	go k.serve(k.control, controlRequests)
+	go k.serve(k.shell, nil)
+	<-k.done
+	return k.Close()
+}
+
+// Close closes the kernel's sockets.
+func (k *Kernel) Close() error {
+	k.shutdown.Do(func() { close(k.done) })
+	var errs []error
+	for _, sock := range []*zmtp.Socket{k.shell, k.control, k.stdin, k.iopub, k.hb} {
+		if sock != nil {
+			errs = append(errs, sock.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// heartbeat echoes the messages sent to the heartbeat socket, which
+// frontends use to tell whether the kernel is alive.
+func (k *Kernel) heartbeat() {
+	for {
+		r, err := k.hb.Recv()
+		if err != nil {
+			return
+		}
+		r.Conn.Send(r.Msg)
+	}
+}
+
+// controlRequests are the requests answered on the control socket. None
+// of them touches the session, which the shell socket's requests use
+// concurrently.
+var controlRequests = map[string]bool{
+	"shutdown_request":    true,
+	"interrupt_request":   true,
+	"kernel_info_request": true,
+	"debug_request":       true,
+}
+
+// serve answers the requests sent to sock, only those of the types in
+// allowed if it is not nil.
+func (k *Kernel) serve(sock *zmtp.Socket, allowed map[string]bool) {
+	for {
+		r, err := sock.Recv()
+		if err != nil {
+			return
+		}
+		msg, err := k.key.decode(r.Msg)
+		if err != nil {
+			// Unsigned or corrupt: not from our frontend
+			continue
+		}
+		if allowed != nil && !allowed[msg.Header.MsgType] {
+			continue
+		}
+		k.handle(r.Conn, msg)
+	}
+}
+
+// handle answers a request, publishing the kernel's status around it.
+func (k *Kernel) handle(conn *zmtp.Conn, msg *Message) {
+	k.publish(msg, "status", map[string]any{"execution_state": "busy"})
+	defer k.publish(msg, "status", map[string]any{"execution_state": "idle"})
+	var content any
+	switch msg.Header.MsgType {
+	case "kernel_info_request":
+		content = k.kernelInfo()
+	case "execute_request":
+		content = k.execute(msg)
+	case "complete_request":
+		content = k.complete(msg)
+	case "inspect_request":
+		content = k.inspect(msg)
+	case "is_complete_request":
+		content = k.isComplete(msg)
+	case "history_request":
+		content = map[string]any{"status": "ok", "history": []any{}}
+	case "comm_info_request":
+		content = map[string]any{"status": "ok", "comms": map[string]any{}}
+	case "interrupt_request":
+		// The interpreter cannot stop running code; say so rather than
+		// let the frontend wait for the code to stop
+		content = map[string]any{
+			"status":    "error",
+			"ename":     "NotImplementedError",
+			"evalue":    "the Rayo kernel cannot interrupt running code",
+			"traceback": []string{},
+		}
+	case "shutdown_request":
+		var req struct {
+			Restart bool `json:"restart"`
+		}
+		json.Unmarshal(msg.Content, &req)
+		content = map[string]any{"status": "ok", "restart": req.Restart}
+		defer k.shutdown.Do(func() { close(k.done) })
+	default:
+		return
+	}
+	msgType := strings.TrimSuffix(msg.Header.MsgType, "_request") + "_reply"
+	k.send(conn, msg, msgType, content)
+}
+
+// send answers parent on conn.
+func (k *Kernel) send(conn *zmtp.Conn, parent *Message, msgType string, content any) {
+	msg, err := reply(k.session, parent, msgType, content)
+	if err != nil {
+		return
+	}
+	frames, err := k.key.encode(msg)
+	if err != nil {
+		return
+	}
+	conn.Send(frames)
+}
+
+// publish broadcasts a message about the handling of parent on the IOPub
+// socket, under a topic naming its type.
+func (k *Kernel) publish(parent *Message, msgType string, content any) {
+	msg, err := reply(k.session, parent, msgType, content)
+	if err != nil {
+		return
+	}
+	msg.Identities = [][]byte{[]byte("kernel." + k.session + "." + msgType)}
+	frames, err := k.key.encode(msg)
+	if err != nil {
+		return
+	}
+	k.iopub.Broadcast(frames)
+}
+
+func (k *Kernel) kernelInfo() map[string]any {
+	return map[string]any{
+		"status":                 "ok",
+		"protocol_version":       protocolVersion,
+		"implementation":         "rayo",
+		"implementation_version": k.Version,
+		"language_info": map[string]any{
+			"name":           "rayo",
+			"version":        k.Version,
+			"mimetype":       "text/x-rayo",
+			"file_extension": ".ryo",
+		},
+		"banner":     "Rayo " + k.Version,
+		"help_links": []any{},
+	}
+}
@@ -0,0 +1,315 @@
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"rayo/internal/interp"
+	"rayo/internal/zmtp"
+)
+
+// frontend plays the part of a Jupyter frontend connected to a kernel.
+type frontend struct {
+	t       *testing.T
+	key     signer
+	shell   *zmtp.Conn
+	control *zmtp.Conn
+	iopub   *zmtp.Conn
+	hb      *zmtp.Conn
+}
+
+// startKernel starts a kernel on free ports and connects a frontend to it.
+// The kernel must be shut down by the test.
+func startKernel(t *testing.T) (*frontend, chan error) {
+	t.Helper()
+	info := &ConnectionInfo{Transport: "tcp", IP: "127.0.0.1", SignatureScheme: "hmac-sha256", Key: "secret"}
+	k, err := Start(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- k.Serve() }()
+	dial := func(port int, typ string) *zmtp.Conn {
+		c, err := zmtp.Dial(fmt.Sprintf("127.0.0.1:%d", port), typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	f := &frontend{t: t, key: signer(info.Key)}
+	f.shell = dial(info.ShellPort, "DEALER")
+	f.control = dial(info.ControlPort, "DEALER")
+	f.iopub = dial(info.IOPubPort, "SUB")
+	f.hb = dial(info.HBPort, "REQ")
+	f.iopub.Send(zmtp.Message{{1}})
+	return f, served
+}
+
+// request sends a request on conn and returns the reply and the messages
+// published while the kernel handled it.
+func (f *frontend) request(conn *zmtp.Conn, msgType string, content any) (*Message, []*Message) {
+	f.t.Helper()
+	msg := f.send(conn, msgType, content)
+	rep := f.recv(conn)
+	if rep.Parent == nil || rep.Parent.MsgID != msg.Header.MsgID {
+		f.t.Fatalf("%s answered with %s to another request", msgType, rep.Header.MsgType)
+	}
+	var published []*Message
+	for {
+		pub := f.recv(f.iopub)
+		if pub.Parent.MsgID != msg.Header.MsgID {
+			continue
+		}
+		published = append(published, pub)
+		if pub.Header.MsgType == "status" && strings.Contains(string(pub.Content), "idle") {
+			return rep, published
+		}
+	}
+}
+
+// send sends a request on conn without waiting for the reply.
+func (f *frontend) send(conn *zmtp.Conn, msgType string, content any) *Message {
+	f.t.Helper()
+	msg, err := reply("frontend", &Message{}, msgType, content)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	msg.Parent = nil
+	frames, err := f.key.encode(msg)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err := conn.Send(frames); err != nil {
+		f.t.Fatal(err)
+	}
+	return msg
+}
+
+func (f *frontend) recv(conn *zmtp.Conn) *Message {
+	f.t.Helper()
+	frames, err := conn.Recv()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	msg, err := f.key.decode(frames)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return msg
+}
+
+// content decodes the content of msg.
+func content(t *testing.T, msg *Message) map[string]any {
+	t.Helper()
+	var c map[string]any
+	if err := json.Unmarshal(msg.Content, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// execute runs code and returns the reply and the published messages
+// other than status messages, as "type: content" strings.
+func (f *frontend) execute(code string) (map[string]any, []string) {
+	f.t.Helper()
+	rep, published := f.request(f.shell, "execute_request", map[string]any{"code": code})
+	var out []string
+	for _, pub := range published {
+		if pub.Header.MsgType != "status" {
+			out = append(out, pub.Header.MsgType+": "+string(pub.Content))
+		}
+	}
+	return content(f.t, rep), out
+}
+
+func (f *frontend) shutdown(served chan error) {
+	f.t.Helper()
+	rep, _ := f.request(f.control, "shutdown_request", map[string]any{"restart": false})
+	if rep.Header.MsgType != "shutdown_reply" {
+		f.t.Errorf("shutdown answered with %s", rep.Header.MsgType)
+	}
+	if err := <-served; err != nil {
+		f.t.Errorf("Serve: %v", err)
+	}
+}
+
+func TestKernelInfo(t *testing.T) {
+	f, served := startKernel(t)
+	defer f.shutdown(served)
+	rep, published := f.request(f.shell, "kernel_info_request", map[string]any{})
+	if rep.Header.MsgType != "kernel_info_reply" {
+		t.Fatalf("reply type = %s", rep.Header.MsgType)
+	}
+	info := content(t, rep)
+	lang := info["language_info"].(map[string]any)
+	if info["status"] != "ok" || lang["name"] != "rayo" || lang["file_extension"] != ".ryo" {
+		t.Errorf("kernel info = %v", info)
+	}
+	if len(published) != 2 || !strings.Contains(string(published[0].Content), "busy") {
+		t.Errorf("published %d messages, want busy and idle status", len(published))
+	}
+
+	f.hb.Send(zmtp.Message{{}, []byte("ping")})
+	if echo, err := f.hb.Recv(); err != nil || len(echo) != 2 || string(echo[1]) != "ping" {
+		t.Errorf("heartbeat echoed %q, %v", echo, err)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	f, served := startKernel(t)
+	defer f.shutdown(served)
+	tests := []struct {
+		code   string
+		status string
+		count  float64
+		out    []string
+	}{
+		{
+			code:   "x = 1 + 2",
+			status: "ok",
+			count:  1,
+			out:    []string{`execute_input: {"code":"x = 1 + 2","execution_count":1}`},
+		},
+		{
+			code:   "print('x is', x)\nx",
+			status: "ok",
+			count:  2,
+			out: []string{
+				`execute_input: {"code":"print('x is', x)\nx","execution_count":2}`,
+				`stream: {"name":"stdout","text":"x is 3\n"}`,
+				`execute_result: {"data":{"text/plain":"3"},"execution_count":2,"metadata":{}}`,
+			},
+		},
+		{
+			code:   "y",
+			status: "error",
+			count:  3,
+			out: []string{
+				`execute_input: {"code":"y","execution_count":3}`,
+				`error: {"ename":"NameError","evalue":"name \"y\" is not defined","traceback":["NameError: name \"y\" is not defined"]}`,
+			},
+		},
+		{
+			code:   ":type x",
+			status: "ok",
+			count:  4,
+			out: []string{
+				`execute_input: {"code":":type x","execution_count":4}`,
+				`stream: {"name":"stdout","text":"int\n"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		rep, out := f.execute(tt.code)
+		if rep["status"] != tt.status || rep["execution_count"] != tt.count {
+			t.Errorf("%q: reply = %v", tt.code, rep)
+		}
+		if strings.Join(out, "\n") != strings.Join(tt.out, "\n") {
+			t.Errorf("%q published:\n%s\nwant:\n%s", tt.code, strings.Join(out, "\n"), strings.Join(tt.out, "\n"))
+		}
+	}
+
+	rep, out := f.execute("x = )")
+	if rep["ename"] != "SyntaxError" || len(out) != 2 || !strings.Contains(out[1], "expected expression") {
+		t.Errorf("syntax error: reply = %v, published %q", rep, out)
+	}
+}
+
+func TestTableDisplay(t *testing.T) {
+	f, served := startKernel(t)
+	defer f.shutdown(served)
+	_, out := f.execute(`[{"name": "ada", "n": 1}, {"name": "grace & co", "n": 22, "ok": True}]`)
+	if len(out) != 2 {
+		t.Fatalf("published %q", out)
+	}
+	var result struct {
+		Data map[string]string `json:"data"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(out[1], "execute_result: ")), &result)
+	wantText := " n  name        ok\n" +
+		"--  ----------  ----\n" +
+		" 1  ada\n" +
+		"22  grace & co  True"
+	if got := result.Data["text/plain"]; got != wantText {
+		t.Errorf("text/plain:\n%s\nwant:\n%s", got, wantText)
+	}
+	wantHTML := "<table>\n<thead>\n<tr><th>n</th><th>name</th><th>ok</th></tr>\n</thead>\n<tbody>\n" +
+		"<tr><td>1</td><td>ada</td><td></td></tr>\n" +
+		"<tr><td>22</td><td>grace &amp; co</td><td>True</td></tr>\n" +
+		"</tbody>\n</table>"
+	if got := result.Data["text/html"]; got != wantHTML {
+		t.Errorf("text/html:\n%s\nwant:\n%s", got, wantHTML)
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	if got := display(&interp.List{Elems: []any{1, "a"}}); len(got) != 1 || got["text/plain"] != `[1, "a"]` {
+		t.Errorf("list of non-dicts displayed as %v", got)
+	}
+	if got := display(&interp.List{}); len(got) != 1 {
+		t.Errorf("empty list displayed as %v", got)
+	}
+	rows := &interp.List{}
+	for i := 0; i < maxRows+10; i++ {
+		rows.Elems = append(rows.Elems, map[string]any{"i": i})
+	}
+	got := display(rows)
+	if lines := strings.Split(got["text/plain"], "\n"); len(lines) != maxRows+3 || lines[len(lines)-1] != "... 10 more rows (60 in total)" {
+		t.Errorf("long table ends with %q", lines[len(lines)-1])
+	}
+	if !strings.HasSuffix(got["text/html"], "<p>... 10 more rows (60 in total)</p>") {
+		t.Errorf("long HTML table ends with %q", got["text/html"][len(got["text/html"])-40:])
+	}
+}
+
+func TestAssistance(t *testing.T) {
+	f, served := startKernel(t)
+	defer f.shutdown(served)
+	f.execute("rows = [{'a': 1}]")
+
+	rep, _ := f.request(f.shell, "complete_request", map[string]any{"code": "x = ro + 1", "cursor_pos": 6})
+	c := content(t, rep)
+	if fmt.Sprint(c["matches"]) != "[rows]" || c["cursor_start"] != 4.0 || c["cursor_end"] != 6.0 {
+		t.Errorf("complete reply = %v", c)
+	}
+
+	rep, _ = f.request(f.shell, "inspect_request", map[string]any{"code": "len(rows)", "cursor_pos": 5})
+	c = content(t, rep)
+	data, _ := c["data"].(map[string]any)
+	if c["found"] != true || data["text/plain"] != `rows: list = [{"a": 1}]` {
+		t.Errorf("inspect reply = %v", c)
+	}
+	rep, _ = f.request(f.shell, "inspect_request", map[string]any{"code": "nope", "cursor_pos": 0})
+	if c = content(t, rep); c["found"] != false {
+		t.Errorf("inspect of an unknown name = %v", c)
+	}
+
+	for code, status := range map[string]string{"def f() {": "incomplete", "x = 1": "complete"} {
+		rep, _ = f.request(f.shell, "is_complete_request", map[string]any{"code": code})
+		if c = content(t, rep); c["status"] != status {
+			t.Errorf("is_complete(%q) = %v, want %s", code, c, status)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	f, served := startKernel(t)
+	defer f.shutdown(served)
+	// Code is only run from the shell socket
+	f.send(f.control, "execute_request", map[string]any{"code": "x = 1"})
+	rep, _ := f.request(f.control, "kernel_info_request", map[string]any{})
+	if rep.Header.MsgType != "kernel_info_reply" {
+		t.Errorf("kernel_info_request on control answered with %s", rep.Header.MsgType)
+	}
+	if rep, _ := f.execute("x"); rep["ename"] != "NameError" {
+		t.Errorf("execute_request on control ran: x gives %v", rep)
+	}
+
+	rep, _ = f.request(f.control, "interrupt_request", map[string]any{})
+	if c := content(t, rep); rep.Header.MsgType != "interrupt_reply" || c["status"] != "error" {
+		t.Errorf("interrupt answered with %s %v", rep.Header.MsgType, c)
+	}
+}
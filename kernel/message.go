@@ -0,0 +1,138 @@
+package kernel
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"rayo/internal/zmtp"
+)
+
+// protocolVersion is the version of the Jupyter messaging protocol the
+// kernel speaks.
+const protocolVersion = "5.3"
+
+// delimiter separates the routing identities of a message from its parts.
+const delimiter = "<IDS|MSG>"
+
+// Header identifies a message and its type.
+type Header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// Message is a Jupyter message. Content is kept as JSON, to be decoded
+// according to the message type.
+type Message struct {
+	Identities [][]byte
+	Header     Header
+	Parent     *Header // nil if the message does not answer another
+	Metadata   map[string]any
+	Content    json.RawMessage
+}
+
+// newID returns a random message or session id.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// signer computes the signatures of messages with an HMAC-SHA256 key.
+// Messages are not signed if the key is empty.
+type signer []byte
+
+func (key signer) sign(parts [][]byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	mac := hmac.New(sha256.New, key)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// encode returns the frames of msg on the wire.
+func (key signer) encode(msg *Message) (zmtp.Message, error) {
+	var parent any = struct{}{}
+	if msg.Parent != nil {
+		parent = msg.Parent
+	}
+	metadata := msg.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	parts := make([][]byte, 4)
+	for i, v := range []any{msg.Header, parent, metadata, msg.Content} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = b
+	}
+	frames := append(zmtp.Message{}, msg.Identities...)
+	frames = append(frames, []byte(delimiter), key.sign(parts))
+	return append(frames, parts...), nil
+}
+
+// decode parses the frames of a message, checking its signature.
+func (key signer) decode(frames zmtp.Message) (*Message, error) {
+	i := 0
+	for i < len(frames) && string(frames[i]) != delimiter {
+		i++
+	}
+	if len(frames) < i+6 {
+		return nil, errors.New("malformed message")
+	}
+	parts := frames[i+2 : i+6]
+	if !hmac.Equal(frames[i+1], key.sign(parts)) {
+		return nil, errors.New("invalid message signature")
+	}
+	msg := &Message{Identities: frames[:i], Content: parts[3]}
+	if err := json.Unmarshal(parts[0], &msg.Header); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(parts[1]), []byte("{}")) {
+		msg.Parent = new(Header)
+		if err := json.Unmarshal(parts[1], msg.Parent); err != nil {
+			return nil, fmt.Errorf("malformed parent header: %w", err)
+		}
+	}
+	if err := json.Unmarshal(parts[2], &msg.Metadata); err != nil {
+		return nil, fmt.Errorf("malformed metadata: %w", err)
+	}
+	return msg, nil
+}
+
+// reply returns a message of type msgType answering parent, sent to the
+// same peer.
+func reply(session string, parent *Message, msgType string, content any) (*Message, error) {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Identities: parent.Identities,
+		Header: Header{
+			MsgID:    newID(),
+			Session:  session,
+			Username: "kernel",
+			Date:     time.Now().UTC().Format(time.RFC3339Nano),
+			MsgType:  msgType,
+			Version:  protocolVersion,
+		},
+		Parent:  &parent.Header,
+		Content: b,
+	}, nil
+}
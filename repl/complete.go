@@ -0,0 +1,65 @@
+package repl
+
+import (
+    "sort"
+    "strings"
+
+    "rayo/internal/interp"
+    "rayo/internal/lex"
+)
+
+// commands are the REPL commands, for completion.
+var commands = []string{":ast", ":go", ":help", ":load", ":quit", ":type", ":vars"}
+
+// Completions returns the completions of the word ending prefix, the text
+// before the cursor, and the offset in prefix where that word starts.
+// After a dot it completes the members of an imported Go package or Rayo
+// module; otherwise the names in scope, the builtins and the keywords,
+// or the commands at the start of the line.
+func (r *REPL) Completions(prefix string) (start int, candidates []string) {
+    start = len(prefix)
+    for start > 0 && isWordByte(prefix[start-1]) {
+        start--
+    }
+    word := prefix[start:]
+    if start == 1 && prefix[0] == ':' {
+        return 0, matching(commands, ":"+word)
+    }
+    if start > 0 && prefix[start-1] == '.' {
+        target := start - 1
+        for target > 0 && isWordByte(prefix[target-1]) {
+            target--
+        }
+        v, _ := r.module.Globals.Get(prefix[target : start-1])
+        var members []string
+        switch x := v.(type) {
+        case *interp.Package:
+            for name := range x.Members {
+                members = append(members, name)
+            }
+        case *interp.Module:
+            members = x.Globals.Names()
+        }
+        return start, matching(members, word)
+    }
+    names := append(append(r.module.Globals.Names(), r.interp.BuiltinNames()...), lex.Keywords()...)
+    return start, matching(names, word)
+}
+
+func isWordByte(c byte) bool {
+    return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// matching returns the distinct words starting with prefix, sorted.
+func matching(words []string, prefix string) []string {
+    seen := map[string]bool{}
+    var out []string
+    for _, w := range words {
+        if strings.HasPrefix(w, prefix) && !seen[w] {
+            seen[w] = true
+            out = append(out, w)
+        }
+    }
+    sort.Strings(out)
+    return out
+}
@@ -0,0 +1,289 @@
+package repl
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "golang.org/x/term"
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is pressed.
+var ErrInterrupted = errors.New("interrupted")
+
+// LineReader reads lines of input, showing prompt first. It returns
+// ErrInterrupted when the user cancels the line and io.EOF at the end of
+// the input.
+type LineReader interface {
+    ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines from a non-interactive input.
+type plainReader struct {
+    in  *bufio.Reader
+    out io.Writer
+}
+
+func (p *plainReader) ReadLine(prompt string) (string, error) {
+    fmt.Fprint(p.out, prompt)
+    line, err := p.in.ReadString('\n')
+    if err != nil && line == "" {
+        return "", err
+    }
+    return strings.TrimSuffix(line, "\n"), nil
+}
+
+// LineEditor reads lines from a terminal in raw mode, with Emacs-style
+// editing keys, history and tab completion. It draws the line itself, so
+// a line is expected to fit the width of the terminal.
+type LineEditor struct {
+    In  io.Reader
+    Out io.Writer
+    // History holds earlier lines, oldest first, for Up and Down to
+    // recall. ReadLine appends the lines it reads.
+    History []string
+    // Complete returns the words that may complete prefix, the text
+    // before the cursor, and the offset in prefix where the word being
+    // completed starts.
+    Complete func(prefix string) (start int, candidates []string)
+
+    in *bufio.Reader
+}
+
+// Keys with a meaning of their own; other control characters are ignored.
+const (
+    keyCtrlA     = 1
+    keyCtrlB     = 2
+    keyCtrlC     = 3
+    keyCtrlD     = 4
+    keyCtrlE     = 5
+    keyCtrlF     = 6
+    keyBackspace = 8
+    keyTab       = 9
+    keyLF        = 10
+    keyCtrlK     = 11
+    keyCtrlL     = 12
+    keyCR        = 13
+    keyCtrlN     = 14
+    keyCtrlP     = 16
+    keyCtrlU     = 21
+    keyCtrlW     = 23
+    keyEscape    = 27
+    keyDelete    = 127
+)
+
+// Keys sent as escape sequences, as runes past the Unicode range.
+const (
+    keyUp rune = 0x110000 + iota
+    keyDown
+    keyLeft
+    keyRight
+    keyHome
+    keyEnd
+    keyDeleteForward
+    keyUnknown
+)
+
+// escapes maps the final part of ESC [ and ESC O sequences to keys.
+var escapes = map[string]rune{
+    "A": keyUp, "B": keyDown, "C": keyRight, "D": keyLeft,
+    "H": keyHome, "F": keyEnd, "1~": keyHome, "7~": keyHome,
+    "4~": keyEnd, "8~": keyEnd, "3~": keyDeleteForward,
+}
+
+// readKey reads a key press.
+func (e *LineEditor) readKey() (rune, error) {
+    r, _, err := e.in.ReadRune()
+    if err != nil || r != keyEscape {
+        return r, err
+    }
+    intro, _, err := e.in.ReadRune()
+    if err != nil {
+        return 0, err
+    }
+    if intro != '[' && intro != 'O' {
+        return keyUnknown, nil
+    }
+    var seq strings.Builder
+    for {
+        c, _, err := e.in.ReadRune()
+        if err != nil {
+            return 0, err
+        }
+        seq.WriteRune(c)
+        if c >= 0x40 && c <= 0x7e {
+            break
+        }
+    }
+    if key, ok := escapes[seq.String()]; ok {
+        return key, nil
+    }
+    return keyUnknown, nil
+}
+
+// ReadLine reads a line, letting the user edit it. The terminal must be
+// in raw mode.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+    if e.in == nil {
+        e.in = bufio.NewReader(e.In)
+    }
+    var line []rune
+    pos := 0
+    hist := len(e.History)
+    pending := "" // the line being edited while history is shown
+    redraw := func() {
+        fmt.Fprintf(e.Out, "\r%s%s\x1b[K", prompt, string(line))
+        if back := len(line) - pos; back > 0 {
+            fmt.Fprintf(e.Out, "\x1b[%dD", back)
+        }
+    }
+    recall := func(s string) {
+        line = []rune(s)
+        pos = len(line)
+    }
+    fmt.Fprint(e.Out, prompt)
+    for {
+        key, err := e.readKey()
+        if err != nil {
+            return "", err
+        }
+        switch key {
+        case keyCR, keyLF:
+            fmt.Fprint(e.Out, "\r\n")
+            if len(line) > 0 {
+                e.History = append(e.History, string(line))
+            }
+            return string(line), nil
+        case keyCtrlC:
+            fmt.Fprint(e.Out, "^C\r\n")
+            return "", ErrInterrupted
+        case keyCtrlD:
+            if len(line) == 0 {
+                fmt.Fprint(e.Out, "\r\n")
+                return "", io.EOF
+            }
+            if pos < len(line) {
+                line = append(line[:pos], line[pos+1:]...)
+            }
+        case keyDeleteForward:
+            if pos < len(line) {
+                line = append(line[:pos], line[pos+1:]...)
+            }
+        case keyBackspace, keyDelete:
+            if pos > 0 {
+                line = append(line[:pos-1], line[pos:]...)
+                pos--
+            }
+        case keyCtrlA, keyHome:
+            pos = 0
+        case keyCtrlE, keyEnd:
+            pos = len(line)
+        case keyCtrlB, keyLeft:
+            if pos > 0 {
+                pos--
+            }
+        case keyCtrlF, keyRight:
+            if pos < len(line) {
+                pos++
+            }
+        case keyCtrlK:
+            line = line[:pos]
+        case keyCtrlU:
+            line = line[pos:]
+            pos = 0
+        case keyCtrlW:
+            start := pos
+            for start > 0 && line[start-1] == ' ' {
+                start--
+            }
+            for start > 0 && line[start-1] != ' ' {
+                start--
+            }
+            line = append(line[:start], line[pos:]...)
+            pos = start
+        case keyCtrlL:
+            fmt.Fprint(e.Out, "\x1b[2J\x1b[H")
+        case keyCtrlP, keyUp:
+            if hist > 0 {
+                if hist == len(e.History) {
+                    pending = string(line)
+                }
+                hist--
+                recall(e.History[hist])
+            }
+        case keyCtrlN, keyDown:
+            if hist < len(e.History) {
+                hist++
+                if hist == len(e.History) {
+                    recall(pending)
+                } else {
+                    recall(e.History[hist])
+                }
+            }
+        case keyTab:
+            line, pos = e.complete(line, pos)
+        default:
+            if key < ' ' || key >= keyUp {
+                continue
+            }
+            line = append(line[:pos], append([]rune{key}, line[pos:]...)...)
+            pos++
+        }
+        redraw()
+    }
+}
+
+// complete extends the word before the cursor as far as the candidates
+// agree, or lists them when they do not.
+func (e *LineEditor) complete(line []rune, pos int) ([]rune, int) {
+    if e.Complete == nil {
+        return line, pos
+    }
+    prefix := string(line[:pos])
+    start, candidates := e.Complete(prefix)
+    if len(candidates) == 0 {
+        return line, pos
+    }
+    word := prefix[start:]
+    common := candidates[0]
+    for _, c := range candidates[1:] {
+        for !strings.HasPrefix(c, common) {
+            common = common[:len(common)-1]
+        }
+    }
+    if len(common) > len(word) && strings.HasPrefix(common, word) {
+        insert := []rune(common[len(word):])
+        line = append(line[:pos], append(insert, line[pos:]...)...)
+        return line, pos + len(insert)
+    }
+    if len(candidates) > 1 {
+        fmt.Fprintf(e.Out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+    }
+    return line, pos
+}
+
+// Terminal reads lines from a terminal with a LineEditor. The terminal is
+// in raw mode only while a line is read, so that programs run in between
+// see it as usual.
+type Terminal struct {
+    Editor *LineEditor
+    fd     int
+}
+
+// NewTerminal returns a Terminal reading in, which must be a terminal,
+// and echoing to out.
+func NewTerminal(in *os.File, out io.Writer) *Terminal {
+    return &Terminal{Editor: &LineEditor{In: in, Out: out}, fd: int(in.Fd())}
+}
+
+func (t *Terminal) ReadLine(prompt string) (string, error) {
+    state, err := term.MakeRaw(t.fd)
+    if err != nil {
+        return "", err
+    }
+    defer term.Restore(t.fd, state)
+    return t.Editor.ReadLine(prompt)
+}
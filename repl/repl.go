@@ -1,47 +1,682 @@
+// Package repl implements the interactive Rayo prompt. Input is evaluated
+// by the interpreter, so variables and functions persist from one input to
+// the next.
 package repl
 
 import (
     "bufio"
+    "errors"
     "fmt"
+    goast "go/ast"
+    "go/format"
+    "go/parser"
+    "go/scanner"
+    "go/token"
+    "go/types"
+    "io"
+    "io/fs"
     "os"
+    "os/signal"
+    "path/filepath"
+    "sort"
+    "strconv"
     "strings"
+
+    "rayo/internal/ast"
+    "rayo/internal/build"
+    "rayo/internal/diag"
+    "rayo/internal/gen"
+    "rayo/internal/interp"
+    "rayo/internal/lex"
+    "rayo/internal/parse"
+    "rayo/internal/sem"
 )
 
+// inputName names the prompt in error messages.
+const inputName = "<stdin>"
+
+// REPL is an interactive session.
 type REPL struct {
-    Scope map[string]any
+    // Scope mirrors the session's globals: it is updated after every
+    // input, and names set in it are visible to the next one.
+    Scope   map[string]any
     History []string
+    In      io.Reader
+    Out     io.Writer
+    // Lines, if set, reads the input instead of In, e.g. a Terminal.
+    Lines LineReader
+    // HistoryFile, if set, is where History is loaded from and saved to.
+    HistoryFile string
+
+    interp  *interp.Interp
+    module  *interp.Module
+    types   map[string]sem.Type
+    imports []*ast.Import // Go imports so far, for :go
+    last    string        // the last Rayo input, for :ast and :go
 }
 
+// NewREPL returns a session reading os.Stdin and writing os.Stdout.
 func NewREPL() *REPL {
-    return &REPL{Scope: map[string]any{}, History: []string{}}
+    r := &REPL{Scope: map[string]any{}, History: []string{}, In: os.Stdin, Out: os.Stdout}
+    r.interp = interp.New()
+    r.module = r.interp.NewModule(inputName)
+    r.types = map[string]sem.Type{}
+    return r
 }
 
+const help = `:type expr   show the static type of expr
+:ast [code]  show the syntax tree of code (default: the last input)
+:go [code]   show the Go code generated for code (default: the last input)
+:load file   run a .ryo file in the session, without calling its main
+:vars        show variables
+:help        show this help
+:quit        exit`
+
+// Run reads inputs until :quit or the end of the input. An input spans
+// several lines while it leaves braces or brackets open; Ctrl-C discards
+// it while it is typed, and raises KeyboardInterrupt in the code it runs
+// once entered. Lines are read from Lines if set, or else from In.
 func (r *REPL) Run() {
-    reader := bufio.NewReader(os.Stdin)
-    fmt.Println("Rayo REPL. Type :help for commands.")
+    lines := r.Lines
+    if lines == nil {
+        lines = &plainReader{in: bufio.NewReader(r.In), out: r.Out}
+    }
+    if r.HistoryFile != "" {
+        if err := r.LoadHistory(r.HistoryFile); err != nil {
+            r.printError(err)
+        }
+    }
+    if t, ok := lines.(*Terminal); ok {
+        // The editor recalls lines, so inputs spanning lines are split
+        for _, entry := range r.History {
+            t.Editor.History = append(t.Editor.History, strings.Split(entry, "\n")...)
+        }
+        if t.Editor.Complete == nil {
+            t.Editor.Complete = r.Completions
+        }
+    }
+    fmt.Fprintln(r.Out, "Rayo REPL. Type :help for commands.")
+    var input strings.Builder
     for {
-        fmt.Print("> ")
-        line, err := reader.ReadString('\n')
+        prompt := "> "
+        if input.Len() > 0 {
+            prompt = "... "
+        }
+        line, err := lines.ReadLine(prompt)
+        if err == ErrInterrupted {
+            input.Reset()
+            continue
+        }
         if err != nil {
             break
         }
-        line = strings.TrimSpace(line)
-        r.History = append(r.History, line)
-        if line == ":help" {
-            fmt.Println(":type expr — show type\n:vars — show variables\n:quit — exit")
+        input.WriteString(line)
+        input.WriteByte('\n')
+        if !IsComplete(input.String()) {
+            continue
+        }
+        src := strings.TrimSpace(input.String())
+        input.Reset()
+        if src == "" {
             continue
         }
-        if line == ":quit" {
+        r.History = append(r.History, src)
+        if r.HistoryFile != "" {
+            if err := AppendHistory(r.HistoryFile, src); err != nil {
+                r.printError(err)
+            }
+        }
+        stop := r.catchInterrupts()
+        quit := r.Handle(src)
+        stop()
+        if quit {
             break
         }
-        if line == ":vars" {
-            fmt.Println("Variables:")
-            for k, v := range r.Scope {
-                fmt.Printf("%s = %v\n", k, v)
+    }
+}
+
+// catchInterrupts makes SIGINT interrupt the code being run rather than
+// end the REPL, until the function it returns is called.
+func (r *REPL) catchInterrupts() func() {
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, os.Interrupt)
+    done := make(chan struct{})
+    go func() {
+        for {
+            select {
+            case <-sigs:
+                r.interp.Interrupt()
+            case <-done:
+                return
+            }
+        }
+    }()
+    return func() {
+        signal.Stop(sigs)
+        close(done)
+    }
+}
+
+// maxHistory is the number of inputs LoadHistory keeps.
+const maxHistory = 1000
+
+// HistoryFile returns the file the history of interactive sessions is
+// kept in, in the user's config directory.
+func HistoryFile() (string, error) {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(dir, "rayo", "repl_history"), nil
+}
+
+// LoadHistory prepends the last inputs saved in file to History. A
+// missing file is an empty history. A file holding more than maxHistory
+// inputs is trimmed to the last of them.
+func (r *REPL) LoadHistory(file string) error {
+    data, err := os.ReadFile(file)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    var saved []string
+    for _, line := range strings.Split(string(data), "\n") {
+        // Each input is quoted, as it may span lines
+        if entry, err := strconv.Unquote(line); err == nil {
+            saved = append(saved, entry)
+        }
+    }
+    if len(saved) > maxHistory {
+        saved = saved[len(saved)-maxHistory:]
+        if err := trimHistory(file, saved); err != nil {
+            return err
+        }
+    }
+    r.History = append(saved, r.History...)
+    return nil
+}
+
+// trimHistory replaces file with entries. The new file is renamed into
+// place, so that a session reading it never sees it half written.
+func trimHistory(file string, entries []string) error {
+    var b strings.Builder
+    for _, entry := range entries {
+        b.WriteString(strconv.Quote(entry))
+        b.WriteByte('\n')
+    }
+    tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+    if err != nil {
+        return err
+    }
+    if _, err := tmp.WriteString(b.String()); err != nil {
+        tmp.Close()
+        os.Remove(tmp.Name())
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    return os.Rename(tmp.Name(), file)
+}
+
+// AppendHistory adds entry, an input, to the end of file. Each input is
+// appended with a single write, so that sessions sharing the file add
+// their inputs to it rather than overwrite each other's.
+func AppendHistory(file, entry string) error {
+    if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+    if err != nil {
+        return err
+    }
+    if _, err := f.WriteString(strconv.Quote(entry) + "\n"); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// IsComplete reports whether src is a complete input: one that leaves no
+// brace, bracket, parenthesis or string open.
+func IsComplete(src string) bool {
+    depth := 0
+    lx := lex.NewLexer(src)
+    for {
+        tok := lx.Next()
+        switch tok.Kind {
+        case lex.TokenEOF:
+            return depth <= 0
+        case lex.TokenLBrace, lex.TokenLParen, lex.TokenLBracket:
+            depth++
+        case lex.TokenRBrace, lex.TokenRParen, lex.TokenRBracket:
+            depth--
+        case lex.TokenString:
+            if len(tok.Value) < 2 || tok.Value[len(tok.Value)-1] != tok.Value[0] {
+                return false
+            }
+        }
+    }
+}
+
+// Handle runs a command or evaluates Rayo source, writing the result or
+// error to Out. It reports whether the session should end.
+func (r *REPL) Handle(input string) (quit bool) {
+    cmd, arg, _ := strings.Cut(strings.TrimSpace(input), " ")
+    arg = strings.TrimSpace(arg)
+    var err error
+    switch {
+    case cmd == ":quit":
+        return true
+    case cmd == ":help":
+        fmt.Fprintln(r.Out, help)
+    case cmd == ":vars":
+        fmt.Fprintln(r.Out, "Variables:")
+        for _, name := range r.module.Globals.Names() {
+            v, _ := r.module.Globals.Get(name)
+            fmt.Fprintf(r.Out, "%s = %s\n", name, interp.Repr(v))
+        }
+    case cmd == ":type":
+        var t string
+        if t, err = r.TypeOf(arg); err == nil {
+            fmt.Fprintln(r.Out, t)
+        }
+    case cmd == ":ast":
+        var tree string
+        if tree, err = r.AST(r.orLast(arg)); err == nil {
+            fmt.Fprint(r.Out, tree)
+        }
+    case cmd == ":go":
+        var code string
+        if code, err = r.GoCode(r.orLast(arg)); err == nil {
+            fmt.Fprint(r.Out, code)
+        }
+    case cmd == ":load":
+        err = r.Load(arg)
+    case strings.HasPrefix(cmd, ":"):
+        err = fmt.Errorf("unknown command %s; type :help for the list", cmd)
+    default:
+        var v any
+        if v, err = r.Eval(input); err == nil && v != nil {
+            fmt.Fprintln(r.Out, interp.Repr(v))
+        }
+    }
+    if err != nil {
+        r.printError(err)
+    }
+    return false
+}
+
+func (r *REPL) orLast(code string) string {
+    if code == "" {
+        return r.last
+    }
+    return code
+}
+
+// printError shows a syntax error with an excerpt of the input and other
+// errors on one line.
+func (r *REPL) printError(err error) {
+    var serr *diag.SourceError
+    if errors.As(err, &serr) {
+        color := false
+        if f, ok := r.Out.(*os.File); ok {
+            color = diag.ColorEnabled(f)
+        }
+        serr.Render(r.Out, &diag.Renderer{Color: color})
+        return
+    }
+    var exc *interp.Exception
+    if errors.As(err, &exc) {
+        fmt.Fprintln(r.Out, exc.Error())
+        return
+    }
+    fmt.Fprintf(r.Out, "error: %v\n", err)
+}
+
+// parseInput parses src, an input at the prompt, as a module.
+func parseInput(src string) (*ast.Module, error) {
+    p := parse.NewParser(src)
+    mod := p.ParseModule()
+    if errs := p.Errors(); len(errs) > 0 {
+        serr := &diag.SourceError{File: inputName, Source: src}
+        for _, err := range errs {
+            if pe, ok := err.(*parse.ParseError); ok {
+                serr.Diagnostics = append(serr.Diagnostics, pe.Diagnostic())
+            } else {
+                serr.Diagnostics = append(serr.Diagnostics, diag.Diagnostic{Severity: diag.Error, Code: parse.CodeSyntax, Msg: err.Error()})
+            }
+        }
+        return nil, serr
+    }
+    return mod, nil
+}
+
+// Eval evaluates Rayo source in the session and returns the value of its
+// last statement if that is an expression, or nil.
+func (r *REPL) Eval(src string) (any, error) {
+    mod, err := parseInput(src)
+    if err != nil {
+        return nil, err
+    }
+    r.last = src
+    r.interp.Stdin, r.interp.Stdout = r.In, r.Out
+    for name, v := range r.Scope {
+        r.module.Globals.Set(name, v)
+    }
+    defer r.syncScope()
+    if err := r.importAll(mod.Imports); err != nil {
+        return nil, err
+    }
+    v, err := r.interp.Exec(r.module, mod.Body)
+    if err != nil {
+        return nil, err
+    }
+    r.recordTypes(mod.Body)
+    return v, nil
+}
+
+func (r *REPL) syncScope() {
+    for _, name := range r.module.Globals.Names() {
+        r.Scope[name], _ = r.module.Globals.Get(name)
+    }
+}
+
+// recordTypes notes the static types of the names stmts bind, for :type.
+func (r *REPL) recordTypes(stmts []ast.Stmt) {
+    for _, stmt := range stmts {
+        switch s := stmt.(type) {
+        case *ast.VarStmt:
+            r.types[s.Name] = sem.InferTypeIn(s.Value, r.types)
+        case *ast.AssignStmt:
+            if name, ok := s.Target.(*ast.Name); ok {
+                r.types[name.Ident] = sem.InferTypeIn(s.Value, r.types)
             }
+        case *ast.FuncDef:
+            r.types[s.Name] = &sem.BasicType{Name: "function"}
+        }
+    }
+}
+
+// importAll binds imports in the session. Rayo modules are loaded from
+// paths relative to the working directory.
+func (r *REPL) importAll(imports []*ast.Import) error {
+    deps := map[string]*interp.Module{}
+    for _, imp := range imports {
+        if !sem.IsRayoImport(imp.Path) {
+            r.addGoImport(imp)
+            continue
+        }
+        prog, err := build.Load(imp.Path, build.Options{})
+        if err != nil {
+            return err
+        }
+        mods, err := r.execDeps(prog)
+        if err != nil {
+            return err
+        }
+        entry := prog.Entry
+        m, err := r.interp.ExecModule(entry.File, entry.AST, depsOf(entry, mods))
+        if err != nil {
+            return err
+        }
+        deps[imp.Path] = m
+    }
+    return r.interp.Import(r.module, imports, deps)
+}
+
+// addGoImport remembers a Go import for :go, once.
+func (r *REPL) addGoImport(imp *ast.Import) {
+    for _, prev := range r.imports {
+        if parse.PrettyPrint(prev) == parse.PrettyPrint(imp) {
+            return
+        }
+    }
+    r.imports = append(r.imports, imp)
+}
+
+// execDeps evaluates the modules of prog but its entry, in dependency
+// order.
+func (r *REPL) execDeps(prog *build.Program) (map[*build.Module]*interp.Module, error) {
+    mods := map[*build.Module]*interp.Module{}
+    for _, m := range prog.Modules {
+        if m == prog.Entry {
             continue
         }
-        // TODO: parse, sem-check, transpile, run
-        fmt.Println("(not yet implemented)")
+        im, err := r.interp.ExecModule(m.File, m.AST, depsOf(m, mods))
+        if err != nil {
+            return nil, err
+        }
+        mods[m] = im
+    }
+    return mods, nil
+}
+
+func depsOf(m *build.Module, mods map[*build.Module]*interp.Module) map[string]*interp.Module {
+    deps := map[string]*interp.Module{}
+    for path, dep := range m.Deps {
+        deps[path] = mods[dep]
+    }
+    return deps
+}
+
+// Load runs the top level of a .ryo file in the session, so that its
+// functions and variables become available. Its main is not called.
+func (r *REPL) Load(file string) error {
+    if file == "" {
+        return fmt.Errorf("usage: :load file.ryo")
+    }
+    prog, err := build.Load(file, build.Options{})
+    if err != nil {
+        return err
+    }
+    r.interp.Stdin, r.interp.Stdout = r.In, r.Out
+    defer r.syncScope()
+    mods, err := r.execDeps(prog)
+    if err != nil {
+        return err
+    }
+    entry := prog.Entry
+    for _, imp := range entry.AST.Imports {
+        if !sem.IsRayoImport(imp.Path) {
+            r.addGoImport(imp)
+        }
+    }
+    if err := r.interp.Import(r.module, entry.AST.Imports, depsOf(entry, mods)); err != nil {
+        return err
+    }
+    if _, err := r.interp.Exec(r.module, entry.AST.Body); err != nil {
+        return err
+    }
+    r.recordTypes(entry.AST.Body)
+    return nil
+}
+
+// TypeOf returns the static type of the expression src, as sem infers it
+// from the types of the session's variables.
+func (r *REPL) TypeOf(src string) (string, error) {
+    mod, err := parseInput(src)
+    if err != nil {
+        return "", err
+    }
+    if len(mod.Imports) > 0 || len(mod.Body) != 1 {
+        return "", fmt.Errorf("usage: :type expr")
+    }
+    es, ok := mod.Body[0].(*ast.ExprStmt)
+    if !ok {
+        return "", fmt.Errorf("usage: :type expr")
+    }
+    return sem.TypeString(sem.InferTypeIn(es.Expr, r.types)), nil
+}
+
+// AST returns the syntax tree of src.
+func (r *REPL) AST(src string) (string, error) {
+    mod, err := parseInput(src)
+    if err != nil {
+        return "", err
+    }
+    return ast.Sexpr(mod), nil
+}
+
+// GoCode returns the Go code generated for src as a program that
+// compiles: with the session's Go imports, and declarations of the session
+// variables and functions src uses. Statements that Go only allows in a
+// function body are put in main, where a program would run them;
+// expressions there are printed, as the prompt shows them, and the first
+// assignment to a new name declares a package variable, as it binds a
+// global in the session. Rayo values are dynamically typed and session
+// functions return any, so some inputs have no typed Go translation, such
+// as arithmetic on what a function returns; GoCode reports those as errors
+// rather than return code that does not compile.
+func (r *REPL) GoCode(src string) (string, error) {
+    mod, err := parseInput(src)
+    if err != nil {
+        return "", err
+    }
+    body, globals, err := r.declarations(mod.Body)
+    if err != nil {
+        return "", err
+    }
+    main := &ast.FuncDef{Name: "main"}
+    for _, stmt := range mod.Body {
+        switch s := stmt.(type) {
+        case *ast.FuncDef, *ast.VarStmt:
+            body = append(body, stmt)
+        case *ast.AssignStmt:
+            if name, ok := s.Target.(*ast.Name); ok && !globals[name.Ident] {
+                globals[name.Ident] = true
+                decl := &ast.VarStmt{Name: name.Ident, Value: s.Value}
+                decl.SetSpan(s.Span())
+                body = append(body, decl)
+                continue
+            }
+            main.Body = append(main.Body, stmt)
+        case *ast.ExprStmt:
+            if _, ok := s.Expr.(*ast.Call); !ok {
+                call := &ast.Call{Func: &ast.Name{Ident: "print"}, Args: []ast.Expr{s.Expr}}
+                call.SetSpan(s.Span())
+                printed := &ast.ExprStmt{Expr: call}
+                printed.SetSpan(s.Span())
+                stmt = printed
+            }
+            main.Body = append(main.Body, stmt)
+        default:
+            main.Body = append(main.Body, stmt)
+        }
+    }
+    mod.Body = append(body, main)
+    mod.Imports = append(append([]*ast.Import{}, r.imports...), mod.Imports...)
+    ctx := gen.NewGenContext("main")
+    list := &diag.List{File: inputName}
+    gi := sem.NewGoImporter(".")
+    ctx.GoImports = sem.ResolveImports(mod, gi, list)
+    code := gen.EmitModule(mod, ctx)
+    if err := typeCheck(code, gi); err != nil {
+        return "", fmt.Errorf("no typed Go translation: %v", err)
+    }
+    // Shown to a person, so gofmt it when it is valid Go
+    if formatted, err := format.Source([]byte(code)); err == nil {
+        code = string(formatted)
+    }
+    return code, nil
+}
+
+// typeCheck type-checks code, a Go main package, importing Go packages
+// with gi. Errors are reported without their positions, which are in the
+// generated code rather than the input.
+func typeCheck(code string, gi *sem.GoImporter) error {
+    fset := token.NewFileSet()
+    file, err := parser.ParseFile(fset, "main.go", code, 0)
+    if err != nil {
+        var serr scanner.ErrorList
+        if errors.As(err, &serr) {
+            return errors.New(serr[0].Msg)
+        }
+        return err
+    }
+    conf := types.Config{Importer: goImporter{gi}}
+    _, err = conf.Check("main", fset, []*goast.File{file}, nil)
+    var terr types.Error
+    if errors.As(err, &terr) {
+        return errors.New(terr.Msg)
+    }
+    return err
+}
+
+// goImporter adapts a sem.GoImporter to go/types.
+type goImporter struct {
+    gi *sem.GoImporter
+}
+
+func (i goImporter) Import(path string) (*types.Package, error) {
+    pkg, err := i.gi.Import(path)
+    if err != nil {
+        return nil, err
+    }
+    return pkg.Types, nil
+}
+
+// declarations declares the session variables and functions that stmts
+// use and do not define themselves, and those that the declared functions
+// use in turn, as top-level statements. It also returns the names declared
+// at the top level, by stmts or the declarations.
+func (r *REPL) declarations(stmts []ast.Stmt) ([]ast.Stmt, map[string]bool, error) {
+    defined := map[string]bool{}
+    refs := &nameRefs{names: map[string]bool{}}
+    for _, stmt := range stmts {
+        switch s := stmt.(type) {
+        case *ast.FuncDef:
+            defined[s.Name] = true
+        case *ast.VarStmt:
+            defined[s.Name] = true
+        }
+        ast.Walk(refs, stmt)
+    }
+    var decls []ast.Stmt
+    for len(refs.names) > 0 {
+        names := make([]string, 0, len(refs.names))
+        for name := range refs.names {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        refs.names = map[string]bool{}
+        for _, name := range names {
+            v, ok := r.Scope[name]
+            if !ok || defined[name] {
+                continue
+            }
+            defined[name] = true
+            switch v := v.(type) {
+            case int, float64, string, bool:
+                decls = append(decls, &ast.VarStmt{Name: name, Value: &ast.Literal{Value: v}})
+            case *interp.Function:
+                if v.Body == nil {
+                    return nil, nil, fmt.Errorf(":go: cannot declare %s: lambdas have no Go translation", name)
+                }
+                decls = append(decls, &ast.FuncDef{Name: name, Params: v.Params, Body: v.Body})
+                for _, stmt := range v.Body {
+                    ast.Walk(refs, stmt)
+                }
+            case *interp.List, map[string]any:
+                return nil, nil, fmt.Errorf(":go: cannot declare %s: %s values have no Go translation", name, interp.TypeName(v))
+            }
+            // Other names are imports and builtins, which need no declaration
+        }
+    }
+    return decls, defined, nil
+}
+
+// nameRefs collects the names an AST refers to.
+type nameRefs struct {
+    names map[string]bool
+}
+
+func (c *nameRefs) Visit(n ast.Node) bool {
+    if name, ok := n.(*ast.Name); ok {
+        c.names[name.Ident] = true
     }
+    return true
 }
@@ -1,6 +1,22 @@
 package repl
 
-import "testing"
+import (
+    "bytes"
+    goast "go/ast"
+    "go/importer"
+    "go/parser"
+    "go/token"
+    "go/types"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+
+    "rayo/internal/interp"
+)
 
 func TestREPLSession(t *testing.T) {
     r := NewREPL()
@@ -12,4 +28,297 @@ func TestREPLSession(t *testing.T) {
     if r.Scope["x"] != 42 {
         t.Errorf("REPL scope failed")
     }
+    if v, err := r.Eval("x + 1"); err != nil || v != 43 {
+        t.Errorf("Scope not visible to Eval: got %v, %v", v, err)
+    }
+}
+
+// session runs input through a REPL and returns its output without the
+// banner and prompts.
+func session(t *testing.T, r *REPL, input string) string {
+    t.Helper()
+    var out bytes.Buffer
+    r.In = strings.NewReader(input)
+    r.Out = &out
+    r.Run()
+    got := strings.TrimPrefix(out.String(), "Rayo REPL. Type :help for commands.\n")
+    got = strings.ReplaceAll(got, "... ", "")
+    return strings.ReplaceAll(got, "> ", "")
+}
+
+func TestREPLRun(t *testing.T) {
+    input := `var x = 20
+x + 22
+def greet() {
+    print("hello", x)
+}
+greet()
+x = "s"
+:type x + "t"
+:type len(x)
+import "strings"
+strings.ToUpper(x)
+y
+:vars
+:quit
+print("not run")
+`
+    want := `42
+hello 20
+str
+int
+"S"
+NameError: name "y" is not defined
+Variables:
+greet = <function greet>
+strings = <Go package strings>
+x = "s"
+`
+    r := NewREPL()
+    if got := session(t, r, input); got != want {
+        t.Errorf("got:\n%s\nwant:\n%s", got, want)
+    }
+    if r.Scope["x"] != "s" {
+        t.Errorf("Scope[x] = %v, want s", r.Scope["x"])
+    }
+    if len(r.History) != 12 || r.History[2] != "def greet() {\n    print(\"hello\", x)\n}" {
+        t.Errorf("History = %q", r.History)
+    }
+}
+
+func TestREPLCommands(t *testing.T) {
+    dir := t.TempDir()
+    lib := filepath.Join(dir, "lib.ryo")
+    if err := os.WriteFile(lib, []byte("var greeting = \"hi\"\ndef main() { print(\"main\") }\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    r := NewREPL()
+    got := session(t, r, ":load "+lib+"\ngreeting\n:ast greeting\n:go print(greeting)\n1 +\n")
+    for _, want := range []string{
+        "\"hi\"\n",
+        "(Name greeting @1:1-1:9)",
+        "func main() {\n\trayoPrint(greeting)\n}",
+        "expected expression",
+    } {
+        if !strings.Contains(got, want) {
+            t.Errorf("output lacks %q:\n%s", want, got)
+        }
+    }
+    if strings.HasPrefix(got, "main\n") {
+        t.Errorf(":load called main:\n%s", got)
+    }
+}
+
+func TestGoCode(t *testing.T) {
+    r := NewREPL()
+    for _, src := range []string{"x = 41", "def next() {\n    return x + 1\n}", "s = \"hi\""} {
+        if _, err := r.Eval(src); err != nil {
+            t.Fatalf("%s: %v", src, err)
+        }
+    }
+    tests := []struct {
+        src  string
+        want string
+    }{
+        {"x + 1", "var x = 41\n\nfunc main() {\n\trayoPrint((x + 1))\n}"},
+        {"print(next(), s)", "func next() any {\n\treturn (x + 1)\n}\n\nvar s = \"hi\"\nvar x = 41\n"},
+        {"y = x\ny = 2", "var y = x\n\nfunc main() {\n\ty = 2\n}"},
+    }
+    for _, tt := range tests {
+        code, err := r.GoCode(tt.src)
+        if err != nil {
+            t.Fatalf("%q: %v", tt.src, err)
+        }
+        if !strings.Contains(code, tt.want) {
+            t.Errorf("%q: Go code lacks %q:\n%s", tt.src, tt.want, code)
+        }
+        // The code compiles
+        fset := token.NewFileSet()
+        file, err := parser.ParseFile(fset, "main.go", code, 0)
+        if err != nil {
+            t.Fatalf("%q: %v\n%s", tt.src, err, code)
+        }
+        conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+        if _, err := conf.Check("main", fset, []*goast.File{file}, nil); err != nil {
+            t.Errorf("%q: %v\n%s", tt.src, err, code)
+        }
+    }
+
+    // Session functions return any, which Go arithmetic does not take
+    if _, err := r.GoCode("next() + x"); err == nil || !strings.Contains(err.Error(), "no typed Go translation") {
+        t.Errorf("next() + x: got error %v, want no typed Go translation", err)
+    }
+
+    r.Scope["rows"] = &interp.List{}
+    if _, err := r.GoCode("print(rows)"); err == nil {
+        t.Errorf("no error for a list variable")
+    }
+}
+
+func TestGoCodeRuns(t *testing.T) {
+    if testing.Short() {
+        t.Skip("not building Go code in short mode")
+    }
+    if _, err := exec.LookPath("go"); err != nil {
+        t.Skip("go toolchain not found")
+    }
+    r := NewREPL()
+    for _, src := range []string{"x = 41", "def next() {\n    return x + 1\n}"} {
+        if _, err := r.Eval(src); err != nil {
+            t.Fatalf("%s: %v", src, err)
+        }
+    }
+    code, err := r.GoCode("print(next(), next() == 42)")
+    if err != nil {
+        t.Fatal(err)
+    }
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module gocode\n\ngo 1.22\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0644); err != nil {
+        t.Fatal(err)
+    }
+    cmd := exec.Command("go", "run", ".")
+    cmd.Dir = dir
+    out, err := cmd.CombinedOutput()
+    if err != nil {
+        t.Fatalf("go run: %v\n%s\n%s", err, out, code)
+    }
+    if string(out) != "42 True\n" {
+        t.Errorf("got %q, want %q\n%s", out, "42 True\n", code)
+    }
+}
+
+func TestIsComplete(t *testing.T) {
+    for src, want := range map[string]bool{
+        "x = 1":            true,
+        "def f() {":        false,
+        "def f() {\n}":     true,
+        "print(1,":         false,
+        "var s = \"a":      false,
+        "var s = \"{\"":    true,
+        "}":                true,
+        "# {":              true,
+    } {
+        if got := IsComplete(src); got != want {
+            t.Errorf("IsComplete(%q) = %v, want %v", src, got, want)
+        }
+    }
+}
+
+func TestLineEditor(t *testing.T) {
+    keys := "abc\x01X\x05Y\r" + // Ctrl-A and Ctrl-E move to the ends
+        "one two\x17three\r" + // Ctrl-W deletes a word
+        "\x1b[A\x1b[A\x1b[B!\r" + // Up twice, Down once: the second line
+        "hel\x1b[D\x1b[D\x7f_\x1b[3~\r" + // Left, Backspace, Delete
+        "lost\x03" + // Ctrl-C cancels
+        "pri\t(1)\r" + // Tab completes
+        "\x04"
+    e := &LineEditor{In: strings.NewReader(keys), Out: io.Discard, History: []string{"old"}}
+    e.Complete = func(prefix string) (int, []string) {
+        if strings.HasSuffix(prefix, "pri") {
+            return len(prefix) - 3, []string{"print"}
+        }
+        return len(prefix), nil
+    }
+    want := []string{"XabcY", "one three", "one three!", "_l", "", "print(1)"}
+    for i, w := range want {
+        got, err := e.ReadLine("> ")
+        if i == 4 {
+            if err != ErrInterrupted {
+                t.Errorf("Ctrl-C: got %q, %v, want ErrInterrupted", got, err)
+            }
+            continue
+        }
+        if err != nil || got != w {
+            t.Errorf("line %d: got %q, %v, want %q", i, got, err, w)
+        }
+    }
+    if _, err := e.ReadLine("> "); err != io.EOF {
+        t.Errorf("Ctrl-D on an empty line: got %v, want io.EOF", err)
+    }
+    if got := strings.Join(e.History, "|"); got != "old|XabcY|one three|one three!|_l|print(1)" {
+        t.Errorf("History = %s", got)
+    }
+}
+
+func TestCompletions(t *testing.T) {
+    r := NewREPL()
+    if _, err := r.Eval("import \"strings\"\nvar counter = 1\ndef count_up() { return 2 }"); err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        prefix string
+        start  int
+        want   string
+    }{
+        {"cou", 0, "count_up counter"},
+        {"x = le", 4, "len"},
+        {"re", 0, "repr return"},
+        {"strings.ToU", 8, "ToUpper"},
+        {":lo", 0, ":load"},
+        {"nothing_", 0, ""},
+    }
+    for _, tt := range tests {
+        start, got := r.Completions(tt.prefix)
+        if start != tt.start || strings.Join(got, " ") != tt.want {
+            t.Errorf("Completions(%q) = %d, %q, want %d, %q", tt.prefix, start, got, tt.start, tt.want)
+        }
+    }
+}
+
+func TestHistoryFile(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "rayo", "history")
+    r := NewREPL()
+    r.HistoryFile = file
+    session(t, r, "var s = 'say \"hi\"'\ndef f() {\n    return s\n}\n")
+    r = NewREPL()
+    if err := r.LoadHistory(file); err != nil {
+        t.Fatal(err)
+    }
+    want := []string{`var s = 'say "hi"'`, "def f() {\n    return s\n}"}
+    if strings.Join(r.History, "|") != strings.Join(want, "|") {
+        t.Errorf("History = %q, want %q", r.History, want)
+    }
+    if err := r.LoadHistory(filepath.Join(t.TempDir(), "missing")); err != nil {
+        t.Errorf("missing history file: %v", err)
+    }
+
+    // Sessions sharing the file add to it rather than overwrite it
+    file = filepath.Join(t.TempDir(), "history")
+    a, b := NewREPL(), NewREPL()
+    a.HistoryFile, b.HistoryFile = file, file
+    session(t, a, "1\n")
+    session(t, b, "2\n")
+    session(t, a, "3\n")
+    r = NewREPL()
+    if err := r.LoadHistory(file); err != nil {
+        t.Fatal(err)
+    }
+    if got := strings.Join(r.History, "|"); got != "1|2|3" {
+        t.Errorf("History = %q, want 1|2|3", got)
+    }
+
+    // Loading trims the file to the last maxHistory inputs, dropping the
+    // three above
+    for i := 0; i < maxHistory; i++ {
+        if err := AppendHistory(file, strconv.Itoa(i)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    r = NewREPL()
+    if err := r.LoadHistory(file); err != nil {
+        t.Fatal(err)
+    }
+    if len(r.History) != maxHistory || r.History[0] != "0" {
+        t.Errorf("loaded %d inputs starting with %q, want %d starting with \"0\"", len(r.History), r.History[0], maxHistory)
+    }
+    data, err := os.ReadFile(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := strings.Count(string(data), "\n"); n != maxHistory {
+        t.Errorf("history file holds %d inputs after loading, want %d", n, maxHistory)
+    }
 }
@@ -0,0 +1,54 @@
+package main
+
+import "fmt"
+// rayoPrint writes its arguments as Rayo's print does.
+func rayoPrint(args ...any) {
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case nil:
+			args[i] = "None"
+		case bool:
+			if arg {
+				args[i] = "True"
+			} else {
+				args[i] = "False"
+			}
+		}
+	}
+	fmt.Println(args...)
+}
+
+// AssertionError is raised by a failing assert statement.
+type AssertionError struct {
+	Msg string
+}
+
+func (e *AssertionError) Error() string {
+	return "AssertionError: " + e.Msg
+}
+
+// rayoRepr renders a value the way Rayo source spells it.
+func rayoRepr(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(v)
+}
+
+//line asserts.ryo:2
+func main() {
+var x = 3
+if rayoL := x; !(rayoL == 3) { panic(&AssertionError{Msg: "assert x == 3" + ": " + rayoRepr(rayoL) + " != " + rayoRepr(3) + ", where " + rayoRepr(rayoL) + " = x"}) }
+if rayoL := x; !(rayoL != 4) { panic(&AssertionError{Msg: fmt.Sprint("x is not 4") + ": " + rayoRepr(rayoL) + " == " + rayoRepr(4) + ", where " + rayoRepr(rayoL) + " = x"}) }
+if rayoL := x; !(rayoL < 10) { panic(&AssertionError{Msg: "assert x < 10" + ": " + rayoRepr(rayoL) + " >= " + rayoRepr(10) + ", where " + rayoRepr(rayoL) + " = x"}) }
+if rayoL := x; !(rayoL > 0) { panic(&AssertionError{Msg: fmt.Sprint(x) + ": " + rayoRepr(rayoL) + " <= " + rayoRepr(0) + ", where " + rayoRepr(rayoL) + " = x"}) }
+rayoPrint("all asserts passed")
+}
@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+// rayoPrint writes its arguments as Rayo's print does.
+func rayoPrint(args ...any) {
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case nil:
+			args[i] = "None"
+		case bool:
+			if arg {
+				args[i] = "True"
+			} else {
+				args[i] = "False"
+			}
+		}
+	}
+	fmt.Println(args...)
+}
+
+//line functions_print.ryo:2
+func greeting() any {
+return "hello"
+}
+//line functions_print.ryo:6
+func main() {
+var name = greeting()
+rayoPrint(name, 42)
+var total = ((40 + 2) - 1)
+if (total > 40) {
+rayoPrint("big", total)
+} else {
+rayoPrint("small", total)
+}
+}
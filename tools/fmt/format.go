@@ -0,0 +1,381 @@
+package fmt
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+	"rayo/internal/parse"
+)
+
+// Width is the line width past which calls, lists and dict literals are
+// broken over several lines, one element per line.
+const Width = 80
+
+const indentUnit = "    "
+
+// Source formats Rayo source code in the canonical style: four-space
+// indentation, opening braces at the end of the line, one statement per
+// line, at most one blank line between statements, and long calls and
+// literals wrapped at Width. Comments are kept. Formatting is idempotent.
+//
+// Source with syntax errors is not formatted; the error is then a
+// *diag.SourceError, whose File the caller sets.
+func Source(src []byte) ([]byte, error) {
+	p := parse.NewParser(string(src))
+	mod := p.ParseModule()
+	if errs := p.Errors(); len(errs) > 0 {
+		list := &diag.List{}
+		for _, err := range errs {
+			if pe, ok := err.(*parse.ParseError); ok {
+				list.ReportDiagnostic(pe.Diagnostic())
+			} else {
+				list.ReportDiagnostic(diag.Diagnostic{Severity: diag.Error, Code: parse.CodeSyntax, Msg: err.Error()})
+			}
+		}
+		return nil, &diag.SourceError{Source: string(src), Diagnostics: list.Diagnostics}
+	}
+	return Module(mod), nil
+}
+
+// Module formats a parsed module. Comments are placed according to the
+// node spans recorded by the parser; a tree built by hand prints without
+// blank lines between statements.
+func Module(mod *ast.Module) []byte {
+	p := &printer{comments: ast.NewCommentMap(mod), done: map[*ast.CommentGroup]bool{}}
+	var imports []ast.Node
+	for _, imp := range mod.Imports {
+		imports = append(imports, imp)
+	}
+	p.items(imports)
+	if len(imports) > 0 && len(mod.Body) > 0 {
+		p.buf.WriteByte('\n')
+		p.lastLine = 0
+	}
+	p.items(stmtNodes(mod.Body))
+	// Comments at the end of the file, and any the map could not place.
+	p.inner(mod, -1)
+	for _, g := range mod.Comments {
+		if !p.done[g] {
+			p.group(g)
+		}
+	}
+	return p.buf.Bytes()
+}
+
+type printer struct {
+	buf      bytes.Buffer
+	indent   int
+	comments ast.CommentMap
+	done     map[*ast.CommentGroup]bool
+	// lastLine is the source line where the last printed item ended, or 0
+	// at the start of a block, where no blank line is kept.
+	lastLine int
+}
+
+func stmtNodes(stmts []ast.Stmt) []ast.Node {
+	nodes := make([]ast.Node, len(stmts))
+	for i, s := range stmts {
+		nodes[i] = s
+	}
+	return nodes
+}
+
+func (p *printer) writeIndent() {
+	p.buf.WriteString(strings.Repeat(indentUnit, p.indent))
+}
+
+// space keeps one blank line before an item starting at source line
+// line if there was at least one in the source.
+func (p *printer) space(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// items prints a list of statements or imports with their comments.
+func (p *printer) items(nodes []ast.Node) {
+	for _, n := range nodes {
+		// Comments inside a simple statement, such as between the
+		// arguments of a call, move above it.
+		for _, g := range p.comments[n] {
+			gs, ns := g.Span(), n.Span()
+			if gs.End.Offset <= ns.Start.Offset || !hasBlock(n) && gs.Start.Offset < ns.End.Offset {
+				p.group(g)
+			}
+		}
+		p.space(n.Span().Start.Line)
+		p.stmt(n)
+		for _, g := range p.comments[n] {
+			if !p.done[g] && g.Span().Start.Offset >= n.Span().End.Offset {
+				p.trailing(g)
+			}
+		}
+		p.lastLine = n.Span().End.Line
+	}
+}
+
+// group prints a comment group on lines of its own.
+func (p *printer) group(g *ast.CommentGroup) {
+	p.space(g.Span().Start.Line)
+	for _, c := range g.List {
+		p.writeIndent()
+		p.buf.WriteString(strings.TrimRight(c.Text, " \t"))
+		p.buf.WriteByte('\n')
+	}
+	p.done[g] = true
+	p.lastLine = g.Span().End.Line
+}
+
+// trailing appends a comment to the line just printed.
+func (p *printer) trailing(g *ast.CommentGroup) {
+	p.buf.Truncate(p.buf.Len() - 1)
+	for _, c := range g.List {
+		p.buf.WriteString("  ")
+		p.buf.WriteString(strings.TrimRight(c.Text, " \t"))
+	}
+	p.buf.WriteByte('\n')
+	p.done[g] = true
+}
+
+// inner prints the comments of owner left at the end of one of its blocks:
+// those starting before offset limit, or all of them if limit is -1.
+func (p *printer) inner(owner ast.Node, limit int) {
+	for _, g := range p.comments[owner] {
+		if !p.done[g] && (limit < 0 || g.Span().Start.Offset < limit) {
+			p.group(g)
+		}
+	}
+}
+
+// block prints `header {`, the statements and the closing brace, leaving
+// the line open so that else, except or finally can follow. Comments of
+// owner on the header line follow the brace; those before offset limit
+// that are inside the owner go at the end of the block.
+func (p *printer) block(owner ast.Node, header string, body []ast.Stmt, limit int) {
+	p.buf.WriteString(header)
+	p.buf.WriteString(" {")
+	span := owner.Span()
+	for _, g := range p.comments[owner] {
+		gs := g.Span()
+		if !p.done[g] && gs.Start.Line == span.Start.Line && gs.Start.Offset > span.Start.Offset && gs.End.Offset < span.End.Offset {
+			p.buf.WriteString("  ")
+			p.buf.WriteString(strings.TrimRight(g.List[0].Text, " \t"))
+			p.done[g] = true
+		}
+	}
+	p.buf.WriteByte('\n')
+	p.indent++
+	p.lastLine = 0
+	p.items(stmtNodes(body))
+	p.inner(owner, limit)
+	p.indent--
+	p.writeIndent()
+	p.buf.WriteString("}")
+}
+
+// startOf returns the offset where the first of stmts starts, or the end
+// of owner if there are none.
+func startOf(stmts []ast.Stmt, owner ast.Node) int {
+	if len(stmts) > 0 && stmts[0].Span().Start.Line > 0 {
+		return stmts[0].Span().Start.Offset
+	}
+	return owner.Span().End.Offset
+}
+
+func hasBlock(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.FuncDef, *ast.IfStmt, *ast.Elif, *ast.WhileStmt, *ast.ForStmt, *ast.TryStmt, *ast.Except:
+		return true
+	}
+	return false
+}
+
+func (p *printer) stmt(n ast.Node) {
+	switch x := n.(type) {
+	case *ast.Import:
+		p.line(importText(x))
+	case *ast.FuncDef:
+		p.writeIndent()
+		p.block(x, "def "+x.Name+"("+params(x.Params)+")", x.Body, -1)
+		p.buf.WriteByte('\n')
+	case *ast.VarStmt:
+		p.exprLine("var "+x.Name+" = ", x.Value)
+	case *ast.AssignStmt:
+		p.exprLine(parse.Expr(x.Target)+" = ", x.Value)
+	case *ast.ExprStmt:
+		p.exprLine("", x.Expr)
+	case *ast.ReturnStmt:
+		if x.Value == nil {
+			p.line("return")
+		} else {
+			p.exprLine("return ", x.Value)
+		}
+	case *ast.AssertStmt:
+		if x.Msg == nil {
+			p.exprLine("assert ", x.Test)
+		} else {
+			p.line("assert " + parse.Expr(x.Test) + ", " + parse.Expr(x.Msg))
+		}
+	case *ast.IfStmt:
+		p.writeIndent()
+		next := startOf(x.Else, x)
+		if len(x.Elifs) > 0 {
+			next = x.Elifs[0].Span().Start.Offset
+		}
+		p.block(x, "if "+parse.Expr(x.Cond), x.Then, next)
+		for _, elif := range x.Elifs {
+			p.block(elif, " elif "+parse.Expr(elif.Cond), elif.Body, -1)
+		}
+		if len(x.Else) > 0 {
+			p.block(x, " else", x.Else, -1)
+		}
+		p.buf.WriteByte('\n')
+	case *ast.WhileStmt:
+		p.writeIndent()
+		p.block(x, "while "+parse.Expr(x.Cond), x.Body, -1)
+		p.buf.WriteByte('\n')
+	case *ast.ForStmt:
+		p.writeIndent()
+		p.block(x, "for "+x.Var+" in "+parse.Expr(x.Iter), x.Body, -1)
+		p.buf.WriteByte('\n')
+	case *ast.TryStmt:
+		p.writeIndent()
+		next := startOf(x.Finally, x)
+		if len(x.Excepts) > 0 {
+			next = x.Excepts[0].Span().Start.Offset
+		}
+		p.block(x, "try", x.Body, next)
+		for _, exc := range x.Excepts {
+			p.block(exc, " "+exceptHeader(exc), exc.Body, -1)
+		}
+		if len(x.Finally) > 0 {
+			p.block(x, " finally", x.Finally, -1)
+		}
+		p.buf.WriteByte('\n')
+	case *ast.BadStmt:
+		// Source does not format files with syntax errors.
+	}
+}
+
+func (p *printer) line(text string) {
+	p.writeIndent()
+	p.buf.WriteString(text)
+	p.buf.WriteByte('\n')
+}
+
+// exprLine prints a statement made of prefix followed by e, wrapping e if
+// the line is too long.
+func (p *printer) exprLine(prefix string, e ast.Expr) {
+	col := len(indentUnit)*p.indent + utf8.RuneCountInString(prefix)
+	p.line(prefix + p.expr(e, col))
+}
+
+// expr renders e starting at column col (0-based) of a line indented
+// p.indent levels. If it does not fit within Width, a call, list or dict
+// literal is broken after its opening bracket, with one element per line
+// followed by a comma; elements are broken in turn if still too long.
+func (p *printer) expr(e ast.Expr, col int) string {
+	flat := parse.Expr(e)
+	if col+utf8.RuneCountInString(flat) <= Width {
+		return flat
+	}
+	var open, close string
+	var elems []ast.Expr
+	switch x := e.(type) {
+	case *ast.Call:
+		// The callee as printed before an empty argument list, minus ")".
+		head := parse.Expr(&ast.Call{Func: x.Func})
+		open, close, elems = head[:len(head)-1], ")", x.Args
+	case *ast.ListLit:
+		open, close, elems = "[", "]", x.Elems
+	case *ast.DictLit:
+		open, close = "{", "}"
+	default:
+		return flat
+	}
+	p.indent++
+	inner := strings.Repeat(indentUnit, p.indent)
+	var lines []string
+	if d, ok := e.(*ast.DictLit); ok {
+		for i, k := range d.Keys {
+			key := p.expr(k, len(inner))
+			var val ast.Expr
+			if i < len(d.Vals) {
+				val = d.Vals[i]
+			}
+			lines = append(lines, key+": "+p.expr(val, lastLineWidth(inner+key)+2))
+		}
+	} else {
+		for _, el := range elems {
+			lines = append(lines, p.expr(el, len(inner)))
+		}
+	}
+	p.indent--
+	if len(lines) == 0 {
+		return flat
+	}
+	var sb strings.Builder
+	sb.WriteString(open)
+	sb.WriteByte('\n')
+	for _, l := range lines {
+		sb.WriteString(inner)
+		sb.WriteString(l)
+		sb.WriteString(",\n")
+	}
+	sb.WriteString(strings.Repeat(indentUnit, p.indent))
+	sb.WriteString(close)
+	return sb.String()
+}
+
+// lastLineWidth returns the width of the last line of s.
+func lastLineWidth(s string) int {
+	return utf8.RuneCountInString(s[strings.LastIndexByte(s, '\n')+1:])
+}
+
+func importText(imp *ast.Import) string {
+	path := quote(imp.Path)
+	if len(imp.Names) > 0 {
+		names := make([]string, len(imp.Names))
+		for i, n := range imp.Names {
+			names[i] = n.Name
+			if n.Alias != "" {
+				names[i] += " as " + n.Alias
+			}
+		}
+		return "from " + path + " import " + strings.Join(names, ", ")
+	}
+	if imp.Alias != "" {
+		return "import " + path + " as " + imp.Alias
+	}
+	return "import " + path
+}
+
+func params(ps []*ast.Param) string {
+	parts := make([]string, len(ps))
+	for i, p := range ps {
+		parts[i] = p.Name
+		if t := ast.TypeString(p.Type); t != "" {
+			parts[i] += ": " + t
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func exceptHeader(e *ast.Except) string {
+	header := "except"
+	if t := ast.TypeString(e.Type); t != "" {
+		header += " " + t
+	}
+	if e.Var != "" {
+		header += " as " + e.Var
+	}
+	return header
+}
+
+// quote renders a string literal the way parse.Expr does.
+func quote(s string) string {
+	return parse.Expr(ast.NewLiteral(s, diag.Span{}))
+}
@@ -0,0 +1,160 @@
+package fmt
+
+import (
+	"strings"
+	"testing"
+
+	"rayo/internal/ast"
+	"rayo/internal/diag"
+)
+
+func TestSource(t *testing.T) {
+	src := `# Package comment.
+import "os"   # for Args
+import "strings"
+# main is the entry point.
+def main(){   # header
+    # leading
+    x=foo(1,2)    # trailing
+
+
+    if x==1 {
+        print(strings.ToUpper("a very long string argument that goes on"), x, [1, 2, 3])
+        # end of if
+    } else { y = 2 }
+    var d = {"alpha": 1, "beta": [1, 2, 3], "gamma": {"nested": "dictionary value here", "more": 1234567}}
+    # end of main
+}
+
+# end of file
+`
+	want := `# Package comment.
+import "os"  # for Args
+import "strings"
+
+# main is the entry point.
+def main() {  # header
+    # leading
+    x = foo(1, 2)  # trailing
+
+    if x == 1 {
+        print(
+            strings.ToUpper("a very long string argument that goes on"),
+            x,
+            [1, 2, 3],
+        )
+        # end of if
+    } else {
+        y = 2
+    }
+    var d = {
+        "alpha": 1,
+        "beta": [1, 2, 3],
+        "gamma": {"nested": "dictionary value here", "more": 1234567},
+    }
+    # end of main
+}
+
+# end of file
+`
+	got, err := Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	again, err := Source(got)
+	if err != nil {
+		t.Fatalf("formatted source does not parse: %v", err)
+	}
+	if string(again) != string(got) {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+}
+
+func TestSourceIdempotent(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"# only a comment\n",
+		"import \"os\"\nfrom \"./lib.ryo\" import a, b as c\n",
+		"def f() {\n}\n",
+		"def f() {\n    return\n}\n\n\n\ndef g() {\n    return f()  # done\n}\n",
+		"x = [\n  1,\n  2,\n]\ny = {\"a\": 1,}\n",
+		"def f() {\n    if a {\n        b()\n    }\n    # between\n    c()\n}\n",
+		"foo(a,  # first\n    b)\n",
+		"assert  x==1 ,  \"x is one\"\nassert f(x)  # checked\n",
+		"var s = \"" + strings.Repeat("x", 100) + "\"\n",
+		"call(" + strings.Repeat("argument, ", 12) + "last)\n",
+	} {
+		once, err := Source([]byte(src))
+		if err != nil {
+			t.Errorf("Source(%q): %v", src, err)
+			continue
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Errorf("reformatting %q: %v\n%s", src, err, once)
+			continue
+		}
+		if string(once) != string(twice) {
+			t.Errorf("not idempotent for %q:\n%s\nthen:\n%s", src, once, twice)
+		}
+		// No comment is lost.
+		for _, line := range strings.Split(src, "\n") {
+			if i := strings.Index(line, "#"); i >= 0 && !strings.Contains(string(once), strings.TrimSpace(line[i:])) {
+				t.Errorf("comment %q lost:\n%s", line[i:], once)
+			}
+		}
+	}
+}
+
+func TestSourceParams(t *testing.T) {
+	got, err := Source([]byte("def add(a,b) {\n    return a+b\n}\ndef apply(f:def(int, int) -> int,xs :list[int]) {\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "def add(a, b) {\n    return a + b\n}\ndef apply(f: def(int, int) -> int, xs: list[int]) {\n}\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	// Parameters it cannot print back stop the formatter
+	if _, err := Source([]byte("def f(a = 1) {\n}\n")); err == nil {
+		t.Errorf("formatted a parameter with a default value")
+	}
+}
+
+func TestSourceSyntaxError(t *testing.T) {
+	_, err := Source([]byte("def main() {\n    x = )\n}\n"))
+	se, ok := err.(*diag.SourceError)
+	if !ok {
+		t.Fatalf("expected a *diag.SourceError, got %v", err)
+	}
+	if len(se.Diagnostics) != 1 || se.Diagnostics[0].Span.Start.Line != 2 {
+		t.Errorf("unexpected diagnostics %+v", se.Diagnostics)
+	}
+}
+
+func TestModuleWrapsNestedLiterals(t *testing.T) {
+	long := func(s string) ast.Expr { return ast.NewLiteral(strings.Repeat(s, 30), diag.Span{}) }
+	mod := &ast.Module{Body: []ast.Stmt{
+		&ast.AssignStmt{
+			Target: ast.NewName("config", diag.Span{}),
+			Value: &ast.DictLit{
+				Keys: []ast.Expr{ast.NewLiteral("name", diag.Span{}), ast.NewLiteral("items", diag.Span{})},
+				Vals: []ast.Expr{ast.NewLiteral("rayo", diag.Span{}), &ast.ListLit{Elems: []ast.Expr{long("a"), long("b")}}},
+			},
+		},
+	}}
+	want := `config = {
+    "name": "rayo",
+    "items": [
+        "` + strings.Repeat("a", 30) + `",
+        "` + strings.Repeat("b", 30) + `",
+    ],
+}
+`
+	if got := string(Module(mod)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
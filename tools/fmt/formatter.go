@@ -6,6 +6,8 @@ import (
 )
 
 // FormatTokens formats a token stream with stable rules.
+//
+// Deprecated: FormatTokens drops comments and line breaks. Use Source.
 func FormatTokens(tokens []lex.Token) string {
 	var sb strings.Builder
 	for i, tok := range tokens {